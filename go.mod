@@ -3,6 +3,7 @@ module github.com/mehmetokdemir/social-media-api
 go 1.20
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/ansrivas/fiberprometheus/v2 v2.6.1
 	github.com/arsmn/fiber-swagger/v2 v2.31.1
 	github.com/cloudinary/cloudinary-go v1.7.0
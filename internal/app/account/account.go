@@ -0,0 +1,87 @@
+package account
+
+import "github.com/mehmetokdemir/social-media-api/internal/app/entity"
+
+type DeleteRequest struct {
+	Password string `json:"password" extensions:"x-order=1" example:"TopSecret!!!"` // Current password of the user, accounts created through an identity provider have none
+}
+
+type DeletionResponse struct {
+	DeletionDueAt string                    `json:"deletion_due_at" extensions:"x-order=1" example:"2024-02-21T11:31:40+03:00"` // Account is deleted at this time unless the deletion is cancelled
+	Policy        entity.DeletionPolicyEnum `json:"policy" extensions:"x-order=2" example:"delete"`                             // Either delete or anonymize, what happens to posts, comments and likes
+}
+
+type DeactivateRequest struct {
+	Password string `json:"password" extensions:"x-order=1" example:"TopSecret!!!"` // Current password of the user, accounts created through an identity provider have none
+}
+
+type DeactivationResponse struct {
+	ReactivateUntil string `json:"reactivate_until" extensions:"x-order=1" example:"2024-04-21T11:31:40+03:00"` // Logging in until this time restores the account, after that it stays hidden but is not deleted
+}
+
+type DataExportResponse struct {
+	Id          uint                        `json:"id" extensions:"x-order=1" example:"1"`
+	Status      entity.DataExportStatusEnum `json:"status" extensions:"x-order=2" example:"ready"` // One of pending, processing, ready, failed
+	CreatedAt   string                      `json:"created_at" extensions:"x-order=3" example:"2024-01-22T11:31:40+03:00"`
+	CompletedAt *string                     `json:"completed_at" extensions:"x-order=4" example:"2024-01-22T11:32:10+03:00"`
+	ExpiresAt   *string                     `json:"expires_at" extensions:"x-order=5" example:"2024-01-29T11:32:10+03:00"` // Archive can not be downloaded after this time
+	Error       string                      `json:"error,omitempty" extensions:"x-order=6"`
+}
+
+// Archive files, kept close to the DB models but without secrets like password hashes
+
+type exportProfile struct {
+	Id              uint    `json:"id"`
+	Username        string  `json:"username"`
+	Email           string  `json:"email"`
+	FirstName       string  `json:"first_name"`
+	LastName        string  `json:"last_name"`
+	PhoneNumber     string  `json:"phone_number"`
+	Bio             string  `json:"bio"`
+	Location        string  `json:"location"`
+	Website         string  `json:"website"`
+	Birthday        *string `json:"birthday"`
+	Pronouns        string  `json:"pronouns"`
+	ProfilePhoto    string  `json:"profile_photo"`
+	CoverPhoto      string  `json:"cover_photo"`
+	Role            string  `json:"role"`
+	EmailVerifiedAt *string `json:"email_verified_at"`
+	CreatedAt       string  `json:"created_at"`
+}
+
+type exportPost struct {
+	Id        uint   `json:"id"`
+	Body      string `json:"body"`
+	Image     string `json:"image"`
+	CreatedAt string `json:"created_at"`
+}
+
+type exportComment struct {
+	Id        uint   `json:"id"`
+	PostId    uint   `json:"post_id"`
+	ParentId  *uint  `json:"parent_id"`
+	Body      string `json:"body"`
+	Image     string `json:"image"`
+	CreatedAt string `json:"created_at"`
+}
+
+type exportLike struct {
+	Id          uint               `json:"id"`
+	ContentType entity.ContentType `json:"content_type"`
+	ContentId   uint               `json:"content_id"`
+	CreatedAt   string             `json:"created_at"`
+}
+
+type exportFriendship struct {
+	Id         uint                        `json:"id"`
+	SenderId   uint                        `json:"sender_id"`
+	ReceiverId uint                        `json:"receiver_id"`
+	Status     entity.FriendshipStatusEnum `json:"status"`
+	CreatedAt  string                      `json:"created_at"`
+}
+
+type exportMedia struct {
+	Source   string `json:"source"` // One of profile_photo, cover_photo, post, comment
+	SourceId uint   `json:"source_id"`
+	URL      string `json:"url"`
+}
@@ -0,0 +1,260 @@
+package account
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
+	"github.com/mehmetokdemir/social-media-api/internal/middleware"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+type HttpHandler struct {
+	accountService    IAccountService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
+}
+
+func NewHttpHandler(guardService guard.IGuardService, accountService IAccountService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, accountService: accountService, logger: logger, signingKeyService: signingKeyService}
+}
+
+func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
+	appGroup := app.Group("/account").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
+	appGroup.Post("/delete", h.RequestDeletion)
+	appGroup.Post("/delete/cancel", h.CancelDeletion)
+	appGroup.Post("/deactivate", h.Deactivate)
+	appGroup.Post("/export", h.RequestDataExport)
+	appGroup.Get("/export/:export_id", h.GetDataExport)
+	appGroup.Get("/export/:export_id/download", h.DownloadDataExport)
+}
+
+// RequestDeletion godoc
+// @Summary Delete account
+// @Description Schedule the account of the user to be deleted after the grace period, it can be cancelled until then.
+// @Description API keys of the user are revoked right away. Depending on the policy of the server posts, comments and likes are
+// @Description either deleted or kept without telling who wrote them. Friendships and personal data are always deleted.
+// @Tags Account
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param request body DeleteRequest true "body params"
+// @Success 200 {object} DeletionResponse
+// @Failure 400
+// @Failure 401
+// @Failure 500
+// @Router /account/delete [post]
+func (h *HttpHandler) RequestDeletion(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	var req DeleteRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	rsp, err := h.accountService.RequestDeletion(userID, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPassword) {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(httpresponse.NewError("can not delete account", err.Error(), http.StatusUnauthorized))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not delete account", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// CancelDeletion godoc
+// @Summary Cancel account deletion
+// @Description Cancel the scheduled deletion of the account of the user
+// @Tags Account
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /account/delete/cancel [post]
+func (h *HttpHandler) CancelDeletion(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err := h.accountService.CancelDeletion(userID); err != nil {
+		if errors.Is(err, ErrDeletionNotScheduled) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not cancel account deletion", err.Error(), http.StatusBadRequest))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not cancel account deletion", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// Deactivate godoc
+// @Summary Deactivate account
+// @Description Hide the profile, posts, comments, likes and friendships of the user and log them out of every session.
+// @Description Logging in again within the reactivation window restores everything. The account is never deleted on its own.
+// @Tags Account
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param request body DeactivateRequest true "body params"
+// @Success 200 {object} DeactivationResponse
+// @Failure 400
+// @Failure 401
+// @Failure 500
+// @Router /account/deactivate [post]
+func (h *HttpHandler) Deactivate(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	var req DeactivateRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	rsp, err := h.accountService.Deactivate(userID, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPassword) {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(httpresponse.NewError("can not deactivate account", err.Error(), http.StatusUnauthorized))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not deactivate account", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// RequestDataExport godoc
+// @Summary Request data export
+// @Description Request an archive of the profile, posts, comments, likes, friendships and uploaded media URLs of the user.
+// @Description The archive is prepared in the background, poll the export until it is ready and download it within a week.
+// @Tags Account
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Success 200 {object} DataExportResponse
+// @Failure 400
+// @Failure 409
+// @Failure 500
+// @Router /account/export [post]
+func (h *HttpHandler) RequestDataExport(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	rsp, err := h.accountService.RequestDataExport(userID)
+	if err != nil {
+		if errors.Is(err, ErrDataExportInProgress) {
+			return ctx.Status(fiber.StatusConflict).JSON(httpresponse.NewError("can not request data export", err.Error(), http.StatusConflict))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not request data export", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// GetDataExport godoc
+// @Summary Get data export
+// @Description Get the status of a data export of the user
+// @Tags Account
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param export_id path integer true "ID of the data export"
+// @Success 200 {object} DataExportResponse
+// @Failure 400
+// @Failure 404
+// @Router /account/export/{export_id} [get]
+func (h *HttpHandler) GetDataExport(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	exportID, err := strconv.ParseUint(ctx.Params("export_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse export_id", err.Error(), http.StatusBadRequest))
+	}
+
+	rsp, err := h.accountService.GetDataExport(userID, uint(exportID))
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not get data export", err.Error(), http.StatusNotFound))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// DownloadDataExport godoc
+// @Summary Download data export
+// @Description Redirect to a link which downloads the zip archive of a data export which is ready, the link works for 5 minutes
+// @Tags Account
+// @Produce  application/zip
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param export_id path integer true "ID of the data export"
+// @Success 302
+// @Failure 400
+// @Failure 404
+// @Failure 409
+// @Router /account/export/{export_id}/download [get]
+func (h *HttpHandler) DownloadDataExport(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	exportID, err := strconv.ParseUint(ctx.Params("export_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse export_id", err.Error(), http.StatusBadRequest))
+	}
+
+	downloadURL, err := h.accountService.GetDataExportURL(userID, uint(exportID))
+	if err != nil {
+		if errors.Is(err, ErrDataExportUnavailable) {
+			return ctx.Status(fiber.StatusConflict).JSON(httpresponse.NewError("can not download data export", err.Error(), http.StatusConflict))
+		}
+		return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not download data export", err.Error(), http.StatusNotFound))
+	}
+
+	return ctx.Redirect(downloadURL, fiber.StatusFound)
+}
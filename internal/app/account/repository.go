@@ -0,0 +1,323 @@
+package account
+
+import (
+	"fmt"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type IAccountRepository interface {
+	GetUserByID(userID uint) (*entity.User, error)
+	ScheduleDeletion(userID uint, dueAt time.Time) error
+	CancelDeletion(userID uint) error
+	ListDueDeletions(now time.Time, limit int) ([]entity.User, error)
+	Deactivate(userID uint) error
+	DeleteAccount(userID uint, policy entity.DeletionPolicyEnum, scrambledPassword string) error
+
+	ListPostsByUserID(userID uint) ([]entity.Post, error)
+	ListCommentsByUserID(userID uint) ([]entity.Comment, error)
+	ListLikesByUserID(userID uint) ([]entity.Like, error)
+	ListFriendshipsByUserID(userID uint) ([]entity.Friendship, error)
+
+	CreateDataExport(dataExport entity.DataExport) (*entity.DataExport, error)
+	GetDataExport(id uint) (*entity.DataExport, error)
+	GetUnfinishedDataExport(userID uint) (*entity.DataExport, error)
+	ClaimPendingDataExport(staleBefore time.Time) (*entity.DataExport, error)
+	UpdateDataExport(id uint, fields map[string]interface{}) error
+	ListExpiredDataExports(now time.Time) ([]entity.DataExport, error)
+	ListDataExportsByUserID(userID uint) ([]entity.DataExport, error)
+	DeleteDataExport(id uint) error
+	Migration() error
+}
+
+type accountRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewRepository(db *gorm.DB, logger *zap.SugaredLogger) IAccountRepository {
+	return &accountRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *accountRepository) GetUserByID(userID uint) (user *entity.User, err error) {
+	if err = r.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *accountRepository) ScheduleDeletion(userID uint, dueAt time.Time) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.User{}).Where("id = ?", userID).Update("deletion_due_at", dueAt).Error; err != nil {
+			return err
+		}
+		// Integrations should not keep acting for an account which is going away, the user can create new keys after cancelling
+		return tx.Model(&entity.ApiKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error
+	})
+}
+
+func (r *accountRepository) CancelDeletion(userID uint) error {
+	return r.db.Model(&entity.User{}).Where("id = ?", userID).Update("deletion_due_at", nil).Error
+}
+
+// ListDueDeletions lists users who asked for deletion and whose grace period is over. Deactivated users are never
+// deleted on their own, deactivation stays reversible.
+func (r *accountRepository) ListDueDeletions(now time.Time, limit int) ([]entity.User, error) {
+	var users []entity.User
+	if err := r.db.Where("deletion_due_at <= ?", now).Order("id").Limit(limit).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// DeleteAccount removes everything which identifies the user in one transaction. The user row itself is kept soft-deleted
+// with its personal data wiped, so that content kept by the anonymize policy still points to a row.
+func (r *accountRepository) DeleteAccount(userID uint, policy entity.DeletionPolicyEnum, scrambledPassword string) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if policy == entity.DeletionPolicyDelete {
+			if err := r.deleteContent(tx, userID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where("sender_id = ? OR receiver_id = ?", userID, userID).Delete(&entity.Friendship{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("follower_id = ? OR followee_id = ?", userID, userID).Delete(&entity.Follow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ? OR dismissed_id = ?", userID, userID).Delete(&entity.SuggestionDismissal{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("blocker_id = ? OR blocked_id = ?", userID, userID).Delete(&entity.Block{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("muter_id = ? OR muted_id = ?", userID, userID).Delete(&entity.Mute{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("member_id = ? OR friend_list_id IN (SELECT id FROM friend_lists WHERE user_id = ?)", userID, userID).Delete(&entity.FriendListMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&entity.FriendList{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&entity.PostAudienceMember{}).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{&entity.ExternalIdentity{}, &entity.UserToken{}, &entity.RecoveryCode{}, &entity.UsernameAlias{}, &entity.DataExport{}} {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, model := range []interface{}{&entity.Session{}, &entity.RefreshToken{}, &entity.ApiKey{}} {
+			if err := tx.Model(model).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&entity.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"username":          fmt.Sprintf("deleted-%d", userID),
+			"email":             fmt.Sprintf("deleted-%d@deleted.invalid", userID),
+			"password":          scrambledPassword,
+			"first_name":        "",
+			"last_name":         "",
+			"phone_number":      "",
+			"profile_photo":     "",
+			"cover_photo":       "",
+			"bio":               "",
+			"location":          "",
+			"website":           "",
+			"birthday":          nil,
+			"pronouns":          "",
+			"pending_email":     "",
+			"email_verified_at": nil,
+			"totp_secret":       "",
+			"totp_enabled_at":   nil,
+			"deletion_due_at":   nil,
+			"deactivated_at":    nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", userID).Delete(&entity.User{}).Error
+	})
+}
+
+// deleteContent hard deletes posts, comments and likes of the user together with the comments and likes others left on them
+func (r *accountRepository) deleteContent(tx *gorm.DB, userID uint) error {
+	var postIDs []uint
+	if err := tx.Unscoped().Model(&entity.Post{}).Where("user_id = ?", userID).Pluck("id", &postIDs).Error; err != nil {
+		return err
+	}
+
+	// Replies to a deleted comment go with it, whoever wrote them
+	var commentIDs []uint
+	if err := tx.Raw(`
+		WITH RECURSIVE doomed AS (
+			SELECT id FROM comments WHERE user_id = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)
+			UNION
+			SELECT c.id FROM comments c JOIN doomed d ON c.parent_id = d.id
+		)
+		SELECT id FROM doomed`, userID, userID).Scan(&commentIDs).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&entity.Like{}).Error; err != nil {
+		return err
+	}
+	if len(postIDs) > 0 {
+		if err := tx.Unscoped().Where("content_type = ? AND content_id IN ?", entity.ContentTypePost, postIDs).Delete(&entity.Like{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("post_id IN ?", postIDs).Delete(&entity.PostAudienceMember{}).Error; err != nil {
+			return err
+		}
+	}
+	if len(commentIDs) > 0 {
+		if err := tx.Unscoped().Where("content_type = ? AND content_id IN ?", entity.ContentTypeComment, commentIDs).Delete(&entity.Like{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id IN ?", commentIDs).Delete(&entity.Comment{}).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Unscoped().Where("user_id = ?", userID).Delete(&entity.Post{}).Error
+}
+
+// Deactivate hides the user and logs them out everywhere, API keys are kept but rejected until the user comes back
+func (r *accountRepository) Deactivate(userID uint) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.User{}).Where("id = ?", userID).Update("deactivated_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entity.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error
+	})
+}
+
+func (r *accountRepository) ListPostsByUserID(userID uint) ([]entity.Post, error) {
+	var posts []entity.Post
+	if err := r.db.Where("user_id = ?", userID).Order("id").Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (r *accountRepository) ListCommentsByUserID(userID uint) ([]entity.Comment, error) {
+	var comments []entity.Comment
+	if err := r.db.Where("user_id = ?", userID).Order("id").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (r *accountRepository) ListLikesByUserID(userID uint) ([]entity.Like, error) {
+	var likes []entity.Like
+	if err := r.db.Where("user_id = ?", userID).Order("id").Find(&likes).Error; err != nil {
+		return nil, err
+	}
+	return likes, nil
+}
+
+func (r *accountRepository) ListFriendshipsByUserID(userID uint) ([]entity.Friendship, error) {
+	var friendships []entity.Friendship
+	if err := r.db.Where("sender_id = ? OR receiver_id = ?", userID, userID).Order("id").Find(&friendships).Error; err != nil {
+		return nil, err
+	}
+	return friendships, nil
+}
+
+func (r *accountRepository) CreateDataExport(dataExport entity.DataExport) (*entity.DataExport, error) {
+	if err := r.db.Create(&dataExport).Error; err != nil {
+		return nil, err
+	}
+	return &dataExport, nil
+}
+
+func (r *accountRepository) GetDataExport(id uint) (dataExport *entity.DataExport, err error) {
+	if err = r.db.Where("id = ?", id).First(&dataExport).Error; err != nil {
+		return nil, err
+	}
+	return dataExport, nil
+}
+
+func (r *accountRepository) GetUnfinishedDataExport(userID uint) (*entity.DataExport, error) {
+	var dataExports []entity.DataExport
+	if err := r.db.Where("user_id = ? AND status IN ?", userID, []entity.DataExportStatusEnum{entity.DataExportStatusPending, entity.DataExportStatusProcessing}).
+		Limit(1).Find(&dataExports).Error; err != nil {
+		return nil, err
+	}
+	if len(dataExports) == 0 {
+		return nil, nil
+	}
+	return &dataExports[0], nil
+}
+
+// ClaimPendingDataExport marks the oldest pending export as processing, rows locked by another instance are skipped.
+// Exports claimed before staleBefore are claimed again, the instance building them stopped before finishing.
+func (r *accountRepository) ClaimPendingDataExport(staleBefore time.Time) (*entity.DataExport, error) {
+	var claimed *entity.DataExport
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var dataExports []entity.DataExport
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND (claimed_at IS NULL OR claimed_at < ?))", entity.DataExportStatusPending, entity.DataExportStatusProcessing, staleBefore).
+			Order("id").Limit(1).Find(&dataExports).Error; err != nil {
+			return err
+		}
+		if len(dataExports) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		claimed = &dataExports[0]
+		claimed.Status, claimed.ClaimedAt = entity.DataExportStatusProcessing, &now
+		return tx.Model(&entity.DataExport{}).Where("id = ?", claimed.ID).
+			Updates(map[string]interface{}{"status": entity.DataExportStatusProcessing, "claimed_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+func (r *accountRepository) UpdateDataExport(id uint, fields map[string]interface{}) error {
+	return r.db.Model(&entity.DataExport{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *accountRepository) ListExpiredDataExports(now time.Time) ([]entity.DataExport, error) {
+	var dataExports []entity.DataExport
+	if err := r.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&dataExports).Error; err != nil {
+		return nil, err
+	}
+	return dataExports, nil
+}
+
+func (r *accountRepository) ListDataExportsByUserID(userID uint) ([]entity.DataExport, error) {
+	var dataExports []entity.DataExport
+	if err := r.db.Where("user_id = ?", userID).Find(&dataExports).Error; err != nil {
+		return nil, err
+	}
+	return dataExports, nil
+}
+
+func (r *accountRepository) DeleteDataExport(id uint) error {
+	return r.db.Unscoped().Where("id = ?", id).Delete(&entity.DataExport{}).Error
+}
+
+func (r *accountRepository) Migration() error {
+	return r.db.AutoMigrate(entity.DataExport{})
+}
@@ -0,0 +1,508 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mehmetokdemir/social-media-api/internal/app/cdn"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/mail"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+const (
+	dataExportLifetime     = 7 * 24 * time.Hour
+	dataExportLinkLifetime = 5 * time.Minute
+	dataExportInterval     = time.Minute
+	dataExportClaimTimeout = 30 * time.Minute // An export processing longer is taken over, its instance is assumed dead
+	accountDeletionBatch   = 100
+	accountDeletionPeriod  = time.Hour
+	scrambledPasswordBytes = 32
+)
+
+var (
+	ErrInvalidPassword       = errors.New("invalid password")
+	ErrDeletionNotScheduled  = errors.New("account deletion is not scheduled")
+	ErrDataExportInProgress  = errors.New("data export is already in progress")
+	ErrDataExportNotFound    = errors.New("data export not found")
+	ErrDataExportUnavailable = errors.New("data export is not ready or expired")
+)
+
+type IAccountService interface {
+	RequestDeletion(userID uint, password string) (*DeletionResponse, error)
+	Deactivate(userID uint, password string) (*DeactivationResponse, error)
+	CancelDeletion(userID uint) error
+	RequestDataExport(userID uint) (*DataExportResponse, error)
+	GetDataExport(userID, dataExportID uint) (*DataExportResponse, error)
+	GetDataExportURL(userID, dataExportID uint) (string, error)
+	StartJobs()
+}
+
+type accountService struct {
+	config     config.Config
+	logger     *zap.SugaredLogger
+	repository IAccountRepository
+	mailer     mail.IMailer
+	cdnService cdn.ICdnService
+}
+
+// NewAccountService builds the account service. Data export archives are kept in the cdn, so that any instance of the
+// service can build, serve and remove them whichever instance claimed the export.
+func NewAccountService(repository IAccountRepository, mailer mail.IMailer, cdnService cdn.ICdnService, logger *zap.SugaredLogger, config config.Config) IAccountService {
+	if repository == nil {
+		return nil
+	}
+
+	return &accountService{
+		config:     config,
+		logger:     logger,
+		repository: repository,
+		mailer:     mailer,
+		cdnService: cdnService,
+	}
+}
+
+func (s *accountService) policy() entity.DeletionPolicyEnum {
+	if entity.DeletionPolicyEnum(s.config.AccountDeletionPolicy) == entity.DeletionPolicyAnonymize {
+		return entity.DeletionPolicyAnonymize
+	}
+	return entity.DeletionPolicyDelete
+}
+
+// checkPassword confirms the request with the password, accounts which never had one are trusted with their session
+func (s *accountService) checkPassword(user *entity.User, password string) error {
+	if user.Passwordless {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// RequestDeletion schedules the account to be deleted after the grace period, it can be cancelled until then
+func (s *accountService) RequestDeletion(userID uint, password string) (*DeletionResponse, error) {
+	user, err := s.repository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.checkPassword(user, password); err != nil {
+		return nil, err
+	}
+
+	dueAt := time.Now().Add(time.Duration(s.config.AccountDeletionDays) * 24 * time.Hour)
+	if user.DeletionDueAt != nil {
+		// Asking again does not push the deletion further away
+		dueAt = *user.DeletionDueAt
+	} else if err = s.repository.ScheduleDeletion(userID, dueAt); err != nil {
+		return nil, err
+	}
+
+	if err = s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account is going to be deleted on %s. You can cancel the deletion until then from the account settings.\nIf you did not ask for it, cancel the deletion and reset your password.\n",
+			user.FirstName, dueAt.Format(time.RFC1123)),
+	}); err != nil {
+		s.logger.Errorf("can not send account deletion notice to user %d: %v", user.ID, err)
+	}
+
+	return &DeletionResponse{
+		DeletionDueAt: dueAt.Format(time.RFC3339),
+		Policy:        s.policy(),
+	}, nil
+}
+
+// Deactivate hides the user until they log in again within the reactivation window
+func (s *accountService) Deactivate(userID uint, password string) (*DeactivationResponse, error) {
+	user, err := s.repository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.checkPassword(user, password); err != nil {
+		return nil, err
+	}
+
+	if err = s.repository.Deactivate(userID); err != nil {
+		return nil, err
+	}
+
+	return &DeactivationResponse{
+		ReactivateUntil: time.Now().Add(s.reactivationWindow()).Format(time.RFC3339),
+	}, nil
+}
+
+func (s *accountService) reactivationWindow() time.Duration {
+	return time.Duration(s.config.AccountReactivationDays) * 24 * time.Hour
+}
+
+func (s *accountService) CancelDeletion(userID uint) error {
+	user, err := s.repository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if user.DeletionDueAt == nil {
+		return ErrDeletionNotScheduled
+	}
+
+	return s.repository.CancelDeletion(userID)
+}
+
+func (s *accountService) RequestDataExport(userID uint) (*DataExportResponse, error) {
+	unfinished, err := s.repository.GetUnfinishedDataExport(userID)
+	if err != nil {
+		return nil, err
+	}
+	if unfinished != nil {
+		return nil, ErrDataExportInProgress
+	}
+
+	dataExport, err := s.repository.CreateDataExport(entity.DataExport{
+		UserID: userID,
+		Status: entity.DataExportStatusPending,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toDataExportResponse(dataExport), nil
+}
+
+func (s *accountService) GetDataExport(userID, dataExportID uint) (*DataExportResponse, error) {
+	dataExport, err := s.getOwnDataExport(userID, dataExportID)
+	if err != nil {
+		return nil, err
+	}
+	return toDataExportResponse(dataExport), nil
+}
+
+// GetDataExportURL signs a short-lived url to download the archive of the data export from the cdn
+func (s *accountService) GetDataExportURL(userID, dataExportID uint) (string, error) {
+	dataExport, err := s.getOwnDataExport(userID, dataExportID)
+	if err != nil {
+		return "", err
+	}
+
+	if dataExport.Status != entity.DataExportStatusReady || (dataExport.ExpiresAt != nil && dataExport.ExpiresAt.Before(time.Now())) {
+		return "", ErrDataExportUnavailable
+	}
+
+	return s.cdnService.PrivateDownloadURL(dataExport.FilePath, time.Now().Add(dataExportLinkLifetime))
+}
+
+func (s *accountService) getOwnDataExport(userID, dataExportID uint) (*entity.DataExport, error) {
+	dataExport, err := s.repository.GetDataExport(dataExportID)
+	if err != nil || dataExport.UserID != userID {
+		return nil, ErrDataExportNotFound
+	}
+	return dataExport, nil
+}
+
+// StartJobs builds requested data exports, removes expired archives and deletes accounts whose grace period is over
+func (s *accountService) StartJobs() {
+	go func() {
+		ticker := time.NewTicker(dataExportInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.processDataExports()
+			s.purgeDataExports()
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(accountDeletionPeriod)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.deleteDueAccounts(); err != nil {
+				s.logger.Errorf("can not delete accounts: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *accountService) processDataExports() {
+	for {
+		dataExport, err := s.repository.ClaimPendingDataExport(time.Now().Add(-dataExportClaimTimeout))
+		if err != nil {
+			s.logger.Errorf("can not claim data export: %v", err)
+			return
+		}
+		if dataExport == nil {
+			return
+		}
+
+		filePath, err := s.buildArchive(dataExport)
+		if err != nil {
+			s.logger.Errorf("can not build data export %d: %v", dataExport.ID, err)
+			if err = s.repository.UpdateDataExport(dataExport.ID, map[string]interface{}{
+				"status": entity.DataExportStatusFailed,
+				"error":  err.Error(),
+			}); err != nil {
+				s.logger.Errorf("can not update data export %d: %v", dataExport.ID, err)
+			}
+			continue
+		}
+
+		now := time.Now()
+		if err = s.repository.UpdateDataExport(dataExport.ID, map[string]interface{}{
+			"status":       entity.DataExportStatusReady,
+			"file_path":    filePath,
+			"completed_at": now,
+			"expires_at":   now.Add(dataExportLifetime),
+		}); err != nil {
+			s.logger.Errorf("can not update data export %d: %v", dataExport.ID, err)
+		}
+	}
+}
+
+func (s *accountService) purgeDataExports() {
+	dataExports, err := s.repository.ListExpiredDataExports(time.Now())
+	if err != nil {
+		s.logger.Errorf("can not list expired data exports: %v", err)
+		return
+	}
+
+	for _, dataExport := range dataExports {
+		if err = s.removeArchive(dataExport); err != nil {
+			s.logger.Errorf("can not remove archive of data export %d: %v", dataExport.ID, err)
+			continue
+		}
+		if err = s.repository.DeleteDataExport(dataExport.ID); err != nil {
+			s.logger.Errorf("can not delete data export %d: %v", dataExport.ID, err)
+		}
+	}
+}
+
+func (s *accountService) deleteDueAccounts() error {
+	users, err := s.repository.ListDueDeletions(time.Now(), accountDeletionBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err = s.deleteAccount(user); err != nil {
+			s.logger.Errorf("can not delete account of user %d: %v", user.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *accountService) deleteAccount(user entity.User) error {
+	dataExports, err := s.repository.ListDataExportsByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	for _, dataExport := range dataExports {
+		if err = s.removeArchive(dataExport); err != nil {
+			return err
+		}
+	}
+
+	// Nobody knows this password, the account can never be logged in again
+	b := make([]byte, scrambledPasswordBytes)
+	if _, err = rand.Read(b); err != nil {
+		return err
+	}
+	scrambledPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(b)), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err = s.repository.DeleteAccount(user.ID, s.policy(), string(scrambledPassword)); err != nil {
+		return err
+	}
+
+	if err = s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your account is deleted",
+		Body:    fmt.Sprintf("Hi %s,\n\nYour account and its data are deleted as you asked.\n", user.FirstName),
+	}); err != nil {
+		s.logger.Errorf("can not send account deleted notice to user %d: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+func (s *accountService) removeArchive(dataExport entity.DataExport) error {
+	if dataExport.FilePath == "" {
+		return nil
+	}
+	return s.cdnService.DeletePrivateFile(dataExport.FilePath)
+}
+
+// buildArchive writes the data of the user as JSON files into a zip archive and uploads it to the cdn as a private
+// file, the public id of the file is returned
+func (s *accountService) buildArchive(dataExport *entity.DataExport) (string, error) {
+	user, err := s.repository.GetUserByID(dataExport.UserID)
+	if err != nil {
+		return "", err
+	}
+	posts, err := s.repository.ListPostsByUserID(user.ID)
+	if err != nil {
+		return "", err
+	}
+	comments, err := s.repository.ListCommentsByUserID(user.ID)
+	if err != nil {
+		return "", err
+	}
+	likes, err := s.repository.ListLikesByUserID(user.ID)
+	if err != nil {
+		return "", err
+	}
+	friendships, err := s.repository.ListFriendshipsByUserID(user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	name := make([]byte, 16)
+	if _, err = rand.Read(name); err != nil {
+		return "", err
+	}
+	publicID := fmt.Sprintf("exports/export-%d-%s.zip", user.ID, hex.EncodeToString(name))
+
+	var file bytes.Buffer
+	archive := zip.NewWriter(&file)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", toExportProfile(user)},
+		{"posts.json", toExportPosts(posts)},
+		{"comments.json", toExportComments(comments)},
+		{"likes.json", toExportLikes(likes)},
+		{"friendships.json", toExportFriendships(friendships)},
+		{"media.json", toExportMedia(user, posts, comments)},
+	}
+	for _, f := range files {
+		w, err := archive.Create(f.name)
+		if err != nil {
+			return "", err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(f.data); err != nil {
+			return "", err
+		}
+	}
+
+	if err = archive.Close(); err != nil {
+		return "", err
+	}
+
+	if err = s.cdnService.UploadPrivateFile(publicID, &file); err != nil {
+		return "", err
+	}
+	return publicID, nil
+}
+
+func toDataExportResponse(dataExport *entity.DataExport) *DataExportResponse {
+	return &DataExportResponse{
+		Id:          dataExport.ID,
+		Status:      dataExport.Status,
+		CreatedAt:   dataExport.CreatedAt.Format(time.RFC3339),
+		CompletedAt: formatTime(dataExport.CompletedAt),
+		ExpiresAt:   formatTime(dataExport.ExpiresAt),
+		Error:       dataExport.Error,
+	}
+}
+
+func toExportProfile(user *entity.User) exportProfile {
+	var birthday *string
+	if user.Birthday != nil {
+		formatted := user.Birthday.Format("2006-01-02")
+		birthday = &formatted
+	}
+
+	return exportProfile{
+		Id:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		PhoneNumber:     user.PhoneNumber,
+		Bio:             user.Bio,
+		Location:        user.Location,
+		Website:         user.Website,
+		Birthday:        birthday,
+		Pronouns:        user.Pronouns,
+		ProfilePhoto:    user.ProfilePhoto,
+		CoverPhoto:      user.CoverPhoto,
+		Role:            string(user.Role),
+		EmailVerifiedAt: formatTime(user.EmailVerifiedAt),
+		CreatedAt:       user.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func toExportPosts(posts []entity.Post) []exportPost {
+	rsp := make([]exportPost, 0, len(posts))
+	for _, post := range posts {
+		rsp = append(rsp, exportPost{Id: post.ID, Body: post.Body, Image: post.Image, CreatedAt: post.CreatedAt.Format(time.RFC3339)})
+	}
+	return rsp
+}
+
+func toExportComments(comments []entity.Comment) []exportComment {
+	rsp := make([]exportComment, 0, len(comments))
+	for _, comment := range comments {
+		rsp = append(rsp, exportComment{Id: comment.ID, PostId: comment.PostID, ParentId: comment.ParenId, Body: comment.Body, Image: comment.Image, CreatedAt: comment.CreatedAt.Format(time.RFC3339)})
+	}
+	return rsp
+}
+
+func toExportLikes(likes []entity.Like) []exportLike {
+	rsp := make([]exportLike, 0, len(likes))
+	for _, like := range likes {
+		rsp = append(rsp, exportLike{Id: like.ID, ContentType: like.ContentType, ContentId: like.ContentID, CreatedAt: like.CreatedAt.Format(time.RFC3339)})
+	}
+	return rsp
+}
+
+func toExportFriendships(friendships []entity.Friendship) []exportFriendship {
+	rsp := make([]exportFriendship, 0, len(friendships))
+	for _, friendship := range friendships {
+		rsp = append(rsp, exportFriendship{Id: friendship.ID, SenderId: friendship.SenderID, ReceiverId: friendship.ReceiverID, Status: friendship.Status, CreatedAt: friendship.CreatedAt.Format(time.RFC3339)})
+	}
+	return rsp
+}
+
+// toExportMedia lists the URLs of uploaded images, the files themselves stay on the CDN
+func toExportMedia(user *entity.User, posts []entity.Post, comments []entity.Comment) []exportMedia {
+	rsp := make([]exportMedia, 0)
+	if user.ProfilePhoto != "" {
+		rsp = append(rsp, exportMedia{Source: "profile_photo", SourceId: user.ID, URL: user.ProfilePhoto})
+	}
+	if user.CoverPhoto != "" {
+		rsp = append(rsp, exportMedia{Source: "cover_photo", SourceId: user.ID, URL: user.CoverPhoto})
+	}
+	for _, post := range posts {
+		if post.Image != "" {
+			rsp = append(rsp, exportMedia{Source: "post", SourceId: post.ID, URL: post.Image})
+		}
+	}
+	for _, comment := range comments {
+		if comment.Image != "" {
+			rsp = append(rsp, exportMedia{Source: "comment", SourceId: comment.ID, URL: comment.Image})
+		}
+	}
+	return rsp
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
@@ -0,0 +1,214 @@
+package account
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/mail"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// deletionRepository keeps one user in memory and records which policy the account is deleted with
+type deletionRepository struct {
+	IAccountRepository
+	user    entity.User
+	deleted []entity.DeletionPolicyEnum
+}
+
+func (r *deletionRepository) GetUserByID(userID uint) (*entity.User, error) {
+	copied := r.user
+	return &copied, nil
+}
+
+func (r *deletionRepository) ScheduleDeletion(userID uint, dueAt time.Time) error {
+	r.user.DeletionDueAt = &dueAt
+	return nil
+}
+
+func (r *deletionRepository) CancelDeletion(userID uint) error {
+	r.user.DeletionDueAt = nil
+	return nil
+}
+
+func (r *deletionRepository) ListDueDeletions(now time.Time, limit int) ([]entity.User, error) {
+	if r.user.DeletionDueAt == nil || r.user.DeletionDueAt.After(now) {
+		return nil, nil
+	}
+	return []entity.User{r.user}, nil
+}
+
+func (r *deletionRepository) ListDataExportsByUserID(userID uint) ([]entity.DataExport, error) {
+	return nil, nil
+}
+
+func (r *deletionRepository) DeleteAccount(userID uint, policy entity.DeletionPolicyEnum, scrambledPassword string) error {
+	r.deleted = append(r.deleted, policy)
+	return nil
+}
+
+// passGracePeriod moves the scheduled deletion into the past as if the grace period was over
+func (r *deletionRepository) passGracePeriod() {
+	dueAt := time.Now().Add(-time.Minute)
+	r.user.DeletionDueAt = &dueAt
+}
+
+type discardMailer struct{}
+
+func (discardMailer) Send(message mail.Message) error {
+	return nil
+}
+
+func newDeletionService(t *testing.T, policy string) (*accountService, *deletionRepository) {
+	t.Helper()
+
+	password, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := &deletionRepository{user: entity.User{Model: gorm.Model{ID: 1}, Password: string(password)}}
+	s := NewAccountService(repository, discardMailer{}, nil, zap.NewNop().Sugar(), config.Config{AccountDeletionDays: 30, AccountDeletionPolicy: policy})
+	return s.(*accountService), repository
+}
+
+func TestDeleteDueAccountsFollowsPolicy(t *testing.T) {
+	for policy, expected := range map[string]entity.DeletionPolicyEnum{
+		"delete":    entity.DeletionPolicyDelete,
+		"anonymize": entity.DeletionPolicyAnonymize,
+		"unknown":   entity.DeletionPolicyDelete,
+	} {
+		s, repository := newDeletionService(t, policy)
+		rsp, err := s.RequestDeletion(1, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rsp.Policy != expected {
+			t.Fatalf("%s: user is told the policy is %s", policy, rsp.Policy)
+		}
+
+		if err = s.deleteDueAccounts(); err != nil {
+			t.Fatal(err)
+		}
+		if len(repository.deleted) != 0 {
+			t.Fatalf("%s: account is deleted within the grace period", policy)
+		}
+
+		repository.passGracePeriod()
+		if err = s.deleteDueAccounts(); err != nil {
+			t.Fatal(err)
+		}
+		if len(repository.deleted) != 1 || repository.deleted[0] != expected {
+			t.Fatalf("%s: expected deletion with %s, got %v", policy, expected, repository.deleted)
+		}
+	}
+}
+
+func TestCancelDeletionWithinGracePeriod(t *testing.T) {
+	s, repository := newDeletionService(t, "delete")
+	if _, err := s.RequestDeletion(1, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CancelDeletion(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CancelDeletion(1); !errors.Is(err, ErrDeletionNotScheduled) {
+		t.Fatalf("expected deletion not scheduled, got %v", err)
+	}
+
+	if err := s.deleteDueAccounts(); err != nil {
+		t.Fatal(err)
+	}
+	if len(repository.deleted) != 0 {
+		t.Fatal("cancelled account is deleted")
+	}
+}
+
+func TestRequestDeletionAgainKeepsDueDate(t *testing.T) {
+	s, repository := newDeletionService(t, "delete")
+	if _, err := s.RequestDeletion(1, "wrong"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("expected invalid password, got %v", err)
+	}
+
+	first, err := s.RequestDeletion(1, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dueAt := *repository.user.DeletionDueAt
+
+	second, err := s.RequestDeletion(1, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.DeletionDueAt != first.DeletionDueAt || !repository.user.DeletionDueAt.Equal(dueAt) {
+		t.Fatalf("asking again moves the deletion from %s to %s", first.DeletionDueAt, second.DeletionDueAt)
+	}
+}
+
+// deletedTables runs DeleteAccount against a database which accepts every statement and returns the tables it deletes
+// rows from
+func deletedTables(t *testing.T, policy entity.DeletionPolicyEnum) map[string]bool {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables := make(map[string]bool)
+	if err = db.Callback().Delete().After("gorm:delete").Register("test:record_table", func(tx *gorm.DB) {
+		if tx.Statement.Unscoped {
+			tables[tx.Statement.Table] = true
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectBegin()
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(".").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+	for i := 0; i < 50; i++ {
+		mock.ExpectExec(".").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectCommit()
+	if err = NewRepository(db, zap.NewNop().Sugar()).DeleteAccount(1, policy, "scrambled"); err != nil {
+		t.Fatal(err)
+	}
+	return tables
+}
+
+func TestDeleteAccountKeepsContentWhenAnonymizing(t *testing.T) {
+	tables := deletedTables(t, entity.DeletionPolicyDelete)
+	for _, table := range []string{"posts", "likes"} {
+		if !tables[table] {
+			t.Fatalf("delete policy keeps %s", table)
+		}
+	}
+
+	tables = deletedTables(t, entity.DeletionPolicyAnonymize)
+	for _, table := range []string{"posts", "comments", "likes"} {
+		if tables[table] {
+			t.Fatalf("anonymize policy deletes %s", table)
+		}
+	}
+	for _, table := range []string{"friendships", "follows", "blocks", "external_identities"} {
+		if !tables[table] {
+			t.Fatalf("anonymize policy keeps %s", table)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package admin
+
+import "github.com/mehmetokdemir/social-media-api/internal/app/entity"
+
+type ReadUserResponse struct {
+	Id              uint            `json:"id" extensions:"x-order=1" example:"1"`
+	Username        string          `json:"username" extensions:"x-order=2" example:"john"`
+	Email           string          `json:"email" extensions:"x-order=3" example:"john@gmail.com"`
+	FirstName       string          `json:"first_name" extensions:"x-order=4" example:"John"`
+	LastName        string          `json:"last_name" extensions:"x-order=5" example:"Doe"`
+	Role            entity.RoleEnum `json:"role" extensions:"x-order=6" example:"user"`
+	CreatedAt       string          `json:"created_at" extensions:"x-order=7" example:"2024-01-22T11:31:40+03:00"`
+	EmailVerifiedAt *string         `json:"email_verified_at" extensions:"x-order=8" example:"2024-01-22T11:31:40+03:00"`
+	SuspendedAt     *string         `json:"suspended_at" extensions:"x-order=9" example:"2024-01-22T11:31:40+03:00"`
+}
+
+type UpdateRoleRequest struct {
+	Role entity.RoleEnum `json:"role" extensions:"x-order=1" example:"moderator" validate:"required" valid:"required~role|invalid"` // One of user, moderator and admin
+}
@@ -0,0 +1,340 @@
+package admin
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/rbac"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
+	"github.com/mehmetokdemir/social-media-api/internal/middleware"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+type HttpHandler struct {
+	adminService      IAdminService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
+}
+
+func NewHttpHandler(guardService guard.IGuardService, adminService IAdminService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, adminService: adminService, logger: logger, signingKeyService: signingKeyService}
+}
+
+func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
+	appGroup := app.Group("/admin").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
+	appGroup.Get("/users", middleware.RequirePermission(rbac.PermissionUsersRead), h.ListUsers)
+	appGroup.Post("/users/:user_id/suspend", middleware.RequirePermission(rbac.PermissionUsersSuspend), h.SuspendUser)
+	appGroup.Post("/users/:user_id/unsuspend", middleware.RequirePermission(rbac.PermissionUsersSuspend), h.UnsuspendUser)
+	appGroup.Put("/users/:user_id/role", middleware.RequirePermission(rbac.PermissionUsersRole), h.UpdateRole)
+	appGroup.Delete("/posts/:post_id", middleware.RequirePermission(rbac.PermissionPostsDeleteAny), h.DeletePost)
+	appGroup.Delete("/comments/:comment_id", middleware.RequirePermission(rbac.PermissionCommentsDeleteAny), h.DeleteComment)
+	appGroup.Get("/lockouts", middleware.RequirePermission(rbac.PermissionLockoutsManage), h.ListLockouts)
+	appGroup.Delete("/lockouts/:lockout_id", middleware.RequirePermission(rbac.PermissionLockoutsManage), h.ClearLockout)
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description List users with their role and status, needs users:read permission
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadUserResponse "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /admin/users [get]
+func (h *HttpHandler) ListUsers(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get users", err.Error(), http.StatusBadRequest))
+	}
+
+	users, nextCursor, err := h.adminService.ListUsers(page)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get users", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, users, nextCursor))
+}
+
+// SuspendUser godoc
+// @Summary Suspend user
+// @Description Suspend user and revoke every session of the user, needs users:suspend permission. Admins can not be managed, moderators only by admins.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user to suspend"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /admin/users/{user_id}/suspend [post]
+func (h *HttpHandler) SuspendUser(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	targetUserID, err := strconv.ParseUint(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse user_id", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	role, _ := ctx.Locals(constants.RoleKey).(string)
+
+	if err = h.adminService.SuspendUser(userID, entity.RoleEnum(role), uint(targetUserID)); err != nil {
+		return h.manageUserError(ctx, "can not suspend user", err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// UnsuspendUser godoc
+// @Summary Unsuspend user
+// @Description Lift suspension of the user, needs users:suspend permission. Admins can not be managed, moderators only by admins.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user to unsuspend"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /admin/users/{user_id}/unsuspend [post]
+func (h *HttpHandler) UnsuspendUser(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	targetUserID, err := strconv.ParseUint(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse user_id", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	role, _ := ctx.Locals(constants.RoleKey).(string)
+
+	if err = h.adminService.UnsuspendUser(userID, entity.RoleEnum(role), uint(targetUserID)); err != nil {
+		return h.manageUserError(ctx, "can not unsuspend user", err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// UpdateRole godoc
+// @Summary Update role of user
+// @Description Update role of the user, needs users:role permission. New role is applied when the user refreshes or logs in again.
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user to update"
+// @Param request body UpdateRoleRequest true "body params"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /admin/users/{user_id}/role [put]
+func (h *HttpHandler) UpdateRole(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	targetUserID, err := strconv.ParseUint(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse user_id", err.Error(), http.StatusBadRequest))
+	}
+
+	var req UpdateRoleRequest
+	if err = ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	role, _ := ctx.Locals(constants.RoleKey).(string)
+
+	if err = h.adminService.UpdateRole(userID, entity.RoleEnum(role), uint(targetUserID), req.Role); err != nil {
+		return h.manageUserError(ctx, "can not update role", err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+func (h *HttpHandler) manageUserError(ctx *fiber.Ctx, message string, err error) error {
+	switch {
+	case errors.Is(err, ErrSelfAction), errors.Is(err, ErrInvalidRole):
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError(message, err.Error(), http.StatusBadRequest))
+	case errors.Is(err, ErrPermissionDenied):
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError(message, err.Error(), http.StatusForbidden))
+	case errors.Is(err, ErrUserNotFound):
+		return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError(message, err.Error(), http.StatusNotFound))
+	}
+	return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError(message, err.Error(), http.StatusInternalServerError))
+}
+
+// DeletePost godoc
+// @Summary Delete any post
+// @Description Delete post with its comments and likes regardless of the owner, needs posts:delete_any permission
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param post_id path integer true "ID of the post to delete"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /admin/posts/{post_id} [delete]
+func (h *HttpHandler) DeletePost(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	postID, err := strconv.ParseUint(ctx.Params("post_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse post_id", err.Error(), http.StatusBadRequest))
+	}
+
+	if err = h.adminService.DeletePost(uint(postID)); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not delete post", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// DeleteComment godoc
+// @Summary Delete any comment
+// @Description Delete comment with its sub comments and likes regardless of the owner, needs comments:delete_any permission
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param comment_id path integer true "ID of the comment to delete"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /admin/comments/{comment_id} [delete]
+func (h *HttpHandler) DeleteComment(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	commentID, err := strconv.ParseUint(ctx.Params("comment_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse comment_id", err.Error(), http.StatusBadRequest))
+	}
+
+	if err = h.adminService.DeleteComment(uint(commentID)); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not delete comment", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// ListLockouts godoc
+// @Summary List login lockouts
+// @Description List lockouts raised by failed login attempts for accounts and ips, needs lockouts:manage permission
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param active query boolean false "Only list lockouts which are still in effect"
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []auth.LockoutResponse "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /admin/lockouts [get]
+func (h *HttpHandler) ListLockouts(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get lockouts", err.Error(), http.StatusBadRequest))
+	}
+
+	lockouts, nextCursor, err := h.adminService.ListLockouts(ctx.QueryBool("active", false), page)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get lockouts", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, lockouts, nextCursor))
+}
+
+// ClearLockout godoc
+// @Summary Clear login lockout
+// @Description Lift an active lockout so the account or the ip can try to login again, needs lockouts:manage permission
+// @Tags Admin
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param lockout_id path integer true "ID of the lockout to clear"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 500
+// @Router /admin/lockouts/{lockout_id} [delete]
+func (h *HttpHandler) ClearLockout(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	lockoutID, err := strconv.ParseUint(ctx.Params("lockout_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse lockout_id", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err = h.adminService.ClearLockout(userID, uint(lockoutID)); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not clear lockout", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type IAdminRepository interface {
+	ListUsers(page pagination.Page) ([]entity.User, error)
+	GetUserByID(userID uint) (*entity.User, error)
+	GetUserByEmail(email string) (*entity.User, error)
+	HasAdmin() (bool, error)
+	SuspendUser(userID uint) error
+	UnsuspendUser(userID uint) error
+	UpdateRole(userID uint, role entity.RoleEnum) error
+}
+
+type adminRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewRepository(db *gorm.DB, logger *zap.SugaredLogger) IAdminRepository {
+	return &adminRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *adminRepository) ListUsers(page pagination.Page) ([]entity.User, error) {
+	var users []entity.User
+	if err := r.db.Model(&entity.User{}).Scopes(page.Scope("users")).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *adminRepository) GetUserByID(userID uint) (user *entity.User, err error) {
+	if err = r.db.Model(&entity.User{}).Where("id =?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *adminRepository) GetUserByEmail(email string) (user *entity.User, err error) {
+	if err = r.db.Model(&entity.User{}).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *adminRepository) HasAdmin() (bool, error) {
+	var count int64
+	if err := r.db.Model(&entity.User{}).Where("role = ?", entity.RoleAdmin).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SuspendUser marks the user suspended and ends every session of the user
+func (r *adminRepository) SuspendUser(userID uint) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.User{}).Where("id = ?", userID).Update("suspended_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entity.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error
+	})
+}
+
+func (r *adminRepository) UnsuspendUser(userID uint) error {
+	return r.db.Model(&entity.User{}).Where("id = ?", userID).Update("suspended_at", nil).Error
+}
+
+// UpdateRole logs the user out everywhere as well, access tokens carry the permissions of the role they were issued with
+func (r *adminRepository) UpdateRole(userID uint, role entity.RoleEnum) error {
+	now := time.Now()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.User{}).Where("id = ?", userID).Update("role", role).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entity.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error
+	})
+}
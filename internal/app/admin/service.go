@@ -0,0 +1,194 @@
+package admin
+
+import (
+	"errors"
+	"github.com/mehmetokdemir/social-media-api/internal/app/auth"
+	"github.com/mehmetokdemir/social-media-api/internal/app/comment"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/rbac"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/post"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPermissionDenied = errors.New("do not have permission to manage this user")
+	ErrSelfAction       = errors.New("can not manage your own account")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrUserNotFound     = errors.New("user not found")
+)
+
+type IAdminService interface {
+	ListUsers(page pagination.Page) ([]ReadUserResponse, string, error)
+	SuspendUser(actorID uint, actorRole entity.RoleEnum, userID uint) error
+	UnsuspendUser(actorID uint, actorRole entity.RoleEnum, userID uint) error
+	UpdateRole(actorID uint, actorRole entity.RoleEnum, userID uint, role entity.RoleEnum) error
+	BootstrapAdmin() error
+	DeletePost(postID uint) error
+	DeleteComment(commentID uint) error
+	ListLockouts(activeOnly bool, page pagination.Page) ([]auth.LockoutResponse, string, error)
+	ClearLockout(actorID, lockoutID uint) error
+}
+
+type adminService struct {
+	config         config.Config
+	logger         *zap.SugaredLogger
+	repository     IAdminRepository
+	authService    auth.IAuthService
+	postService    post.IPostService
+	commentService comment.ICommentService
+}
+
+func NewAdminService(repository IAdminRepository, authService auth.IAuthService, postService post.IPostService, commentService comment.ICommentService, logger *zap.SugaredLogger, config config.Config) IAdminService {
+	if repository == nil {
+		return nil
+	}
+
+	return &adminService{
+		config:         config,
+		logger:         logger,
+		repository:     repository,
+		authService:    authService,
+		postService:    postService,
+		commentService: commentService,
+	}
+}
+
+func (s *adminService) ListUsers(page pagination.Page) ([]ReadUserResponse, string, error) {
+	users, err := s.repository.ListUsers(page)
+	if err != nil {
+		return nil, "", err
+	}
+	users, nextCursor := pagination.Next(users, page, func(user entity.User) (time.Time, uint) { return user.CreatedAt, user.ID })
+
+	var rsp []ReadUserResponse
+	for _, user := range users {
+		rsp = append(rsp, ReadUserResponse{
+			Id:              user.ID,
+			Username:        user.Username,
+			Email:           user.Email,
+			FirstName:       user.FirstName,
+			LastName:        user.LastName,
+			Role:            user.Role,
+			CreatedAt:       user.CreatedAt.Format(time.RFC3339),
+			EmailVerifiedAt: formatTime(user.EmailVerifiedAt),
+			SuspendedAt:     formatTime(user.SuspendedAt),
+		})
+	}
+
+	return rsp, nextCursor, nil
+}
+
+func (s *adminService) SuspendUser(actorID uint, actorRole entity.RoleEnum, userID uint) error {
+	userByID, err := s.manageableUser(actorID, actorRole, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.repository.SuspendUser(userByID.ID)
+}
+
+func (s *adminService) UnsuspendUser(actorID uint, actorRole entity.RoleEnum, userID uint) error {
+	userByID, err := s.manageableUser(actorID, actorRole, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.repository.UnsuspendUser(userByID.ID)
+}
+
+func (s *adminService) UpdateRole(actorID uint, actorRole entity.RoleEnum, userID uint, role entity.RoleEnum) error {
+	if !rbac.IsValidRole(role) {
+		return ErrInvalidRole
+	}
+
+	userByID, err := s.manageableUser(actorID, actorRole, userID)
+	if err != nil {
+		return err
+	}
+
+	// Only admins can make someone admin
+	if role == entity.RoleAdmin && actorRole != entity.RoleAdmin {
+		return ErrPermissionDenied
+	}
+
+	return s.repository.UpdateRole(userByID.ID, role)
+}
+
+// manageableUser returns the user if the actor is allowed to manage them. Nobody manages their own account, admins
+// can not be managed and moderators only by admins.
+func (s *adminService) manageableUser(actorID uint, actorRole entity.RoleEnum, userID uint) (*entity.User, error) {
+	if actorID == userID {
+		return nil, ErrSelfAction
+	}
+
+	userByID, err := s.repository.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if userByID.Role == entity.RoleAdmin || (userByID.Role == entity.RoleModerator && actorRole != entity.RoleAdmin) {
+		return nil, ErrPermissionDenied
+	}
+	return userByID, nil
+}
+
+// BootstrapAdmin makes the user with BOOTSTRAP_ADMIN_EMAIL admin while there is no admin yet, so that the first admin
+// does not have to be set in the database by hand. Once an admin exists the setting has no effect.
+func (s *adminService) BootstrapAdmin() error {
+	email := strings.TrimSpace(s.config.BootstrapAdminEmail)
+	if email == "" {
+		return nil
+	}
+
+	hasAdmin, err := s.repository.HasAdmin()
+	if err != nil || hasAdmin {
+		return err
+	}
+
+	userByEmail, err := s.repository.GetUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Warnf("can not bootstrap admin, there is no user with email %s", email)
+			return nil
+		}
+		return err
+	}
+
+	if err = s.repository.UpdateRole(userByEmail.ID, entity.RoleAdmin); err != nil {
+		return err
+	}
+	s.logger.Infof("user %d is made admin by bootstrap", userByEmail.ID)
+	return nil
+}
+
+func (s *adminService) DeletePost(postID uint) error {
+	return s.postService.ForceDeletePostById(postID)
+}
+
+func (s *adminService) DeleteComment(commentID uint) error {
+	return s.commentService.ForceDeleteCommentById(commentID)
+}
+
+func (s *adminService) ListLockouts(activeOnly bool, page pagination.Page) ([]auth.LockoutResponse, string, error) {
+	return s.authService.ListLockouts(activeOnly, page)
+}
+
+func (s *adminService) ClearLockout(actorID, lockoutID uint) error {
+	return s.authService.ClearLockout(actorID, lockoutID)
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
@@ -0,0 +1,24 @@
+package apikey
+
+import "github.com/mehmetokdemir/social-media-api/internal/app/entity"
+
+type CreateRequest struct {
+	Name      string                   `json:"name" extensions:"x-order=1" example:"deploy-bot" validate:"required" valid:"required~name|invalid"`          // Name to tell the key apart
+	Scopes    []entity.ApiKeyScopeEnum `json:"scopes" extensions:"x-order=2" example:"read,post:write" validate:"required" valid:"required~scopes|invalid"` // Any of read, post:write, comment:write, like:write, friendship:write
+	ExpiresAt *string                  `json:"expires_at" extensions:"x-order=3" example:"2025-01-22T11:31:40+03:00" validate:"-"`                          // Optional RFC3339 time the key stops working at
+}
+
+type CreateResponse struct {
+	Id  uint   `json:"id" extensions:"x-order=1" example:"1"`
+	Key string `json:"key" extensions:"x-order=2" example:"sma_9f86d081884c7d659a2feaa0c55ad015"` // Send in X-Api-Key header, shown only once
+}
+
+type ReadApiKeyResponse struct {
+	Id         uint                     `json:"id" extensions:"x-order=1" example:"1"`
+	Name       string                   `json:"name" extensions:"x-order=2" example:"deploy-bot"`
+	Prefix     string                   `json:"prefix" extensions:"x-order=3" example:"sma_9f86d08"` // First characters of the key
+	Scopes     []entity.ApiKeyScopeEnum `json:"scopes" extensions:"x-order=4" example:"read,post:write"`
+	CreatedAt  string                   `json:"created_at" extensions:"x-order=5" example:"2024-01-22T11:31:40+03:00"`
+	ExpiresAt  *string                  `json:"expires_at" extensions:"x-order=6" example:"2025-01-22T11:31:40+03:00"`
+	LastUsedAt *string                  `json:"last_used_at" extensions:"x-order=7" example:"2024-01-23T08:00:00+03:00"`
+}
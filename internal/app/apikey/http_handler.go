@@ -0,0 +1,141 @@
+package apikey
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
+	"github.com/mehmetokdemir/social-media-api/internal/middleware"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+type HttpHandler struct {
+	apiKeyService     IApiKeyService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
+}
+
+func NewHttpHandler(guardService guard.IGuardService, apiKeyService IApiKeyService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, apiKeyService: apiKeyService, logger: logger, signingKeyService: signingKeyService}
+}
+
+func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
+	appGroup := app.Group("/api-keys").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
+	appGroup.Post("", h.Create)
+	appGroup.Get("", h.List)
+	appGroup.Delete("/:api_key_id", h.Revoke)
+}
+
+// Create godoc
+// @Summary Create API key
+// @Description Create a named API key with the given scopes to send in X-Api-Key header instead of X-Auth-Token.
+// @Description The key is shown only in this response. API keys can not manage API keys, sessions or admin resources.
+// @Tags ApiKey
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param request body CreateRequest true "body params"
+// @Success 200 {object} CreateResponse
+// @Failure 400
+// @Failure 500
+// @Router /api-keys [post]
+func (h *HttpHandler) Create(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	var req CreateRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	rsp, err := h.apiKeyService.CreateApiKey(userID, req)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not create api key", err.Error(), http.StatusBadRequest))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// List godoc
+// @Summary List API keys
+// @Description List API keys of the user which are neither revoked nor expired
+// @Tags ApiKey
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadApiKeyResponse "Success"
+// @Failure 400
+// @Failure 500
+// @Router /api-keys [get]
+func (h *HttpHandler) List(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get api keys", err.Error(), http.StatusBadRequest))
+	}
+
+	apiKeys, nextCursor, err := h.apiKeyService.ListApiKeys(userID, page)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get api keys", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, apiKeys, nextCursor))
+}
+
+// Revoke godoc
+// @Summary Revoke API key
+// @Description Revoke an API key of the user, requests with the key are rejected right away
+// @Tags ApiKey
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param api_key_id path integer true "ID of the api key to revoke"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /api-keys/{api_key_id} [delete]
+func (h *HttpHandler) Revoke(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	apiKeyID, err := strconv.ParseUint(ctx.Params("api_key_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse api_key_id", err.Error(), http.StatusBadRequest))
+	}
+
+	if err = h.apiKeyService.RevokeApiKey(userID, uint(apiKeyID)); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not revoke api key", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
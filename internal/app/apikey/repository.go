@@ -0,0 +1,73 @@
+package apikey
+
+import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type IApiKeyRepository interface {
+	Create(apiKey entity.ApiKey) (*entity.ApiKey, error)
+	Get(id uint) (*entity.ApiKey, error)
+	ListActiveByUserID(userID uint, page pagination.Page) ([]entity.ApiKey, error)
+	CountActiveByUserID(userID uint) (int64, error)
+	Revoke(id uint) error
+	Migration() error
+}
+
+type apiKeyRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewRepository(db *gorm.DB, logger *zap.SugaredLogger) IApiKeyRepository {
+	return &apiKeyRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *apiKeyRepository) Create(apiKey entity.ApiKey) (*entity.ApiKey, error) {
+	if err := r.db.Create(&apiKey).Error; err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func (r *apiKeyRepository) Get(id uint) (*entity.ApiKey, error) {
+	var apiKey entity.ApiKey
+	if err := r.db.Where("id = ?", id).First(&apiKey).Error; err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func (r *apiKeyRepository) ListActiveByUserID(userID uint, page pagination.Page) ([]entity.ApiKey, error) {
+	var apiKeys []entity.ApiKey
+	if err := r.active(userID).Scopes(page.Scope("api_keys")).Find(&apiKeys).Error; err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+func (r *apiKeyRepository) CountActiveByUserID(userID uint) (int64, error) {
+	var count int64
+	err := r.active(userID).Count(&count).Error
+	return count, err
+}
+
+func (r *apiKeyRepository) Revoke(id uint) error {
+	return r.db.Model(&entity.ApiKey{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now()).Error
+}
+
+func (r *apiKeyRepository) active(userID uint) *gorm.DB {
+	return r.db.Model(&entity.ApiKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now())
+}
+
+func (r *apiKeyRepository) Migration() error {
+	return r.db.AutoMigrate(entity.ApiKey{})
+}
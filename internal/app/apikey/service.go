@@ -0,0 +1,172 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const (
+	keyPrefix       = "sma_"
+	keyByteSize     = 32
+	displayedLength = 12
+	maxActiveKeys   = 20
+)
+
+var validScopes = map[entity.ApiKeyScopeEnum]bool{
+	entity.ApiKeyScopeRead:            true,
+	entity.ApiKeyScopePostWrite:       true,
+	entity.ApiKeyScopeCommentWrite:    true,
+	entity.ApiKeyScopeLikeWrite:       true,
+	entity.ApiKeyScopeFriendshipWrite: true,
+}
+
+type IApiKeyService interface {
+	CreateApiKey(userID uint, req CreateRequest) (*CreateResponse, error)
+	ListApiKeys(userID uint, page pagination.Page) ([]ReadApiKeyResponse, string, error)
+	RevokeApiKey(userID, apiKeyID uint) error
+}
+
+type apiKeyService struct {
+	config     config.Config
+	logger     *zap.SugaredLogger
+	repository IApiKeyRepository
+}
+
+func NewApiKeyService(repository IApiKeyRepository, logger *zap.SugaredLogger, config config.Config) IApiKeyService {
+	if repository == nil {
+		return nil
+	}
+
+	return &apiKeyService{
+		config:     config,
+		logger:     logger,
+		repository: repository,
+	}
+}
+
+func (s *apiKeyService) CreateApiKey(userID uint, req CreateRequest) (*CreateResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	if len(req.Scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	seen := make(map[entity.ApiKeyScopeEnum]bool)
+	for _, scope := range req.Scopes {
+		if !validScopes[scope] {
+			return nil, errors.New("invalid scope " + string(scope))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, string(scope))
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil && *req.ExpiresAt != "" {
+		parsed, err := time.Parse(time.RFC3339, *req.ExpiresAt)
+		if err != nil {
+			return nil, errors.New("expires_at must be an RFC3339 time")
+		}
+		if !parsed.After(time.Now()) {
+			return nil, errors.New("expires_at must be in the future")
+		}
+		expiresAt = &parsed
+	}
+
+	count, err := s.repository.CountActiveByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxActiveKeys {
+		return nil, errors.New("too many api keys, revoke an unused one first")
+	}
+
+	key, err := s.generateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, err := s.repository.Create(entity.ApiKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:displayedLength],
+		KeyHash:   guard.HashApiKey(key),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateResponse{Id: apiKey.ID, Key: key}, nil
+}
+
+func (s *apiKeyService) ListApiKeys(userID uint, page pagination.Page) ([]ReadApiKeyResponse, string, error) {
+	apiKeys, err := s.repository.ListActiveByUserID(userID, page)
+	if err != nil {
+		return nil, "", err
+	}
+	apiKeys, nextCursor := pagination.Next(apiKeys, page, func(apiKey entity.ApiKey) (time.Time, uint) { return apiKey.CreatedAt, apiKey.ID })
+
+	var rsp []ReadApiKeyResponse
+	for _, apiKey := range apiKeys {
+		var scopes []entity.ApiKeyScopeEnum
+		for _, scope := range strings.Split(apiKey.Scopes, ",") {
+			scopes = append(scopes, entity.ApiKeyScopeEnum(scope))
+		}
+
+		rsp = append(rsp, ReadApiKeyResponse{
+			Id:         apiKey.ID,
+			Name:       apiKey.Name,
+			Prefix:     apiKey.Prefix,
+			Scopes:     scopes,
+			CreatedAt:  apiKey.CreatedAt.Format(time.RFC3339),
+			ExpiresAt:  formatTime(apiKey.ExpiresAt),
+			LastUsedAt: formatTime(apiKey.LastUsedAt),
+		})
+	}
+
+	return rsp, nextCursor, nil
+}
+
+func (s *apiKeyService) RevokeApiKey(userID, apiKeyID uint) error {
+	apiKey, err := s.repository.Get(apiKeyID)
+	if err != nil {
+		return err
+	}
+
+	if apiKey.UserID != userID {
+		return errors.New("do not have permission to revoke this api key")
+	}
+
+	return s.repository.Revoke(apiKey.ID)
+}
+
+func (s *apiKeyService) generateKey() (string, error) {
+	b := make([]byte, keyByteSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return keyPrefix + hex.EncodeToString(b), nil
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
@@ -1,40 +1,60 @@
 package auth
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
 	"github.com/mehmetokdemir/social-media-api/internal/middleware"
 	"go.uber.org/zap"
+	"math"
 	"net/http"
+	"strconv"
 )
 
 type HttpHandler struct {
-	authService   IAuthService
-	logger        *zap.SugaredLogger
-	jwtPrivateKey string
-	guardService  guard.IGuardService
+	authService       IAuthService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
 }
 
-func NewHttpHandler(guardService guard.IGuardService, authService IAuthService, logger *zap.SugaredLogger, jwtPrivateKey string) *HttpHandler {
-	return &HttpHandler{guardService: guardService, authService: authService, logger: logger, jwtPrivateKey: jwtPrivateKey}
+func NewHttpHandler(guardService guard.IGuardService, authService IAuthService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, authService: authService, logger: logger, signingKeyService: signingKeyService}
 }
 
 func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
-	appGroup := app.Group("/auth").Use(middleware.AuthMiddleware(h.jwtPrivateKey))
+	appGroup := app.Group("/auth").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
 	appGroup.Post("/login", h.Login)
+	appGroup.Post("/login/mfa", h.LoginMfa)
+	appGroup.Post("/refresh", h.Refresh)
 	appGroup.Post("/logout", h.Logout)
+	appGroup.Post("/logout/all", h.LogoutAll)
+	appGroup.Get("/sessions", h.ListSessions)
+	appGroup.Delete("/sessions/:session_id", h.RevokeSession)
+	appGroup.Post("/mfa/enroll", h.EnrollMfa)
+	appGroup.Post("/mfa/confirm", h.ConfirmMfa)
+	appGroup.Post("/mfa/disable", h.DisableMfa)
 }
 
 // Login godoc
 // @Summary Login user
-// @Description Create token with given credentials
+// @Description Create token with given credentials. If two-factor authentication is enabled for the user, response has mfa_required
+// @Description and an mfa_token to complete the login at /auth/login/mfa instead of the tokens.
+// @Description Failed attempts are counted per account and per ip; every failure doubles the wait before the next attempt and
+// @Description reaching the limit locks the account or the ip out for a while. Throttled attempts get 429 with a Retry-After header.
 // @Tags Auth
 // @Accept  json
 // @Produce  json
 // @Param request body LoginRequest true "body params"
 // @Success 200 {object} LoginResponse
 // @Failure 400
+// @Failure 401
+// @Failure 403
+// @Failure 429
 // @Failure 500
 // @Router /auth/login [post]
 func (h *HttpHandler) Login(ctx *fiber.Ctx) error {
@@ -43,14 +63,110 @@ func (h *HttpHandler) Login(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
 	}
 
-	rsp, err := h.authService.CreateToken(req.Username, req.Password)
+	rsp, err := h.authService.CreateToken(req.Username, req.Password, DeviceInfo{
+		DeviceName: req.DeviceName,
+		UserAgent:  ctx.Get(fiber.HeaderUserAgent),
+		IP:         ctx.IP(),
+	})
 	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusUnauthorized))
+		}
+		if errors.Is(err, ErrTooManyLoginAttempts) {
+			return h.tooManyLoginAttempts(ctx, err)
+		}
+		if errors.Is(err, ErrSuspendedUser) || errors.Is(err, ErrDeactivatedUser) {
+			return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusForbidden))
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusInternalServerError))
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
 }
 
+func (h *HttpHandler) tooManyLoginAttempts(ctx *fiber.Ctx, err error) error {
+	var throttledErr *LoginThrottledError
+	if errors.As(err, &throttledErr) {
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(throttledErr.RetryAfter.Seconds()))))
+	}
+	return ctx.Status(fiber.StatusTooManyRequests).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusTooManyRequests))
+}
+
+// LoginMfa godoc
+// @Summary Complete login with two-factor code
+// @Description Exchange the mfa_token of login response and an authenticator or recovery code for access and refresh tokens
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param request body MfaLoginRequest true "body params"
+// @Success 200 {object} LoginResponse
+// @Failure 400
+// @Failure 401
+// @Failure 403
+// @Failure 429
+// @Failure 500
+// @Router /auth/login/mfa [post]
+func (h *HttpHandler) LoginMfa(ctx *fiber.Ctx) error {
+	var req MfaLoginRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	rsp, err := h.authService.CompleteMfaLogin(req.MfaToken, req.Code, DeviceInfo{
+		DeviceName: req.DeviceName,
+		UserAgent:  ctx.Get(fiber.HeaderUserAgent),
+		IP:         ctx.IP(),
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidMfaToken) || errors.Is(err, ErrInvalidMfaCode) {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusUnauthorized))
+		}
+		if errors.Is(err, ErrTooManyLoginAttempts) {
+			return h.tooManyLoginAttempts(ctx, err)
+		}
+		if errors.Is(err, ErrSuspendedUser) || errors.Is(err, ErrDeactivatedUser) {
+			return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusForbidden))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// Refresh godoc
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access token and a new refresh token. The given refresh token can not be used again;
+// @Description presenting an already rotated refresh token revokes every token of its family.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param request body RefreshRequest true "body params"
+// @Success 200 {object} LoginResponse
+// @Failure 400
+// @Failure 401
+// @Failure 500
+// @Router /auth/refresh [post]
+func (h *HttpHandler) Refresh(ctx *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	if req.RefreshToken == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("refresh token is required", "refresh token is required", http.StatusBadRequest))
+	}
+
+	rsp, err := h.authService.RefreshToken(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(httpresponse.NewError("can not refresh token", err.Error(), http.StatusUnauthorized))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not refresh token", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
 // Logout godoc
 // @Summary Logout user
 // @Description Delete session with given access token.
@@ -68,9 +184,229 @@ func (h *HttpHandler) Logout(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
 	}
 
-	if err := h.authService.DeleteToken(token); err != nil {
+	sessionID, exists := ctx.Locals(constants.SessionIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get session from context", "can not get session from context", http.StatusBadRequest))
+	}
+
+	if err := h.authService.DeleteToken(token, sessionID); err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not add tokens to black list", err.Error(), http.StatusBadRequest))
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
 }
+
+// LogoutAll godoc
+// @Summary Logout from every device
+// @Description Revoke every active session of the logged-in user, including the current one.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /auth/logout/all [post]
+func (h *HttpHandler) LogoutAll(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err := h.authService.RevokeAllSessions(userID); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not revoke sessions", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List active sessions of the logged-in user with their devices.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []SessionResponse "Success"
+// @Failure 400
+// @Failure 500
+// @Router /auth/sessions [get]
+func (h *HttpHandler) ListSessions(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	sessionID, _ := ctx.Locals(constants.SessionIdKey).(uint)
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get sessions", err.Error(), http.StatusBadRequest))
+	}
+
+	sessions, nextCursor, err := h.authService.ListSessions(userID, sessionID, page)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get sessions", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, sessions, nextCursor))
+}
+
+// RevokeSession godoc
+// @Summary Revoke session
+// @Description Revoke one of the sessions of the logged-in user. Access and refresh tokens of the session stop working immediately.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param session_id path integer true "ID of the session to revoke"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /auth/sessions/{session_id} [delete]
+func (h *HttpHandler) RevokeSession(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	sessionIDStr := ctx.Params("session_id")
+	if sessionIDStr == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get session_id on params", "can not get session_id on params", http.StatusBadRequest))
+	}
+
+	sessionID, err := strconv.ParseUint(sessionIDStr, 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse session_id", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err = h.authService.RevokeSession(userID, uint(sessionID)); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not revoke session", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// EnrollMfa godoc
+// @Summary Start two-factor enrollment
+// @Description Create a new TOTP secret for the logged-in user. It is not enabled until a code is confirmed at /auth/mfa/confirm.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Success 200 {object} MfaEnrollResponse
+// @Failure 400
+// @Failure 500
+// @Router /auth/mfa/enroll [post]
+func (h *HttpHandler) EnrollMfa(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	rsp, err := h.authService.EnrollTotp(userID)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not enroll two-factor authentication", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// ConfirmMfa godoc
+// @Summary Confirm two-factor enrollment
+// @Description Enable two-factor authentication with the first code of the authenticator. Recovery codes are returned only once.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param request body MfaCodeRequest true "body params"
+// @Success 200 {object} MfaRecoveryCodesResponse
+// @Failure 400
+// @Failure 500
+// @Router /auth/mfa/confirm [post]
+func (h *HttpHandler) ConfirmMfa(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	var req MfaCodeRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	rsp, err := h.authService.ConfirmTotp(userID, req.Code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidMfaCode) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not confirm two-factor authentication", err.Error(), http.StatusBadRequest))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not confirm two-factor authentication", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// DisableMfa godoc
+// @Summary Disable two-factor authentication
+// @Description Disable two-factor authentication with an authenticator or recovery code, recovery codes are deleted.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param request body MfaCodeRequest true "body params"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /auth/mfa/disable [post]
+func (h *HttpHandler) DisableMfa(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	var req MfaCodeRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err := h.authService.DisableTotp(userID, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidMfaCode) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not disable two-factor authentication", err.Error(), http.StatusBadRequest))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not disable two-factor authentication", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
 type IBlackListRepository interface {
@@ -30,8 +33,9 @@ func (r *blackListRepository) FindAll() ([]*entity.BlackList, error) {
 	return blacklist, err
 }
 
+// CreateTokenToBlackList does nothing when the token is already blacklisted
 func (r *blackListRepository) CreateTokenToBlackList(blackList entity.BlackList) error {
-	if err := r.db.Create(&blackList).Error; err != nil {
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&blackList).Error; err != nil {
 		return err
 	}
 	return nil
@@ -46,3 +50,334 @@ func (r *blackListRepository) CheckTokenInBlacklist(token string) bool {
 func (r *blackListRepository) Migration() error {
 	return r.db.AutoMigrate(entity.BlackList{})
 }
+
+type IRefreshTokenRepository interface {
+	CreateRefreshToken(refreshToken entity.RefreshToken) (*entity.RefreshToken, error)
+	GetRefreshTokenByHash(tokenHash string) (*entity.RefreshToken, error)
+	GetRefreshTokenByAccessToken(accessToken string) (*entity.RefreshToken, error)
+	MarkRefreshTokenRotated(id uint) (bool, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeRefreshTokensBySessionID(sessionID uint) error
+	RevokeRefreshTokensByUserID(userID uint) error
+	ListRefreshTokensByFamily(familyID string) ([]entity.RefreshToken, error)
+	Migration() error
+}
+
+type refreshTokenRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewRefreshTokenRepository(db *gorm.DB, logger *zap.SugaredLogger) IRefreshTokenRepository {
+	return &refreshTokenRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *refreshTokenRepository) CreateRefreshToken(refreshToken entity.RefreshToken) (*entity.RefreshToken, error) {
+	if err := r.db.Create(&refreshToken).Error; err != nil {
+		return nil, err
+	}
+	return &refreshToken, nil
+}
+
+func (r *refreshTokenRepository) GetRefreshTokenByHash(tokenHash string) (refreshToken *entity.RefreshToken, err error) {
+	if err = r.db.Model(&entity.RefreshToken{}).Where("token_hash = ?", tokenHash).First(&refreshToken).Error; err != nil {
+		return nil, err
+	}
+	return refreshToken, nil
+}
+
+func (r *refreshTokenRepository) GetRefreshTokenByAccessToken(accessToken string) (refreshToken *entity.RefreshToken, err error) {
+	if err = r.db.Model(&entity.RefreshToken{}).Where("access_token = ?", accessToken).First(&refreshToken).Error; err != nil {
+		return nil, err
+	}
+	return refreshToken, nil
+}
+
+// MarkRefreshTokenRotated flags the token as used. It returns false when the token had already been rotated,
+// so two concurrent refreshes with the same token can not both succeed.
+func (r *refreshTokenRepository) MarkRefreshTokenRotated(id uint) (bool, error) {
+	result := r.db.Model(&entity.RefreshToken{}).Where("id = ? AND rotated_at IS NULL", id).Update("rotated_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *refreshTokenRepository) RevokeRefreshTokenFamily(familyID string) error {
+	return r.db.Model(&entity.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", time.Now()).Error
+}
+
+func (r *refreshTokenRepository) RevokeRefreshTokensBySessionID(sessionID uint) error {
+	return r.db.Model(&entity.RefreshToken{}).Where("session_id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", time.Now()).Error
+}
+
+func (r *refreshTokenRepository) RevokeRefreshTokensByUserID(userID uint) error {
+	return r.db.Model(&entity.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now()).Error
+}
+
+func (r *refreshTokenRepository) ListRefreshTokensByFamily(familyID string) ([]entity.RefreshToken, error) {
+	var refreshTokens []entity.RefreshToken
+	if err := r.db.Model(&entity.RefreshToken{}).Where("family_id = ?", familyID).Find(&refreshTokens).Error; err != nil {
+		return nil, err
+	}
+	return refreshTokens, nil
+}
+
+func (r *refreshTokenRepository) Migration() error {
+	return r.db.AutoMigrate(entity.RefreshToken{})
+}
+
+type ISessionRepository interface {
+	CreateSession(session entity.Session) (*entity.Session, error)
+	GetSession(id uint) (*entity.Session, error)
+	ListActiveSessionsByUserID(userID uint, page pagination.Page) ([]entity.Session, error)
+	TouchSession(id uint) error
+	RevokeSession(id uint) error
+	RevokeSessionsByUserID(userID uint) error
+	Migration() error
+}
+
+type sessionRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewSessionRepository(db *gorm.DB, logger *zap.SugaredLogger) ISessionRepository {
+	return &sessionRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *sessionRepository) CreateSession(session entity.Session) (*entity.Session, error) {
+	if err := r.db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) GetSession(id uint) (session *entity.Session, err error) {
+	if err = r.db.Model(&entity.Session{}).Where("id = ?", id).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListActiveSessionsByUserID pages the sessions by creation time, last_seen_at changes on every refresh and would move
+// sessions between pages
+func (r *sessionRepository) ListActiveSessionsByUserID(userID uint, page pagination.Page) ([]entity.Session, error) {
+	var sessions []entity.Session
+	if err := r.db.Model(&entity.Session{}).Scopes(page.Scope("sessions")).Where("user_id = ? AND revoked_at IS NULL", userID).Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *sessionRepository) TouchSession(id uint) error {
+	return r.db.Model(&entity.Session{}).Where("id = ?", id).Update("last_seen_at", time.Now()).Error
+}
+
+func (r *sessionRepository) RevokeSession(id uint) error {
+	return r.db.Model(&entity.Session{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now()).Error
+}
+
+func (r *sessionRepository) RevokeSessionsByUserID(userID uint) error {
+	return r.db.Model(&entity.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now()).Error
+}
+
+func (r *sessionRepository) Migration() error {
+	return r.db.AutoMigrate(entity.Session{})
+}
+
+type IMfaRepository interface {
+	SetTotpSecret(userID uint, secret string) error
+	EnableTotp(userID uint, step int64) error
+	DisableTotp(userID uint) error
+	UpdateTotpLastStep(userID uint, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+	Migration() error
+}
+
+type mfaRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewMfaRepository(db *gorm.DB, logger *zap.SugaredLogger) IMfaRepository {
+	return &mfaRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// SetTotpSecret stores a new secret which is not enabled until the first code is confirmed
+func (r *mfaRepository) SetTotpSecret(userID uint, secret string) error {
+	return r.db.Model(&entity.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":     secret,
+		"totp_enabled_at": nil,
+		"totp_last_step":  0,
+	}).Error
+}
+
+func (r *mfaRepository) EnableTotp(userID uint, step int64) error {
+	return r.db.Model(&entity.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_enabled_at": time.Now(),
+		"totp_last_step":  step,
+	}).Error
+}
+
+func (r *mfaRepository) DisableTotp(userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error
+	})
+}
+
+// UpdateTotpLastStep returns false when the step or a later one was already used
+func (r *mfaRepository) UpdateTotpLastStep(userID uint, step int64) (bool, error) {
+	result := r.db.Model(&entity.User{}).Where("id = ? AND totp_last_step < ?", userID, step).Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *mfaRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		recoveryCodes := make([]entity.RecoveryCode, 0, len(codeHashes))
+		for _, codeHash := range codeHashes {
+			recoveryCodes = append(recoveryCodes, entity.RecoveryCode{UserID: userID, CodeHash: codeHash})
+		}
+		return tx.Create(&recoveryCodes).Error
+	})
+}
+
+func (r *mfaRepository) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	result := r.db.Model(&entity.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *mfaRepository) Migration() error {
+	return r.db.AutoMigrate(entity.RecoveryCode{})
+}
+
+type ILoginAttemptRepository interface {
+	CreateLoginAttempt(loginAttempt entity.LoginAttempt) error
+	CountLoginAttempts(scope entity.LockoutScopeEnum, subject string, since time.Time) (int64, error)
+	GetLastLoginAttempt(scope entity.LockoutScopeEnum, subject string) (*entity.LoginAttempt, error)
+	DeleteLoginAttempts(scope entity.LockoutScopeEnum, subject string) error
+	CreateLockout(lockout entity.Lockout) (*entity.Lockout, error)
+	GetLastLockout(scope entity.LockoutScopeEnum, subject string) (*entity.Lockout, error)
+	GetLockout(id uint) (*entity.Lockout, error)
+	ListLockouts(activeOnly bool, page pagination.Page) ([]entity.Lockout, error)
+	ClearLockout(id, clearedBy uint) error
+	Migration() error
+}
+
+type loginAttemptRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewLoginAttemptRepository(db *gorm.DB, logger *zap.SugaredLogger) ILoginAttemptRepository {
+	return &loginAttemptRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *loginAttemptRepository) CreateLoginAttempt(loginAttempt entity.LoginAttempt) error {
+	return r.db.Create(&loginAttempt).Error
+}
+
+func (r *loginAttemptRepository) CountLoginAttempts(scope entity.LockoutScopeEnum, subject string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.LoginAttempt{}).
+		Where(attemptColumn(scope)+" = ? AND created_at > ?", subject, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *loginAttemptRepository) GetLastLoginAttempt(scope entity.LockoutScopeEnum, subject string) (*entity.LoginAttempt, error) {
+	var loginAttempt entity.LoginAttempt
+	if err := r.db.Where(attemptColumn(scope)+" = ?", subject).Order("created_at DESC").First(&loginAttempt).Error; err != nil {
+		return nil, err
+	}
+	return &loginAttempt, nil
+}
+
+func (r *loginAttemptRepository) DeleteLoginAttempts(scope entity.LockoutScopeEnum, subject string) error {
+	return r.db.Unscoped().Where(attemptColumn(scope)+" = ?", subject).Delete(&entity.LoginAttempt{}).Error
+}
+
+func (r *loginAttemptRepository) CreateLockout(lockout entity.Lockout) (*entity.Lockout, error) {
+	if err := r.db.Create(&lockout).Error; err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+func (r *loginAttemptRepository) GetLastLockout(scope entity.LockoutScopeEnum, subject string) (*entity.Lockout, error) {
+	var lockout entity.Lockout
+	if err := r.db.Where("scope = ? AND subject = ?", scope, subject).Order("created_at DESC").First(&lockout).Error; err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+func (r *loginAttemptRepository) GetLockout(id uint) (*entity.Lockout, error) {
+	var lockout entity.Lockout
+	if err := r.db.Where("id = ?", id).First(&lockout).Error; err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+func (r *loginAttemptRepository) ListLockouts(activeOnly bool, page pagination.Page) ([]entity.Lockout, error) {
+	var lockouts []entity.Lockout
+	query := r.db.Model(&entity.Lockout{}).Scopes(page.Scope("lockouts"))
+	if activeOnly {
+		query = query.Where("cleared_at IS NULL AND locked_until > ?", time.Now())
+	}
+	if err := query.Find(&lockouts).Error; err != nil {
+		return nil, err
+	}
+	return lockouts, nil
+}
+
+func (r *loginAttemptRepository) ClearLockout(id, clearedBy uint) error {
+	return r.db.Model(&entity.Lockout{}).Where("id = ? AND cleared_at IS NULL", id).Updates(map[string]interface{}{
+		"cleared_at": time.Now(),
+		"cleared_by": clearedBy,
+	}).Error
+}
+
+func (r *loginAttemptRepository) Migration() error {
+	return r.db.AutoMigrate(entity.LoginAttempt{}, entity.Lockout{})
+}
+
+func attemptColumn(scope entity.LockoutScopeEnum) string {
+	if scope == entity.LockoutScopeIP {
+		return "ip"
+	}
+	return "username"
+}
@@ -1,63 +1,598 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	j "github.com/mehmetokdemir/social-media-api/internal/app/common/jwttoken"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/rbac"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/totp"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
 	"github.com/mehmetokdemir/social-media-api/internal/app/user"
 	"github.com/mehmetokdemir/social-media-api/internal/config"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"time"
 )
 
+const (
+	mfaIssuer            = "Social Media API"
+	mfaTokenDuration     = 5 * time.Minute
+	recoveryCodeCount    = 10
+	recoveryCodeByteSize = 5
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidMfaToken     = errors.New("invalid mfa token")
+	ErrInvalidMfaCode      = errors.New("invalid two-factor code")
+	ErrSuspendedUser       = errors.New("account is suspended")
+	ErrDeactivatedUser     = errors.New("account is deactivated for too long to be restored")
+	// ErrInvalidCredentials is returned for unknown usernames and wrong passwords alike
+	ErrInvalidCredentials   = errors.New("invalid username or password")
+	ErrTooManyLoginAttempts = errors.New("too many failed login attempts, try again later")
+)
+
+// dummyPasswordHash is compared against when the username is unknown, so that the response takes as long as a wrong password
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// LoginThrottledError tells how long to wait before the next login attempt is accepted
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return ErrTooManyLoginAttempts.Error()
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return ErrTooManyLoginAttempts
+}
+
+type loginSubject struct {
+	scope       entity.LockoutScopeEnum
+	value       string
+	maxFailures int
+}
+
 type IAuthService interface {
-	CreateToken(username, password string) (*LoginResponse, error)
-	DeleteToken(token string) error
+	CreateToken(username, password string, device DeviceInfo) (*LoginResponse, error)
+	CreateTokenForUser(userID uint, device DeviceInfo) (*LoginResponse, error)
+	CompleteMfaLogin(mfaToken, code string, device DeviceInfo) (*LoginResponse, error)
+	RefreshToken(refreshToken string) (*LoginResponse, error)
+	DeleteToken(token string, sessionID uint) error
+
+	ListSessions(userID, currentSessionID uint, page pagination.Page) ([]SessionResponse, string, error)
+	RevokeSession(userID, sessionID uint) error
+	RevokeAllSessions(userID uint) error
+
+	EnrollTotp(userID uint) (*MfaEnrollResponse, error)
+	ConfirmTotp(userID uint, code string) (*MfaRecoveryCodesResponse, error)
+	DisableTotp(userID uint, code string) error
+
+	ListLockouts(activeOnly bool, page pagination.Page) ([]LockoutResponse, string, error)
+	ClearLockout(actorID, lockoutID uint) error
 }
 
 type authService struct {
-	config              config.Config
-	logger              *zap.SugaredLogger
-	userService         user.IUserService
-	blackListRepository IBlackListRepository
+	config                 config.Config
+	logger                 *zap.SugaredLogger
+	userService            user.IUserService
+	blackListRepository    IBlackListRepository
+	refreshTokenRepository IRefreshTokenRepository
+	sessionRepository      ISessionRepository
+	mfaRepository          IMfaRepository
+	loginAttemptRepository ILoginAttemptRepository
+	signingKeyService      signingkey.ISigningKeyService
+	guardService           guard.IGuardService
 }
 
-func NewAuthService(userService user.IUserService, blackListRepository IBlackListRepository, logger *zap.SugaredLogger, config config.Config) IAuthService {
-	if blackListRepository == nil {
+func NewAuthService(userService user.IUserService, blackListRepository IBlackListRepository, refreshTokenRepository IRefreshTokenRepository, sessionRepository ISessionRepository, mfaRepository IMfaRepository, loginAttemptRepository ILoginAttemptRepository, signingKeyService signingkey.ISigningKeyService, guardService guard.IGuardService, logger *zap.SugaredLogger, config config.Config) IAuthService {
+	if blackListRepository == nil || refreshTokenRepository == nil || sessionRepository == nil || mfaRepository == nil || loginAttemptRepository == nil || signingKeyService == nil {
 		return nil
 	}
 
 	return &authService{
-		config:              config,
-		userService:         userService,
-		blackListRepository: blackListRepository,
-		logger:              logger,
+		config:                 config,
+		userService:            userService,
+		blackListRepository:    blackListRepository,
+		refreshTokenRepository: refreshTokenRepository,
+		sessionRepository:      sessionRepository,
+		mfaRepository:          mfaRepository,
+		loginAttemptRepository: loginAttemptRepository,
+		signingKeyService:      signingKeyService,
+		guardService:           guardService,
+		logger:                 logger,
 	}
 }
 
-func (s *authService) CreateToken(username, password string) (*LoginResponse, error) {
+func (s *authService) CreateToken(username, password string, device DeviceInfo) (*LoginResponse, error) {
+	if err := s.checkLoginThrottle(username, device.IP); err != nil {
+		return nil, err
+	}
 
 	userByUsername, err := s.userService.GetUserByUsername(username)
 	if err != nil {
-		return nil, err
+		s.verifyPassword(string(dummyPasswordHash), password)
+		return nil, s.recordLoginFailure(username, device.IP)
 	}
 
 	if ok := s.verifyPassword(userByUsername.Password, password); !ok {
-		return nil, errors.New("password mismatch")
+		return nil, s.recordLoginFailure(username, device.IP)
+	}
+
+	return s.login(userByUsername, device)
+}
+
+// CreateTokenForUser logs in a user whose identity is already proven by other means, like an external identity provider
+func (s *authService) CreateTokenForUser(userID uint, device DeviceInfo) (*LoginResponse, error) {
+	userByID, err := s.userService.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.login(userByID, device)
+}
+
+func (s *authService) login(user *entity.User, device DeviceInfo) (*LoginResponse, error) {
+	if user.SuspendedAt != nil {
+		return nil, ErrSuspendedUser
+	}
+
+	if s.isDeactivationExpired(user) {
+		return nil, ErrDeactivatedUser
+	}
+
+	// With two-factor authentication the first factor only earns a token to submit the code with
+	if user.TotpEnabledAt != nil {
+		mfaToken, err := s.createMfaToken(user)
+		if err != nil {
+			return nil, err
+		}
+
+		return &LoginResponse{
+			Username:    user.Username,
+			Email:       user.Email,
+			MfaRequired: true,
+			MfaToken:    mfaToken,
+		}, nil
+	}
+
+	return s.startSession(user, device)
+}
+
+func (s *authService) CompleteMfaLogin(mfaToken, code string, device DeviceInfo) (*LoginResponse, error) {
+	tk := j.Token{}
+	token, err := s.signingKeyService.Parse(mfaToken, &tk)
+	if err != nil || !token.Valid || !tk.MfaPending {
+		return nil, ErrInvalidMfaToken
+	}
+
+	userByID, err := s.userService.GetUserById(tk.UserId)
+	if err != nil || userByID.TotpEnabledAt == nil {
+		return nil, ErrInvalidMfaToken
+	}
+
+	if userByID.SuspendedAt != nil {
+		return nil, ErrSuspendedUser
+	}
+
+	if err = s.checkLoginThrottle(userByID.Username, device.IP); err != nil {
+		return nil, err
+	}
+
+	if err = s.verifySecondFactor(userByID, code); err != nil {
+		if errors.Is(err, ErrInvalidMfaCode) {
+			// Wrong codes count towards the lockout too, otherwise the password step would be the only one throttled
+			_ = s.recordLoginFailure(userByID.Username, device.IP)
+		}
+		return nil, err
+	}
+
+	return s.startSession(userByID, device)
+}
+
+func (s *authService) startSession(user *entity.User, device DeviceInfo) (*LoginResponse, error) {
+	// Logging in is how a deactivated user comes back, as long as the reactivation window is not over
+	if user.DeactivatedAt != nil {
+		if s.isDeactivationExpired(user) {
+			return nil, ErrDeactivatedUser
+		}
+		if err := s.userService.ReactivateUser(user.ID); err != nil {
+			return nil, err
+		}
+		user.DeactivatedAt = nil
+	}
+
+	familyID, err := s.generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessionRepository.CreateSession(entity.Session{
+		UserID:     user.ID,
+		DeviceName: device.DeviceName,
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		LastSeenAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A completed login forgives the earlier failures of the account, not the ones of the ip
+	if err = s.loginAttemptRepository.DeleteLoginAttempts(entity.LockoutScopeAccount, normalizeUsername(user.Username)); err != nil {
+		s.logger.Errorf("can not delete login attempts of user %d: %v", user.ID, err)
+	}
+
+	return s.issueTokens(user, familyID, session.ID)
+}
+
+func (s *authService) isDeactivationExpired(user *entity.User) bool {
+	if user.DeactivatedAt == nil {
+		return false
+	}
+	return time.Since(*user.DeactivatedAt) > time.Duration(s.config.AccountReactivationDays)*24*time.Hour
+}
+
+func (s *authService) loginSubjects(username, ip string) []loginSubject {
+	subjects := []loginSubject{{scope: entity.LockoutScopeAccount, value: normalizeUsername(username), maxFailures: s.config.LoginMaxFailures}}
+	if ip != "" {
+		subjects = append(subjects, loginSubject{scope: entity.LockoutScopeIP, value: ip, maxFailures: s.config.LoginMaxIPFailures})
+	}
+	return subjects
+}
+
+// checkLoginThrottle rejects the attempt while the account or the ip is locked out or still backing off from the last failure
+func (s *authService) checkLoginThrottle(username, ip string) error {
+	for _, subject := range s.loginSubjects(username, ip) {
+		if lockout, err := s.loginAttemptRepository.GetLastLockout(subject.scope, subject.value); err == nil && isLockoutActive(lockout) {
+			return &LoginThrottledError{RetryAfter: time.Until(lockout.LockedUntil)}
+		}
+
+		count, err := s.countLoginFailures(subject)
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			continue
+		}
+
+		lastAttempt, err := s.loginAttemptRepository.GetLastLoginAttempt(subject.scope, subject.value)
+		if err != nil {
+			continue
+		}
+
+		if retryAfter := time.Until(lastAttempt.CreatedAt.Add(s.loginBackoff(count))); retryAfter > 0 {
+			return &LoginThrottledError{RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// recordLoginFailure counts the failure for the account and the ip and locks them out once they reach their limit
+func (s *authService) recordLoginFailure(username, ip string) error {
+	if err := s.loginAttemptRepository.CreateLoginAttempt(entity.LoginAttempt{
+		Username: normalizeUsername(username),
+		IP:       ip,
+	}); err != nil {
+		s.logger.Errorf("can not create login attempt: %v", err)
+		return ErrInvalidCredentials
+	}
+
+	for _, subject := range s.loginSubjects(username, ip) {
+		count, err := s.countLoginFailures(subject)
+		if err != nil || count < int64(subject.maxFailures) {
+			continue
+		}
+
+		lockout, err := s.loginAttemptRepository.CreateLockout(entity.Lockout{
+			Scope:        subject.scope,
+			Subject:      subject.value,
+			FailureCount: count,
+			LockedUntil:  time.Now().Add(s.lockoutDuration()),
+		})
+		if err != nil {
+			s.logger.Errorf("can not create lockout for %s %s: %v", subject.scope, subject.value, err)
+			continue
+		}
+		s.logger.Warnf("%s %s is locked out until %s after %d failed login attempts", lockout.Scope, lockout.Subject, lockout.LockedUntil.Format(time.RFC3339), count)
+	}
+
+	return ErrInvalidCredentials
+}
+
+// countLoginFailures counts the failures in the lockout window, failures before the last lockout are already paid for
+func (s *authService) countLoginFailures(subject loginSubject) (int64, error) {
+	since := time.Now().Add(-s.lockoutDuration())
+	if lockout, err := s.loginAttemptRepository.GetLastLockout(subject.scope, subject.value); err == nil && lockout.CreatedAt.After(since) {
+		since = lockout.CreatedAt
+	}
+
+	return s.loginAttemptRepository.CountLoginAttempts(subject.scope, subject.value, since)
+}
+
+// loginBackoff doubles the wait after every failure, starting from one second up to the lockout duration
+func (s *authService) loginBackoff(failures int64) time.Duration {
+	lockoutDuration := s.lockoutDuration()
+	if failures > 16 {
+		return lockoutDuration
+	}
+
+	backoff := time.Second << (failures - 1)
+	if backoff > lockoutDuration {
+		return lockoutDuration
+	}
+	return backoff
+}
+
+func (s *authService) lockoutDuration() time.Duration {
+	return time.Duration(s.config.LoginLockoutMinutes) * time.Minute
+}
+
+func (s *authService) ListLockouts(activeOnly bool, page pagination.Page) ([]LockoutResponse, string, error) {
+	lockouts, err := s.loginAttemptRepository.ListLockouts(activeOnly, page)
+	if err != nil {
+		return nil, "", err
+	}
+	lockouts, nextCursor := pagination.Next(lockouts, page, func(lockout entity.Lockout) (time.Time, uint) { return lockout.CreatedAt, lockout.ID })
+
+	var rsp []LockoutResponse
+	for _, lockout := range lockouts {
+		lockoutResponse := LockoutResponse{
+			Id:           lockout.ID,
+			Scope:        lockout.Scope,
+			Subject:      lockout.Subject,
+			FailureCount: lockout.FailureCount,
+			CreatedAt:    lockout.CreatedAt.Format(time.RFC3339),
+			LockedUntil:  lockout.LockedUntil.Format(time.RFC3339),
+			ClearedBy:    lockout.ClearedBy,
+			Active:       isLockoutActive(&lockout),
+		}
+		if lockout.ClearedAt != nil {
+			clearedAt := lockout.ClearedAt.Format(time.RFC3339)
+			lockoutResponse.ClearedAt = &clearedAt
+		}
+		rsp = append(rsp, lockoutResponse)
+	}
+
+	return rsp, nextCursor, nil
+}
+
+func (s *authService) ClearLockout(actorID, lockoutID uint) error {
+	lockout, err := s.loginAttemptRepository.GetLockout(lockoutID)
+	if err != nil {
+		return err
+	}
+
+	if !isLockoutActive(lockout) {
+		return errors.New("lockout is not active")
+	}
+
+	return s.loginAttemptRepository.ClearLockout(lockout.ID, actorID)
+}
+
+func isLockoutActive(lockout *entity.Lockout) bool {
+	return lockout.ClearedAt == nil && lockout.LockedUntil.After(time.Now())
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func (s *authService) createMfaToken(user *entity.User) (string, error) {
+	tk := &j.Token{
+		Username:   user.Username,
+		UserId:     user.ID,
+		MfaPending: true,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(mfaTokenDuration).Unix(),
+		},
+	}
+
+	tokenString, err := s.signingKeyService.Sign(tk)
+	if err != nil {
+		return "", errors.New("can not sign jwttoken")
+	}
+	return tokenString, nil
+}
+
+// verifySecondFactor accepts either a code of the authenticator or an unused recovery code
+func (s *authService) verifySecondFactor(user *entity.User, code string) error {
+	if step, ok := totp.Validate(user.TotpSecret, code, time.Now()); ok {
+		accepted, err := s.mfaRepository.UpdateTotpLastStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return ErrInvalidMfaCode
+		}
+		return nil
+	}
+
+	used, err := s.mfaRepository.UseRecoveryCode(user.ID, s.hashToken(s.normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMfaCode
+	}
+	return nil
+}
+
+func (s *authService) EnrollTotp(userID uint) (*MfaEnrollResponse, error) {
+	userByID, err := s.userService.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if userByID.TotpEnabledAt != nil {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.mfaRepository.SetTotpSecret(userByID.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &MfaEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(mfaIssuer, userByID.Username, secret),
+	}, nil
+}
+
+func (s *authService) ConfirmTotp(userID uint, code string) (*MfaRecoveryCodesResponse, error) {
+	userByID, err := s.userService.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if userByID.TotpEnabledAt != nil {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	if userByID.TotpSecret == "" {
+		return nil, errors.New("two-factor authentication enrollment is not started")
+	}
+
+	step, ok := totp.Validate(userByID.TotpSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMfaCode
+	}
+
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	codeHashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		recoveryCode, err := s.generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		codeHashes = append(codeHashes, s.hashToken(s.normalizeRecoveryCode(recoveryCode)))
+	}
+
+	if err = s.mfaRepository.ReplaceRecoveryCodes(userByID.ID, codeHashes); err != nil {
+		return nil, err
+	}
+
+	if err = s.mfaRepository.EnableTotp(userByID.ID, step); err != nil {
+		return nil, err
+	}
+
+	return &MfaRecoveryCodesResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *authService) DisableTotp(userID uint, code string) error {
+	userByID, err := s.userService.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+
+	if userByID.TotpEnabledAt == nil {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	if err = s.verifySecondFactor(userByID, code); err != nil {
+		return err
+	}
+
+	return s.mfaRepository.DisableTotp(userByID.ID)
+}
+
+// generateRecoveryCode returns a code like "abcde-fghij" which is easy to type
+func (s *authService) generateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeByteSize*2)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	return fmt.Sprintf("%s-%s", code[:5], code[5:10]), nil
+}
+
+func (s *authService) normalizeRecoveryCode(code string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(code)), "-", "")
+}
+
+func (s *authService) RefreshToken(refreshToken string) (*LoginResponse, error) {
+	storedToken, err := s.refreshTokenRepository.GetRefreshTokenByHash(s.hashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if storedToken.RevokedAt != nil || time.Now().After(storedToken.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// A rotated token is presented again; either the client or an attacker holds a stolen copy,
+	// so the whole family is revoked and both parties have to log in again.
+	rotated, err := s.refreshTokenRepository.MarkRefreshTokenRotated(storedToken.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		if err = s.revokeFamily(storedToken.FamilyID); err != nil {
+			return nil, err
+		}
+		if err = s.sessionRepository.RevokeSession(storedToken.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
 	}
 
+	session, err := s.sessionRepository.GetSession(storedToken.SessionID)
+	if err != nil || session.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err = s.sessionRepository.TouchSession(session.ID); err != nil {
+		return nil, err
+	}
+
+	userByID, err := s.userService.GetUserById(storedToken.UserID)
+	if err != nil || userByID.SuspendedAt != nil || userByID.DeactivatedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(userByID, storedToken.FamilyID, session.ID)
+}
+
+func (s *authService) issueTokens(user *entity.User, familyID string, sessionID uint) (*LoginResponse, error) {
+	tokenID, err := s.generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(time.Duration(s.config.JwtATExpirationMinutes) * time.Minute)
 	tk := &j.Token{
-		Username: username,
-		UserId:   userByUsername.ID,
+		Username:    user.Username,
+		UserId:      user.ID,
+		SessionId:   sessionID,
+		Role:        string(user.Role),
+		Permissions: rbac.PermissionsOf(user.Role),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Duration(s.config.JwtATExpirationMinutes) * time.Minute).Unix(),
+			Id:        tokenID,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expiresAt.Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tk)
-	tokenString, err := token.SignedString([]byte(s.config.JwtATPrivateKey))
+	tokenString, err := s.signingKeyService.Sign(tk)
 	if err != nil {
 		return nil, errors.New("can not sign jwttoken")
 	}
@@ -66,13 +601,63 @@ func (s *authService) CreateToken(username, password string) (*LoginResponse, er
 		return nil, errors.New("invalid token")
 	}
 
+	refreshToken, err := s.generateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = s.refreshTokenRepository.CreateRefreshToken(entity.RefreshToken{
+		UserID:      user.ID,
+		TokenHash:   s.hashToken(refreshToken),
+		FamilyID:    familyID,
+		SessionID:   sessionID,
+		AccessToken: tokenString,
+		ExpiresAt:   time.Now().Add(time.Duration(s.config.JwtRTExpirationMinutes) * time.Minute),
+	}); err != nil {
+		return nil, err
+	}
+
 	return &LoginResponse{
-		Username:  userByUsername.Username,
-		Email:     userByUsername.Email,
-		TokenHash: tokenString,
+		Username:     user.Username,
+		Email:        user.Email,
+		TokenHash:    tokenString,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt.Unix(),
 	}, nil
 }
 
+// revokeFamily revokes every refresh token of the family and blacklists the access tokens issued with them.
+func (s *authService) revokeFamily(familyID string) error {
+	refreshTokens, err := s.refreshTokenRepository.ListRefreshTokensByFamily(familyID)
+	if err != nil {
+		return err
+	}
+
+	for _, refreshToken := range refreshTokens {
+		if refreshToken.AccessToken == "" {
+			continue
+		}
+		if err = s.blacklistToken(refreshToken.AccessToken); err != nil {
+			return err
+		}
+	}
+
+	return s.refreshTokenRepository.RevokeRefreshTokenFamily(familyID)
+}
+
+func (s *authService) generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *authService) hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func (s *authService) verifyPassword(hashedPassword, requestedPassword string) bool {
 	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(requestedPassword)); err == nil {
 		return true
@@ -80,8 +665,84 @@ func (s *authService) verifyPassword(hashedPassword, requestedPassword string) b
 	return false
 }
 
-func (s *authService) DeleteToken(token string) error {
-	return s.blackListRepository.CreateTokenToBlackList(entity.BlackList{
-		Token: token,
-	})
+// blacklistToken keeps the access token rejected until it expires, after that the guard purges it. Other instances
+// may let it in until their cached answer expires.
+func (s *authService) blacklistToken(token string) error {
+	expiresAt := time.Now().Add(time.Duration(s.config.JwtATExpirationMinutes) * time.Minute)
+
+	tk := j.Token{}
+	if _, err := s.signingKeyService.Parse(token, &tk); err == nil && tk.ExpiresAt > 0 {
+		expiresAt = time.Unix(tk.ExpiresAt, 0)
+	}
+
+	if err := s.blackListRepository.CreateTokenToBlackList(entity.BlackList{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return err
+	}
+
+	s.guardService.EvictToken(token)
+	return nil
+}
+
+func (s *authService) DeleteToken(token string, sessionID uint) error {
+	if err := s.blacklistToken(token); err != nil {
+		return err
+	}
+
+	// Logging out ends the session and the refresh tokens issued for it
+	if err := s.refreshTokenRepository.RevokeRefreshTokensBySessionID(sessionID); err != nil {
+		return err
+	}
+
+	return s.sessionRepository.RevokeSession(sessionID)
+}
+
+func (s *authService) ListSessions(userID, currentSessionID uint, page pagination.Page) ([]SessionResponse, string, error) {
+	sessions, err := s.sessionRepository.ListActiveSessionsByUserID(userID, page)
+	if err != nil {
+		return nil, "", err
+	}
+	sessions, nextCursor := pagination.Next(sessions, page, func(session entity.Session) (time.Time, uint) { return session.CreatedAt, session.ID })
+
+	var rsp []SessionResponse
+	for _, session := range sessions {
+		rsp = append(rsp, SessionResponse{
+			Id:         session.ID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt.Format(time.RFC3339),
+			LastSeenAt: session.LastSeenAt.Format(time.RFC3339),
+			Current:    session.ID == currentSessionID,
+		})
+	}
+
+	return rsp, nextCursor, nil
+}
+
+func (s *authService) RevokeSession(userID, sessionID uint) error {
+	session, err := s.sessionRepository.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.UserID != userID {
+		return errors.New("do not have permission to revoke this session")
+	}
+
+	if err = s.refreshTokenRepository.RevokeRefreshTokensBySessionID(session.ID); err != nil {
+		return err
+	}
+
+	return s.sessionRepository.RevokeSession(session.ID)
+}
+
+func (s *authService) RevokeAllSessions(userID uint) error {
+	if err := s.refreshTokenRepository.RevokeRefreshTokensByUserID(userID); err != nil {
+		return err
+	}
+
+	return s.sessionRepository.RevokeSessionsByUserID(userID)
 }
@@ -0,0 +1,8 @@
+package block
+
+import "github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+
+type ReadBlockResponse struct {
+	User      httpmodel.CommonUser `json:"user" extensions:"x-order=1"`                                           // Blocked or muted user
+	CreatedAt string               `json:"created_at" extensions:"x-order=2" example:"2024-01-22T11:31:40+03:00"` // Time the user is blocked or muted at
+}
@@ -0,0 +1,192 @@
+package block
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
+	"github.com/mehmetokdemir/social-media-api/internal/middleware"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+type HttpHandler struct {
+	blockService      IBlockService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
+}
+
+func NewHttpHandler(guardService guard.IGuardService, blockService IBlockService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, blockService: blockService, logger: logger, signingKeyService: signingKeyService}
+}
+
+func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
+	blockGroup := app.Group("/blocks").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
+	blockGroup.Get("", h.ListBlocks)
+	blockGroup.Post("/:user_id", h.Block)
+	blockGroup.Delete("/:user_id", h.Unblock)
+
+	muteGroup := app.Group("/mutes").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
+	muteGroup.Get("", h.ListMutes)
+	muteGroup.Post("/:user_id", h.Mute)
+	muteGroup.Delete("/:user_id", h.Unmute)
+}
+
+// Block godoc
+// @Summary Block user
+// @Description Block a user. Blocked users and the blocker can not send each other friend requests, comment on or like each other's content
+// @Description or view each other's profile and content. Any friendship or pending request between them is removed.
+// @Tags Block
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user to block"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /blocks/{user_id} [post]
+func (h *HttpHandler) Block(ctx *fiber.Ctx) error {
+	return h.changeRelation(ctx, h.blockService.Block, "can not block user")
+}
+
+// Unblock godoc
+// @Summary Unblock user
+// @Description Unblock a user blocked before, a removed friendship is not restored
+// @Tags Block
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user to unblock"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /blocks/{user_id} [delete]
+func (h *HttpHandler) Unblock(ctx *fiber.Ctx) error {
+	return h.changeRelation(ctx, h.blockService.Unblock, "can not unblock user")
+}
+
+// ListBlocks godoc
+// @Summary List blocked users
+// @Description List users blocked by the user
+// @Tags Block
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadBlockResponse "Success"
+// @Failure 400
+// @Failure 500
+// @Router /blocks [get]
+func (h *HttpHandler) ListBlocks(ctx *fiber.Ctx) error {
+	return h.listRelations(ctx, h.blockService.ListBlocks, "can not get blocked users")
+}
+
+// Mute godoc
+// @Summary Mute user
+// @Description Mute a user, their posts and comments are left out of the feed of the user. Nothing changes for the muted user.
+// @Tags Block
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user to mute"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /mutes/{user_id} [post]
+func (h *HttpHandler) Mute(ctx *fiber.Ctx) error {
+	return h.changeRelation(ctx, h.blockService.Mute, "can not mute user")
+}
+
+// Unmute godoc
+// @Summary Unmute user
+// @Description Unmute a user muted before
+// @Tags Block
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user to unmute"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /mutes/{user_id} [delete]
+func (h *HttpHandler) Unmute(ctx *fiber.Ctx) error {
+	return h.changeRelation(ctx, h.blockService.Unmute, "can not unmute user")
+}
+
+// ListMutes godoc
+// @Summary List muted users
+// @Description List users muted by the user
+// @Tags Block
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadBlockResponse "Success"
+// @Failure 400
+// @Failure 500
+// @Router /mutes [get]
+func (h *HttpHandler) ListMutes(ctx *fiber.Ctx) error {
+	return h.listRelations(ctx, h.blockService.ListMutes, "can not get muted users")
+}
+
+func (h *HttpHandler) changeRelation(ctx *fiber.Ctx, change func(userID, targetID uint) error, message string) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	targetID, err := strconv.ParseUint(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse user_id", err.Error(), http.StatusBadRequest))
+	}
+
+	if err = change(userID, uint(targetID)); err != nil {
+		switch {
+		case errors.Is(err, ErrSelfRelation):
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError(message, err.Error(), http.StatusBadRequest))
+		case errors.Is(err, ErrUserNotFound):
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError(message, err.Error(), http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError(message, err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+func (h *HttpHandler) listRelations(ctx *fiber.Ctx, list func(userID uint, page pagination.Page) ([]ReadBlockResponse, string, error), message string) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError(message, err.Error(), http.StatusBadRequest))
+	}
+
+	rsp, nextCursor, err := list(userID, page)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError(message, err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, rsp, nextCursor))
+}
@@ -0,0 +1,115 @@
+package block
+
+import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IBlockRepository interface {
+	Block(blockerID, blockedID uint) error
+	Unblock(blockerID, blockedID uint) error
+	ListBlocks(blockerID uint, page pagination.Page) ([]entity.Block, error)
+	IsBlocked(firstUserID, secondUserID uint) (bool, error)
+	ListBlockRelatedUserIDs(userID uint) ([]uint, error)
+
+	Mute(muterID, mutedID uint) error
+	Unmute(muterID, mutedID uint) error
+	ListMutes(muterID uint, page pagination.Page) ([]entity.Mute, error)
+	ListMutedUserIDs(muterID uint) ([]uint, error)
+
+	IsUserExist(userID uint) bool
+	Migration() error
+}
+
+type blockRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewRepository(db *gorm.DB, logger *zap.SugaredLogger) IBlockRepository {
+	return &blockRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Block records the block and ends any friendship, follow or pending request between the users
+func (r *blockRepository) Block(blockerID, blockedID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.Block{BlockerID: blockerID, BlockedID: blockedID}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("(follower_id = ? AND followee_id = ?) OR (follower_id = ? AND followee_id = ?)", blockerID, blockedID, blockedID, blockerID).
+			Delete(&entity.Follow{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)", blockerID, blockedID, blockedID, blockerID).
+			Delete(&entity.Friendship{}).Error
+	})
+}
+
+func (r *blockRepository) Unblock(blockerID, blockedID uint) error {
+	return r.db.Unscoped().Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&entity.Block{}).Error
+}
+
+func (r *blockRepository) ListBlocks(blockerID uint, page pagination.Page) ([]entity.Block, error) {
+	var blocks []entity.Block
+	if err := r.db.Preload("Blocked").Model(&entity.Block{}).Scopes(page.Scope("blocks")).Where("blocker_id = ?", blockerID).Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// IsBlocked tells whether either of the users blocked the other
+func (r *blockRepository) IsBlocked(firstUserID, secondUserID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&entity.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", firstUserID, secondUserID, secondUserID, firstUserID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListBlockRelatedUserIDs lists the users blocked by the user and the users who blocked them
+func (r *blockRepository) ListBlockRelatedUserIDs(userID uint) ([]uint, error) {
+	var userIDs []uint
+	err := r.db.Model(&entity.Block{}).
+		Select("CASE WHEN blocker_id = ? THEN blocked_id ELSE blocker_id END", userID).
+		Where("blocker_id = ? OR blocked_id = ?", userID, userID).
+		Scan(&userIDs).Error
+	return userIDs, err
+}
+
+func (r *blockRepository) Mute(muterID, mutedID uint) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.Mute{MuterID: muterID, MutedID: mutedID}).Error
+}
+
+func (r *blockRepository) Unmute(muterID, mutedID uint) error {
+	return r.db.Unscoped().Where("muter_id = ? AND muted_id = ?", muterID, mutedID).Delete(&entity.Mute{}).Error
+}
+
+func (r *blockRepository) ListMutes(muterID uint, page pagination.Page) ([]entity.Mute, error) {
+	var mutes []entity.Mute
+	if err := r.db.Preload("Muted").Model(&entity.Mute{}).Scopes(page.Scope("mutes")).Where("muter_id = ?", muterID).Find(&mutes).Error; err != nil {
+		return nil, err
+	}
+	return mutes, nil
+}
+
+func (r *blockRepository) ListMutedUserIDs(muterID uint) ([]uint, error) {
+	var userIDs []uint
+	err := r.db.Model(&entity.Mute{}).Where("muter_id = ?", muterID).Pluck("muted_id", &userIDs).Error
+	return userIDs, err
+}
+
+func (r *blockRepository) IsUserExist(userID uint) bool {
+	var count int64
+	r.db.Model(&entity.User{}).Where("id = ?", userID).Count(&count)
+	return count > 0
+}
+
+func (r *blockRepository) Migration() error {
+	return r.db.AutoMigrate(entity.Block{}, entity.Mute{})
+}
@@ -0,0 +1,148 @@
+package block
+
+import (
+	"errors"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"time"
+)
+
+var (
+	// ErrBlocked is returned by every subsystem when one of the users blocked the other
+	ErrBlocked      = errors.New("user is blocked")
+	ErrSelfRelation = errors.New("can not block or mute yourself")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+type IBlockService interface {
+	Block(userID, blockedID uint) error
+	Unblock(userID, blockedID uint) error
+	ListBlocks(userID uint, page pagination.Page) ([]ReadBlockResponse, string, error)
+	IsBlocked(firstUserID, secondUserID uint) (bool, error)
+	HiddenUserIDs(userID uint) (map[uint]bool, error)
+
+	Mute(userID, mutedID uint) error
+	Unmute(userID, mutedID uint) error
+	ListMutes(userID uint, page pagination.Page) ([]ReadBlockResponse, string, error)
+	MutedUserIDs(userID uint) (map[uint]bool, error)
+}
+
+type blockService struct {
+	config     config.Config
+	logger     *zap.SugaredLogger
+	repository IBlockRepository
+}
+
+func NewBlockService(repository IBlockRepository, logger *zap.SugaredLogger, config config.Config) IBlockService {
+	if repository == nil {
+		return nil
+	}
+
+	return &blockService{
+		config:     config,
+		logger:     logger,
+		repository: repository,
+	}
+}
+
+func (s *blockService) Block(userID, blockedID uint) error {
+	if err := s.checkTarget(userID, blockedID); err != nil {
+		return err
+	}
+	return s.repository.Block(userID, blockedID)
+}
+
+func (s *blockService) Unblock(userID, blockedID uint) error {
+	return s.repository.Unblock(userID, blockedID)
+}
+
+func (s *blockService) ListBlocks(userID uint, page pagination.Page) ([]ReadBlockResponse, string, error) {
+	blocks, err := s.repository.ListBlocks(userID, page)
+	if err != nil {
+		return nil, "", err
+	}
+	blocks, nextCursor := pagination.Next(blocks, page, func(block entity.Block) (time.Time, uint) { return block.CreatedAt, block.ID })
+
+	rsp := make([]ReadBlockResponse, 0, len(blocks))
+	for _, block := range blocks {
+		rsp = append(rsp, ReadBlockResponse{
+			User:      httpmodel.CommonUser{Id: block.BlockedID, Username: block.Blocked.Username, FirstName: block.Blocked.FirstName, LastName: block.Blocked.LastName, ProfilePhoto: block.Blocked.ProfilePhoto},
+			CreatedAt: block.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return rsp, nextCursor, nil
+}
+
+func (s *blockService) IsBlocked(firstUserID, secondUserID uint) (bool, error) {
+	if firstUserID == secondUserID {
+		return false, nil
+	}
+	return s.repository.IsBlocked(firstUserID, secondUserID)
+}
+
+// HiddenUserIDs is the set of users whose content the user can not see because of a block in either direction
+func (s *blockService) HiddenUserIDs(userID uint) (map[uint]bool, error) {
+	userIDs, err := s.repository.ListBlockRelatedUserIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return toSet(userIDs), nil
+}
+
+func (s *blockService) Mute(userID, mutedID uint) error {
+	if err := s.checkTarget(userID, mutedID); err != nil {
+		return err
+	}
+	return s.repository.Mute(userID, mutedID)
+}
+
+func (s *blockService) Unmute(userID, mutedID uint) error {
+	return s.repository.Unmute(userID, mutedID)
+}
+
+func (s *blockService) ListMutes(userID uint, page pagination.Page) ([]ReadBlockResponse, string, error) {
+	mutes, err := s.repository.ListMutes(userID, page)
+	if err != nil {
+		return nil, "", err
+	}
+	mutes, nextCursor := pagination.Next(mutes, page, func(mute entity.Mute) (time.Time, uint) { return mute.CreatedAt, mute.ID })
+
+	rsp := make([]ReadBlockResponse, 0, len(mutes))
+	for _, mute := range mutes {
+		rsp = append(rsp, ReadBlockResponse{
+			User:      httpmodel.CommonUser{Id: mute.MutedID, Username: mute.Muted.Username, FirstName: mute.Muted.FirstName, LastName: mute.Muted.LastName, ProfilePhoto: mute.Muted.ProfilePhoto},
+			CreatedAt: mute.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return rsp, nextCursor, nil
+}
+
+// MutedUserIDs is the set of users whose content is left out of the feed of the user
+func (s *blockService) MutedUserIDs(userID uint) (map[uint]bool, error) {
+	userIDs, err := s.repository.ListMutedUserIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return toSet(userIDs), nil
+}
+
+func (s *blockService) checkTarget(userID, targetID uint) error {
+	if userID == targetID {
+		return ErrSelfRelation
+	}
+	if !s.repository.IsUserExist(targetID) {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func toSet(userIDs []uint) map[uint]bool {
+	set := make(map[uint]bool, len(userIDs))
+	for _, id := range userIDs {
+		set[id] = true
+	}
+	return set
+}
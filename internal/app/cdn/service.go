@@ -2,13 +2,20 @@ package cdn
 
 import (
 	"context"
+	"errors"
 	"github.com/cloudinary/cloudinary-go"
+	"github.com/cloudinary/cloudinary-go/api"
 	"github.com/cloudinary/cloudinary-go/api/uploader"
+	"io"
 	"mime/multipart"
+	"time"
 )
 
 type ICdnService interface {
 	UploadImage(file *multipart.FileHeader) (string, error)
+	UploadPrivateFile(publicID string, file io.Reader) error
+	PrivateDownloadURL(publicID string, expiresAt time.Time) (string, error)
+	DeletePrivateFile(publicID string) error
 }
 
 type cdnService struct {
@@ -40,3 +47,48 @@ func (s *cdnService) UploadImage(file *multipart.FileHeader) (string, error) {
 
 	return uploadResult.URL, nil
 }
+
+// UploadPrivateFile stores the file as a private raw asset, every instance of the service can reach it and it can only
+// be downloaded with a signed url
+func (s *cdnService) UploadPrivateFile(publicID string, file io.Reader) error {
+	uploadResult, err := s.cloudinaryClient.Upload.Upload(context.Background(), file, uploader.UploadParams{
+		PublicID:     publicID,
+		ResourceType: api.File,
+		Type:         api.Private,
+	})
+	if err != nil {
+		return err
+	}
+	if uploadResult.Error.Message != "" {
+		return errors.New(uploadResult.Error.Message)
+	}
+	return nil
+}
+
+// PrivateDownloadURL signs a url which downloads the private file as an attachment until expiresAt
+func (s *cdnService) PrivateDownloadURL(publicID string, expiresAt time.Time) (string, error) {
+	return s.cloudinaryClient.Upload.PrivateDownloadUrl(uploader.PrivateDownloadUrlParams{
+		PublicID:     publicID,
+		DeliveryType: api.Private,
+		ResourceType: api.File,
+		Attachment:   "true",
+		ExpiresAt:    &expiresAt,
+	})
+}
+
+// DeletePrivateFile removes the private file, a file which does not exist anymore is not an error
+func (s *cdnService) DeletePrivateFile(publicID string) error {
+	destroyResult, err := s.cloudinaryClient.Upload.Destroy(context.Background(), uploader.DestroyParams{
+		PublicID:     publicID,
+		Type:         api.Private,
+		ResourceType: api.File,
+		Invalidate:   true,
+	})
+	if err != nil {
+		return err
+	}
+	if destroyResult.Error.Message != "" {
+		return errors.New(destroyResult.Error.Message)
+	}
+	return nil
+}
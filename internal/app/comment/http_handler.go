@@ -1,35 +1,41 @@
 package comment
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
 	"github.com/mehmetokdemir/social-media-api/internal/middleware"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 	"net/http"
 	"strconv"
 )
 
 type HttpHandler struct {
-	commentService ICommentService
-	logger         *zap.SugaredLogger
-	jwtPrivateKey  string
-	guardService   guard.IGuardService
+	commentService    ICommentService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
 }
 
-func NewHttpHandler(guardService guard.IGuardService, commentService ICommentService, logger *zap.SugaredLogger, jwtPrivateKey string) *HttpHandler {
-	return &HttpHandler{guardService: guardService, commentService: commentService, logger: logger, jwtPrivateKey: jwtPrivateKey}
+func NewHttpHandler(guardService guard.IGuardService, commentService ICommentService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, commentService: commentService, logger: logger, signingKeyService: signingKeyService}
 }
 
 func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
-	appGroup := app.Group("/comment").Use(middleware.AuthMiddleware(h.jwtPrivateKey))
+	appGroup := app.Group("/comment").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
 	appGroup.Post("/create", h.Create)
 	appGroup.Put("/update", h.Update)
 	appGroup.Put("/update/:comment_id/image", h.UpdateImage)
 	appGroup.Delete("/delete/:comment_id", h.Delete)
 	appGroup.Get("/list/:post_id", h.List)
+	appGroup.Get("/replies/:comment_id", h.Replies)
 
 	appGroup.Get("/get/:comment_id", h.Get)
 }
@@ -44,6 +50,8 @@ func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
 // @Param request body CreateRequest true "body params"
 // @Success 200 {object} httpmodel.CreateResponse
 // @Failure 400
+// @Failure 403
+// @Failure 404
 // @Failure 500
 // @Router /comment/create [post]
 func (h *HttpHandler) Create(ctx *fiber.Ctx) error {
@@ -64,6 +72,12 @@ func (h *HttpHandler) Create(ctx *fiber.Ctx) error {
 
 	comment, err := h.commentService.CreateComment(userID, req)
 	if err != nil {
+		if errors.Is(err, block.ErrBlocked) {
+			return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("can not create comment", err.Error(), http.StatusForbidden))
+		}
+		if errors.Is(err, ErrPostNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not create comment", err.Error(), http.StatusNotFound))
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not create comment", err.Error(), http.StatusInternalServerError))
 	}
 
@@ -196,6 +210,8 @@ func (h *HttpHandler) Delete(ctx *fiber.Ctx) error {
 // @Produce  json
 // @Param X-Auth-Token header string true "Auth token of logged-in user."
 // @Param post_id path integer true "ID of the post to list comments"
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
 // @Success 200 {object} []entity.Comment "Success"
 // @Failure 400
 // @Failure 500
@@ -215,12 +231,72 @@ func (h *HttpHandler) List(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse post id", err.Error(), http.StatusBadRequest))
 	}
 
-	comments, err := h.commentService.ListCommentsByPostID(uint(postID))
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.FromCtx(ctx)
 	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get comments", err.Error(), http.StatusBadRequest))
+	}
+
+	comments, nextCursor, err := h.commentService.ListPostComments(userID, uint(postID), page)
+	if err != nil {
+		if errors.Is(err, block.ErrBlocked) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not get comments", "post not found", http.StatusNotFound))
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get comments", err.Error(), http.StatusInternalServerError))
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, comments))
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, comments, nextCursor))
+}
+
+// Replies godoc
+// @Summary List replies of comment
+// @Description List replies to the comment newest first, replies of blocked users are left out
+// @Tags Comment
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param comment_id path integer true "ID of the comment"
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []entity.Comment "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /comment/replies/{comment_id} [get]
+func (h *HttpHandler) Replies(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	commentID, err := strconv.ParseUint(ctx.Params("comment_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse comment id", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get replies", err.Error(), http.StatusBadRequest))
+	}
+
+	comments, nextCursor, err := h.commentService.ListReplies(userID, uint(commentID), page)
+	if err != nil {
+		if errors.Is(err, block.ErrBlocked) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not get replies", "comment not found", http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get replies", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, comments, nextCursor))
 }
 
 // Get godoc
@@ -251,8 +327,16 @@ func (h *HttpHandler) Get(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not convert comment id from params", err.Error(), http.StatusBadRequest))
 	}
 
-	comment, err := h.commentService.GetCommentById(uint(commentID))
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	comment, err := h.commentService.GetCommentById(userID, uint(commentID))
 	if err != nil {
+		if errors.Is(err, block.ErrBlocked) || errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not get comment", "comment not found", http.StatusNotFound))
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get comment from database", err.Error(), http.StatusInternalServerError))
 	}
 
@@ -2,6 +2,8 @@ package comment
 
 import (
 	"errors"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/scopes"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -15,12 +17,19 @@ type ICommentRepository interface {
 	DeleteCommentsByPostID(postID uint) error
 	List() ([]*entity.Comment, error)
 	ListCommentsByPostID(postID uint) ([]entity.Comment, error)
-	ListMainCommentsByPostID(postID uint) ([]entity.Comment, error)
+	ListCommentsByPostIDs(postIDs []uint) ([]entity.Comment, error)
+	ListCommentsByParentIDs(parentIDs []uint) ([]entity.Comment, error)
+	PaginateMainCommentsByPostID(viewerID, postID uint, page pagination.Page) ([]entity.Comment, error)
+	CountCommentsByPostIDs(viewerID uint, postIDs []uint) (map[uint]int64, error)
 	IsPostExist(postID uint) bool
+	GetPost(viewerID, postID uint) (*entity.Post, error)
 
 	ListCommentsByParentID(parentCommentID uint) ([]entity.Comment, error)
 	DeleteCommentsByParentID(parentCommentID uint) error
 
+	PaginateCommentsByPostID(viewerID, postID uint, page pagination.Page) ([]entity.Comment, error)
+	PaginateCommentsByParentID(viewerID, parentCommentID uint, page pagination.Page) ([]entity.Comment, error)
+
 	Migration() error
 }
 
@@ -76,7 +85,7 @@ func (r *commentRepository) DeleteCommentsByParentID(id uint) error {
 
 func (r *commentRepository) List() ([]*entity.Comment, error) {
 	var comments []*entity.Comment
-	if err := r.db.Model(&entity.Comment{}).Find(&comments).Error; err != nil {
+	if err := r.db.Model(&entity.Comment{}).Scopes(scopes.ActiveUser("comments.user_id")).Find(&comments).Error; err != nil {
 		return nil, err
 	}
 
@@ -85,7 +94,7 @@ func (r *commentRepository) List() ([]*entity.Comment, error) {
 
 func (r *commentRepository) ListCommentsByParentID(commentParentID uint) ([]entity.Comment, error) {
 	var comments []entity.Comment
-	if err := r.db.Preload("User").Model(&entity.Comment{}).Where("parent_id = ? ", commentParentID).Order("created_at DESC").Find(&comments).Error; err != nil {
+	if err := r.db.Preload("User").Model(&entity.Comment{}).Scopes(scopes.ActiveUser("comments.user_id")).Where("parent_id = ? ", commentParentID).Order("created_at DESC").Find(&comments).Error; err != nil {
 		return nil, err
 	}
 
@@ -94,30 +103,113 @@ func (r *commentRepository) ListCommentsByParentID(commentParentID uint) ([]enti
 
 func (r *commentRepository) ListCommentsByPostID(postID uint) ([]entity.Comment, error) {
 	var comments []entity.Comment
-	if err := r.db.Preload("User").Model(&entity.Comment{}).Where("post_id = ?", postID).Order("created_at DESC").Find(&comments).Error; err != nil {
+	if err := r.db.Preload("User").Model(&entity.Comment{}).Scopes(scopes.ActiveUser("comments.user_id")).Where("post_id = ?", postID).Order("created_at DESC").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// PaginateCommentsByPostID lists a page of the comments of the post, comments of users blocked in either direction are
+// left out before the page is cut
+func (r *commentRepository) PaginateCommentsByPostID(viewerID, postID uint, page pagination.Page) ([]entity.Comment, error) {
+	var comments []entity.Comment
+	if err := r.db.Preload("User").Model(&entity.Comment{}).Scopes(scopes.ActiveUser("comments.user_id"), scopes.NotBlocked(viewerID, "comments.user_id"), page.Scope("comments")).Where("post_id = ?", postID).Find(&comments).Error; err != nil {
 		return nil, err
 	}
 	return comments, nil
 }
 
-func (r *commentRepository) ListMainCommentsByPostID(postID uint) ([]entity.Comment, error) {
+// PaginateCommentsByParentID lists a page of the replies to the comment, see PaginateCommentsByPostID
+func (r *commentRepository) PaginateCommentsByParentID(viewerID, parentCommentID uint, page pagination.Page) ([]entity.Comment, error) {
 	var comments []entity.Comment
-	if err := r.db.Preload("User").Model(&entity.Comment{}).Where("post_id = ? AND parent_id IS NULL", postID).Order("created_at DESC").Find(&comments).Error; err != nil {
+	if err := r.db.Preload("User").Model(&entity.Comment{}).Scopes(scopes.ActiveUser("comments.user_id"), scopes.NotBlocked(viewerID, "comments.user_id"), page.Scope("comments")).Where("parent_id = ?", parentCommentID).Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// ListCommentsByPostIDs loads the comments and replies of all the posts at once, newest first
+func (r *commentRepository) ListCommentsByPostIDs(postIDs []uint) ([]entity.Comment, error) {
+	var comments []entity.Comment
+	if len(postIDs) == 0 {
+		return comments, nil
+	}
+
+	if err := r.db.Preload("User").Model(&entity.Comment{}).Scopes(scopes.ActiveUser("comments.user_id")).Where("post_id IN ?", postIDs).Order("created_at DESC").Order("id DESC").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// ListCommentsByParentIDs loads the replies of all the comments at once, newest first
+func (r *commentRepository) ListCommentsByParentIDs(parentIDs []uint) ([]entity.Comment, error) {
+	var comments []entity.Comment
+	if len(parentIDs) == 0 {
+		return comments, nil
+	}
+
+	if err := r.db.Preload("User").Model(&entity.Comment{}).Scopes(scopes.ActiveUser("comments.user_id")).Where("parent_id IN ?", parentIDs).Order("created_at DESC").Order("id DESC").Find(&comments).Error; err != nil {
 		return nil, err
 	}
 	return comments, nil
 }
 
+// PaginateMainCommentsByPostID lists a page of the comments of the post which are not replies, comments of users
+// blocked in either direction or muted by the viewer are left out before the page is cut. The post author is shown
+// even when muted, the viewer opened their post directly.
+func (r *commentRepository) PaginateMainCommentsByPostID(viewerID, postID uint, page pagination.Page) ([]entity.Comment, error) {
+	var comments []entity.Comment
+	if err := r.db.Preload("User").Model(&entity.Comment{}).Scopes(scopes.ActiveUser("comments.user_id"), scopes.NotBlocked(viewerID, "comments.user_id"), notMutedUnlessPostAuthor(viewerID), page.Scope("comments")).
+		Where("post_id = ? AND parent_id IS NULL", postID).
+		Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// CountCommentsByPostIDs counts the comments and replies of all the posts the viewer would see with one grouped query,
+// posts without comments are missing from the map
+func (r *commentRepository) CountCommentsByPostIDs(viewerID uint, postIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(postIDs))
+	if len(postIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		PostID uint
+		Count  int64
+	}
+	if err := r.db.Model(&entity.Comment{}).Select("comments.post_id, COUNT(*) AS count").
+		Scopes(scopes.ActiveUser("comments.user_id"), scopes.NotBlocked(viewerID, "comments.user_id"), notMutedUnlessPostAuthor(viewerID)).
+		Where("comments.post_id IN ?", postIDs).
+		Group("comments.post_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.PostID] = row.Count
+	}
+	return counts, nil
+}
+
 func (r *commentRepository) IsPostExist(postID uint) bool {
 	var post *entity.Post
-	if err := r.db.Model(&entity.Post{}).Where("id =?", postID).First(&post).Error; err != nil || post == nil {
+	if err := r.db.Model(&entity.Post{}).Scopes(scopes.ActiveUser("posts.user_id")).Where("id =?", postID).First(&post).Error; err != nil || post == nil {
 		return false
 	}
 	return true
 }
 
+// GetPost returns the post only when the viewer can see it, gorm.ErrRecordNotFound otherwise
+func (r *commentRepository) GetPost(viewerID, postID uint) (post *entity.Post, err error) {
+	if err = r.db.Model(&entity.Post{}).Scopes(scopes.ActiveUser("posts.user_id"), scopes.VisibleAuthor(viewerID, "posts.user_id"), scopes.PostAudience(viewerID)).Where("posts.id = ?", postID).First(&post).Error; err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
 func (r *commentRepository) Get(id uint) (comment *entity.Comment, err error) {
-	if err = r.db.Model(&entity.Comment{}).Where("id =?", id).First(&comment).Error; err != nil {
+	if err = r.db.Model(&entity.Comment{}).Scopes(scopes.ActiveUser("comments.user_id")).Where("id =?", id).First(&comment).Error; err != nil {
 		return nil, err
 	}
 	return comment, nil
@@ -137,3 +229,12 @@ func (r *commentRepository) DeleteCommentsByPostID(postID uint) error {
 func (r *commentRepository) Migration() error {
 	return r.db.AutoMigrate(entity.Comment{})
 }
+
+// notMutedUnlessPostAuthor leaves out the comments of users the viewer muted, except the ones of the post author who
+// is shown on their own post
+func notMutedUnlessPostAuthor(viewerID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("comments.user_id = (SELECT posts.user_id FROM posts WHERE posts.id = comments.post_id)"+
+			" OR NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = ? AND mutes.muted_id = comments.user_id)", viewerID)
+	}
+}
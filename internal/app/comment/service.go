@@ -2,7 +2,9 @@ package comment
 
 import (
 	"errors"
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
 	"github.com/mehmetokdemir/social-media-api/internal/app/cdn"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"github.com/mehmetokdemir/social-media-api/internal/app/like"
 	"github.com/mehmetokdemir/social-media-api/internal/config"
@@ -12,46 +14,64 @@ import (
 	"time"
 )
 
+// ErrPostNotFound is returned for missing posts and for posts the user can not see alike
+var ErrPostNotFound = errors.New("post not found")
+
 type ICommentService interface {
 	CreateComment(userID uint, comment CreateRequest) (*entity.Comment, error)
 
 	UpdateComment(userID uint, req UpdateRequest) (*entity.Comment, error)
 	UpdateCommentImage(commentID, userID uint, header *multipart.FileHeader) (string, error)
 
-	GetCommentById(id uint) (*entity.Comment, error)
+	GetCommentById(viewerID, id uint) (*entity.Comment, error)
 	DeleteCommentById(userID, id uint) error
+	ForceDeleteCommentById(id uint) error
 
 	ListCommentsByPostID(postID uint) ([]entity.Comment, error)
-	ListMainCommentsByPostID(postID uint) ([]entity.Comment, error)
-	ListCommentsByParentID(parentCommentID uint) ([]entity.Comment, error)
+	ListPostComments(viewerID, postID uint, page pagination.Page) ([]entity.Comment, string, error)
+	ListReplies(viewerID, commentID uint, page pagination.Page) ([]entity.Comment, string, error)
+	ListCommentsByPostIDs(postIDs []uint) ([]entity.Comment, error)
+	ListCommentsByParentIDs(parentIDs []uint) ([]entity.Comment, error)
+	PaginateMainCommentsByPostID(viewerID, postID uint, page pagination.Page) ([]entity.Comment, error)
+	CountCommentsByPostIDs(viewerID uint, postIDs []uint) (map[uint]int64, error)
 	DeleteCommentsByPostID(postID uint) error
 }
 
 type commentService struct {
-	config      config.Config
-	logger      *zap.SugaredLogger
-	repository  ICommentRepository
-	cdnService  cdn.ICdnService
-	likeService like.ILikeService
+	config       config.Config
+	logger       *zap.SugaredLogger
+	repository   ICommentRepository
+	cdnService   cdn.ICdnService
+	likeService  like.ILikeService
+	blockService block.IBlockService
 }
 
-func NewCommentService(repository ICommentRepository, likeService like.ILikeService, cdnService cdn.ICdnService, logger *zap.SugaredLogger, config config.Config) ICommentService {
+func NewCommentService(repository ICommentRepository, likeService like.ILikeService, blockService block.IBlockService, cdnService cdn.ICdnService, logger *zap.SugaredLogger, config config.Config) ICommentService {
 	if repository == nil {
 		return nil
 	}
 
 	return &commentService{
-		config:      config,
-		repository:  repository,
-		logger:      logger,
-		cdnService:  cdnService,
-		likeService: likeService,
+		config:       config,
+		repository:   repository,
+		logger:       logger,
+		cdnService:   cdnService,
+		likeService:  likeService,
+		blockService: blockService,
 	}
 }
 
 func (s *commentService) CreateComment(userID uint, comment CreateRequest) (*entity.Comment, error) {
-	if ok := s.repository.IsPostExist(comment.PostId); !ok {
-		return nil, errors.New("post not found")
+	post, err := s.repository.GetPost(userID, comment.PostId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+
+	if err = s.checkBlocked(userID, post.UserID); err != nil {
+		return nil, err
 	}
 
 	dbComment := entity.Comment{
@@ -61,9 +81,13 @@ func (s *commentService) CreateComment(userID uint, comment CreateRequest) (*ent
 	}
 
 	if comment.ParentID != nil {
-		if _, err := s.repository.Get(*comment.ParentID); err != nil {
+		parent, err := s.repository.Get(*comment.ParentID)
+		if err != nil || parent.PostID != post.ID {
 			return nil, errors.New("parent comment not found")
 		}
+		if err = s.checkBlocked(userID, parent.UserID); err != nil {
+			return nil, err
+		}
 		dbComment.ParenId = comment.ParentID
 	}
 
@@ -117,8 +141,34 @@ func (s *commentService) UpdateCommentImage(commentID, userID uint, file *multip
 	return fileName, err
 }
 
-func (s *commentService) GetCommentById(id uint) (*entity.Comment, error) {
-	return s.repository.Get(id)
+func (s *commentService) GetCommentById(viewerID, id uint) (*entity.Comment, error) {
+	commentByID, err := s.repository.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.checkBlocked(viewerID, commentByID.UserID); err != nil {
+		return nil, err
+	}
+
+	// Comments of a post the viewer can not see look missing too
+	if _, err = s.repository.GetPost(viewerID, commentByID.PostID); err != nil {
+		return nil, err
+	}
+
+	return commentByID, nil
+}
+
+// checkBlocked refuses any interaction between users who blocked each other
+func (s *commentService) checkBlocked(userID, otherUserID uint) error {
+	blocked, err := s.blockService.IsBlocked(userID, otherUserID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return block.ErrBlocked
+	}
+	return nil
 }
 
 func (s *commentService) DeleteCommentById(userID, id uint) error {
@@ -132,6 +182,20 @@ func (s *commentService) DeleteCommentById(userID, id uint) error {
 		return errors.New("do not have permission to delete this comment")
 	}
 
+	return s.deleteComment(commentById)
+}
+
+// ForceDeleteCommentById deletes the comment without ownership check, callers must authorize the request
+func (s *commentService) ForceDeleteCommentById(id uint) error {
+	commentById, err := s.repository.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return s.deleteComment(commentById)
+}
+
+func (s *commentService) deleteComment(commentById *entity.Comment) error {
 	// List sub comments by comment id
 	subComments, err := s.repository.ListCommentsByParentID(commentById.ID)
 	if err != nil {
@@ -175,14 +239,72 @@ func (s *commentService) DeleteCommentsByPostID(postID uint) error {
 	return nil
 }
 
-func (s *commentService) ListCommentsByParentID(parentCommentID uint) ([]entity.Comment, error) {
-	return s.repository.ListCommentsByParentID(parentCommentID)
-}
-
 func (s *commentService) ListCommentsByPostID(postID uint) ([]entity.Comment, error) {
 	return s.repository.ListCommentsByPostID(postID)
 }
 
-func (s *commentService) ListMainCommentsByPostID(postID uint) ([]entity.Comment, error) {
-	return s.repository.ListMainCommentsByPostID(postID)
+// ListPostComments lists the comments of the post the viewer is allowed to see, comments of blocked users are left out
+func (s *commentService) ListPostComments(viewerID, postID uint, page pagination.Page) ([]entity.Comment, string, error) {
+	post, err := s.repository.GetPost(viewerID, postID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err = s.checkBlocked(viewerID, post.UserID); err != nil {
+		return nil, "", err
+	}
+
+	comments, err := s.repository.PaginateCommentsByPostID(viewerID, postID, page)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.visiblePage(comments, page)
+}
+
+// ListReplies lists the replies to the comment, the viewer must be allowed to see both the post and the comment
+func (s *commentService) ListReplies(viewerID, commentID uint, page pagination.Page) ([]entity.Comment, string, error) {
+	parent, err := s.repository.Get(commentID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	post, err := s.repository.GetPost(viewerID, parent.PostID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err = s.checkBlocked(viewerID, post.UserID); err != nil {
+		return nil, "", err
+	}
+	if err = s.checkBlocked(viewerID, parent.UserID); err != nil {
+		return nil, "", err
+	}
+
+	comments, err := s.repository.PaginateCommentsByParentID(viewerID, parent.ID, page)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.visiblePage(comments, page)
+}
+
+// visiblePage trims the fetched comments to the page, comments of blocked users are already left out by the repository
+func (s *commentService) visiblePage(comments []entity.Comment, page pagination.Page) ([]entity.Comment, string, error) {
+	comments, nextCursor := pagination.Next(comments, page, func(com entity.Comment) (time.Time, uint) { return com.CreatedAt, com.ID })
+	return comments, nextCursor, nil
+}
+
+func (s *commentService) ListCommentsByPostIDs(postIDs []uint) ([]entity.Comment, error) {
+	return s.repository.ListCommentsByPostIDs(postIDs)
+}
+
+func (s *commentService) ListCommentsByParentIDs(parentIDs []uint) ([]entity.Comment, error) {
+	return s.repository.ListCommentsByParentIDs(parentIDs)
+}
+
+func (s *commentService) PaginateMainCommentsByPostID(viewerID, postID uint, page pagination.Page) ([]entity.Comment, error) {
+	return s.repository.PaginateMainCommentsByPostID(viewerID, postID, page)
+}
+
+func (s *commentService) CountCommentsByPostIDs(viewerID uint, postIDs []uint) (map[uint]int64, error) {
+	return s.repository.CountCommentsByPostIDs(viewerID, postIDs)
 }
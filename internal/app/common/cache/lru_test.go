@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU[string, int](2)
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+
+	// Reading a makes b the least recently used one
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a is missing")
+	}
+	c.Set("c", 3, time.Minute)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b is not evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("a = %d, %v", v, ok)
+	}
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Fatalf("c = %d, %v", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", c.Len())
+	}
+}
+
+func TestLRUSetRefreshesExistingEntry(t *testing.T) {
+	c := NewLRU[string, int](2)
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+	c.Set("a", 10, time.Minute)
+	c.Set("c", 3, time.Minute)
+
+	if v, ok := c.Get("a"); !ok || v != 10 {
+		t.Fatalf("a = %d, %v", v, ok)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b is not evicted")
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	c := NewLRU[string, bool](2)
+	c.Set("short", true, 10*time.Millisecond)
+	c.Set("long", true, time.Minute)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := c.Get("short"); ok {
+		t.Fatal("expired entry is returned")
+	}
+	if _, ok := c.Get("long"); !ok {
+		t.Fatal("entry which did not expire is missing")
+	}
+	if c.Len() != 1 {
+		t.Fatalf("expired entry is not removed, %d entries", c.Len())
+	}
+}
+
+func TestLRUDelete(t *testing.T) {
+	c := NewLRU[string, bool](2)
+	c.Set("token", false, time.Minute)
+	c.Delete("token")
+	c.Delete("unknown")
+
+	if _, ok := c.Get("token"); ok {
+		t.Fatal("deleted entry is returned")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("expected no entries, got %d", c.Len())
+	}
+}
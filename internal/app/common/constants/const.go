@@ -1,5 +1,9 @@
 package constants
 
 const (
-	UserIdKey = "userID"
+	UserIdKey      = "userID"
+	SessionIdKey   = "sessionID"
+	RoleKey        = "role"
+	PermissionsKey = "permissions"
+	ApiKeyIdKey    = "apiKeyID"
 )
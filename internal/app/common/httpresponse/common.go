@@ -5,6 +5,7 @@ type Response struct {
 	StatusCode int            `json:"status_code" extensions:"x-order=2" example:"200"`
 	Error      *ResponseError `json:"error,omitempty" extensions:"x-order=4"`
 	Data       interface{}    `json:"data,omitempty" extensions:"x-order=5"`
+	NextCursor string         `json:"next_cursor,omitempty" extensions:"x-order=6" example:"eyJ0IjoiMjAyNC0wMS0yMlQxMTozMTo0MFoiLCJpIjo0Mn0"` // Passed as cursor to get the next page of a list, empty on the last page
 }
 
 type ResponseError struct {
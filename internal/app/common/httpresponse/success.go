@@ -15,3 +15,17 @@ func NewSuccess(ctx *fiber.Ctx, statusCode int, data interface{}) Response {
 
 	return *res
 }
+
+// NewPage is the success response of a paginated list
+func NewPage(ctx *fiber.Ctx, statusCode int, data interface{}, nextCursor string) Response {
+	res := new(Response)
+	res.Success = true
+	res.StatusCode = statusCode
+	res.Data = data
+	res.NextCursor = nextCursor
+	_ = ctx.JSON(res)
+
+	_ = ctx.Next()
+
+	return *res
+}
@@ -4,7 +4,13 @@ import "github.com/dgrijalva/jwt-go"
 
 // Token JWT
 type Token struct {
-	Username string
-	UserId   uint
+	Username    string
+	UserId      uint
+	SessionId   uint
+	Role        string
+	Permissions []string `json:",omitempty"`
+	// MfaPending is set on the short-lived token issued between password and second factor checks,
+	// it only allows to complete the login
+	MfaPending bool `json:",omitempty"`
 	jwt.StandardClaims
 }
@@ -0,0 +1,143 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("cursor is not valid")
+
+// Cursor points to the last item of a page, the next page starts right after it. Lists ordered by something other than
+// creation time, like ranked feeds, page with Offset instead. A cursor is of one kind only, it is rejected by lists of
+// the other kind.
+type Cursor struct {
+	CreatedAt time.Time `json:"t,omitempty"`
+	ID        uint      `json:"i,omitempty"`
+	Offset    int       `json:"o,omitempty"`
+}
+
+// Page is the requested page, Cursor is nil for the first page
+type Page struct {
+	Cursor *Cursor
+	Limit  int
+}
+
+// Encode makes the cursor opaque to clients, they only pass it back as it is
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func Decode(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err = json.Unmarshal(raw, &cursor); err != nil || cursor.Offset < 0 {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.isOffset() == cursor.isKeyset() {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func (c Cursor) isKeyset() bool {
+	return c.ID != 0 && !c.CreatedAt.IsZero() && c.Offset == 0
+}
+
+func (c Cursor) isOffset() bool {
+	return c.Offset > 0 && c.ID == 0 && c.CreatedAt.IsZero()
+}
+
+// New builds the page of a list ordered by creation time from the cursor and limit given by the client, the limit
+// falls back to DefaultLimit and can not exceed MaxLimit
+func New(cursor string, limit int) (Page, error) {
+	return newPage(cursor, limit, false)
+}
+
+// NewOffset builds the page of a list paged by offset, see New
+func NewOffset(cursor string, limit int) (Page, error) {
+	return newPage(cursor, limit, true)
+}
+
+func newPage(cursor string, limit int, offset bool) (Page, error) {
+	if limit < 1 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	page := Page{Limit: limit}
+	if cursor != "" {
+		decoded, err := Decode(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		if decoded.isOffset() != offset {
+			return Page{}, ErrInvalidCursor
+		}
+		page.Cursor = decoded
+	}
+	return page, nil
+}
+
+// FromCtx reads the page of a list ordered by creation time from the cursor and limit query parameters
+func FromCtx(ctx *fiber.Ctx) (Page, error) {
+	return New(ctx.Query("cursor"), ctx.QueryInt("limit", DefaultLimit))
+}
+
+// OffsetFromCtx reads the page of a list paged by offset from the cursor and limit query parameters
+func OffsetFromCtx(ctx *fiber.Ctx) (Page, error) {
+	return NewOffset(ctx.Query("cursor"), ctx.QueryInt("limit", DefaultLimit))
+}
+
+// Offset is where a page of an offset paged list starts
+func (p Page) Offset() int {
+	if p.Cursor == nil {
+		return 0
+	}
+	return p.Cursor.Offset
+}
+
+// Scope orders the rows of the table newest first and keeps the ones after the cursor. One row more than the limit is
+// fetched so that Next can tell whether there is another page.
+func (p Page) Scope(table string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if p.Cursor != nil {
+			db = db.Where("("+table+".created_at, "+table+".id) < (?, ?)", p.Cursor.CreatedAt, p.Cursor.ID)
+		}
+		return db.Order(table + ".created_at DESC").Order(table + ".id DESC").Limit(p.Limit + 1)
+	}
+}
+
+// Next trims the rows fetched with Scope to the page and returns the cursor of the next page, empty on the last page
+func Next[T any](rows []T, page Page, key func(row T) (time.Time, uint)) ([]T, string) {
+	if len(rows) <= page.Limit {
+		return rows, ""
+	}
+
+	rows = rows[:page.Limit]
+	createdAt, id := key(rows[len(rows)-1])
+	return rows, Cursor{CreatedAt: createdAt, ID: id}.Encode()
+}
+
+// NextOffset returns the cursor of the page after an offset paged one, rows are fetched with one more than the limit
+func NextOffset[T any](rows []T, page Page) ([]T, string) {
+	if len(rows) <= page.Limit {
+		return rows, ""
+	}
+	return rows[:page.Limit], Cursor{Offset: page.Offset() + page.Limit}.Encode()
+}
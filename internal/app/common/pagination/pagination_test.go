@@ -0,0 +1,104 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewBoundsLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limit, expected int
+	}{
+		{0, DefaultLimit},
+		{-5, DefaultLimit},
+		{1, 1},
+		{MaxLimit, MaxLimit},
+		{MaxLimit + 1, MaxLimit},
+	} {
+		page, err := New("", tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Limit != tc.expected || page.Cursor != nil {
+			t.Fatalf("limit %d: got page %+v, expected limit %d", tc.limit, page, tc.expected)
+		}
+	}
+}
+
+func TestNewRejectsCursorOfOtherKind(t *testing.T) {
+	keyset := Cursor{CreatedAt: time.Now(), ID: 3}.Encode()
+	offset := Cursor{Offset: 40}.Encode()
+
+	if _, err := New(offset, 20); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("keyset list accepts an offset cursor: %v", err)
+	}
+	if _, err := NewOffset(keyset, 20); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("offset list accepts a keyset cursor: %v", err)
+	}
+
+	page, err := NewOffset(offset, 20)
+	if err != nil || page.Offset() != 40 {
+		t.Fatalf("offset cursor is not read back: %+v, %v", page, err)
+	}
+	if page, err = New(keyset, 20); err != nil || page.Cursor.ID != 3 {
+		t.Fatalf("keyset cursor is not read back: %+v, %v", page, err)
+	}
+}
+
+func TestDecodeRejectsMalformedCursors(t *testing.T) {
+	for name, cursor := range map[string]string{
+		"not base64":      "%%%",
+		"not json":        "bm90IGpzb24",
+		"empty":           Cursor{}.Encode(),
+		"negative offset": Cursor{Offset: -20}.Encode(),
+		"mixed kinds":     Cursor{CreatedAt: time.Now(), ID: 3, Offset: 20}.Encode(),
+		"id without time": Cursor{ID: 3}.Encode(),
+	} {
+		if _, err := Decode(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("%s: expected invalid cursor, got %v", name, err)
+		}
+	}
+}
+
+func TestNextTrimsToLimit(t *testing.T) {
+	type row struct {
+		id        uint
+		createdAt time.Time
+	}
+	now := time.Now().UTC()
+	rows := []row{{3, now}, {2, now.Add(-time.Minute)}, {1, now.Add(-2 * time.Minute)}}
+	key := func(r row) (time.Time, uint) { return r.createdAt, r.id }
+
+	if trimmed, next := Next(rows, Page{Limit: 3}, key); len(trimmed) != 3 || next != "" {
+		t.Fatalf("last page has a next cursor: %d rows, %q", len(trimmed), next)
+	}
+
+	trimmed, next := Next(rows, Page{Limit: 2}, key)
+	if len(trimmed) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(trimmed))
+	}
+	cursor, err := Decode(next)
+	if err != nil || cursor.ID != 2 || !cursor.CreatedAt.Equal(rows[1].createdAt) {
+		t.Fatalf("next cursor does not point to the last row: %+v, %v", cursor, err)
+	}
+}
+
+func TestNextOffsetAdvancesByLimit(t *testing.T) {
+	page, err := NewOffset(Cursor{Offset: 10}.Encode(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, next := NextOffset(make([]int, 5), page); next != "" {
+		t.Fatalf("last page has a next cursor %q", next)
+	}
+
+	trimmed, next := NextOffset(make([]int, 6), page)
+	if len(trimmed) != 5 {
+		t.Fatalf("expected 5 rows, got %d", len(trimmed))
+	}
+	if cursor, err := Decode(next); err != nil || cursor.Offset != 15 {
+		t.Fatalf("next cursor does not start after the page: %+v, %v", cursor, err)
+	}
+}
@@ -0,0 +1,56 @@
+package rbac
+
+import "github.com/mehmetokdemir/social-media-api/internal/app/entity"
+
+type Permission string
+
+const (
+	PermissionUsersRead         Permission = "users:read"
+	PermissionUsersSuspend      Permission = "users:suspend"
+	PermissionUsersRole         Permission = "users:role"
+	PermissionPostsDeleteAny    Permission = "posts:delete_any"
+	PermissionCommentsDeleteAny Permission = "comments:delete_any"
+	PermissionLockoutsManage    Permission = "lockouts:manage"
+)
+
+var rolePermissions = map[entity.RoleEnum][]Permission{
+	entity.RoleUser: {},
+	entity.RoleModerator: {
+		PermissionUsersRead,
+		PermissionUsersSuspend,
+		PermissionPostsDeleteAny,
+		PermissionCommentsDeleteAny,
+		PermissionLockoutsManage,
+	},
+	entity.RoleAdmin: {
+		PermissionUsersRead,
+		PermissionUsersSuspend,
+		PermissionUsersRole,
+		PermissionPostsDeleteAny,
+		PermissionCommentsDeleteAny,
+		PermissionLockoutsManage,
+	},
+}
+
+// PermissionsOf returns permissions granted to the role, unknown roles get no permission
+func PermissionsOf(role entity.RoleEnum) []string {
+	var permissions []string
+	for _, permission := range rolePermissions[role] {
+		permissions = append(permissions, string(permission))
+	}
+	return permissions
+}
+
+func IsValidRole(role entity.RoleEnum) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func HasPermission(permissions []string, permission Permission) bool {
+	for _, p := range permissions {
+		if p == string(permission) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package scopes
+
+import (
+	"database/sql"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"gorm.io/gorm"
+)
+
+// PostAudience keeps the posts the viewer is in the audience of. The author always sees their posts, others see them
+// by the visibility of the post: public posts, posts for friends when they are friends with the author and custom
+// posts when they are picked. A post shared with a friend list is further limited to the members whose friendship
+// with the author is still accepted.
+func PostAudience(viewerID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(posts.user_id = @viewer OR ("+
+			"(posts.visibility = @public"+
+			" OR (posts.visibility = @friends AND EXISTS (SELECT 1 FROM friendships WHERE ((friendships.sender_id = @viewer AND friendships.receiver_id = posts.user_id)"+
+			" OR (friendships.receiver_id = @viewer AND friendships.sender_id = posts.user_id))"+
+			" AND friendships.status = @accepted AND friendships.deleted_at IS NULL))"+
+			" OR (posts.visibility = @custom AND EXISTS (SELECT 1 FROM post_audience_members"+
+			" WHERE post_audience_members.post_id = posts.id AND post_audience_members.user_id = @viewer AND post_audience_members.deleted_at IS NULL)))"+
+			" AND (posts.friend_list_id IS NULL"+
+			" OR EXISTS (SELECT 1 FROM friend_list_members"+
+			" JOIN friendships ON friendships.id = friend_list_members.friendship_id AND friendships.status = @accepted AND friendships.deleted_at IS NULL"+
+			" WHERE friend_list_members.friend_list_id = posts.friend_list_id AND friend_list_members.member_id = @viewer"+
+			" AND friend_list_members.deleted_at IS NULL))))",
+			sql.Named("viewer", viewerID), sql.Named("accepted", entity.FriendshipStatusAccepted),
+			sql.Named("public", entity.PostVisibilityPublic), sql.Named("friends", entity.PostVisibilityFriends),
+			sql.Named("custom", entity.PostVisibilityCustom))
+	}
+}
+
+// VisiblePost keeps the posts the viewer can open: the author is active, neither of them blocked the other, the author's
+// account is visible to the viewer and the viewer is in the audience of the post. Anything else looks missing.
+func VisiblePost(viewerID uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(ActiveUser("posts.user_id"), NotBlocked(viewerID, "posts.user_id"), VisibleAuthor(viewerID, "posts.user_id"), PostAudience(viewerID))
+	}
+}
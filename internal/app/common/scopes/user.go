@@ -0,0 +1,45 @@
+package scopes
+
+import (
+	"database/sql"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"gorm.io/gorm"
+)
+
+// ActiveUser keeps the rows whose user column, qualified with its table like posts.user_id, does not point to a
+// deactivated user. Content of deactivated users is hidden this way until they log in again.
+func ActiveUser(column string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("NOT EXISTS (SELECT 1 FROM users WHERE users.id = " + column + " AND users.deactivated_at IS NOT NULL)")
+	}
+}
+
+// NotBlocked keeps the rows whose user column points to a user who neither blocked the viewer nor was blocked by them
+func NotBlocked(viewerID uint, column string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @viewer AND blocks.blocked_id = "+column+")"+
+			" OR (blocks.blocker_id = "+column+" AND blocks.blocked_id = @viewer))", sql.Named("viewer", viewerID))
+	}
+}
+
+// NotMuted keeps the rows whose user column points to a user the viewer did not mute
+func NotMuted(viewerID uint, column string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = @viewer AND mutes.muted_id = "+column+")", sql.Named("viewer", viewerID))
+	}
+}
+
+// VisibleAuthor keeps the rows whose user column points to the viewer, to a public user, or to a private user the viewer
+// follows or is friends with
+func VisibleAuthor(viewerID uint, column string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("("+column+" = @viewer"+
+			" OR NOT EXISTS (SELECT 1 FROM users WHERE users.id = "+column+" AND users.is_private)"+
+			" OR EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = @viewer AND follows.followee_id = "+column+
+			" AND follows.status = @accepted AND follows.deleted_at IS NULL)"+
+			" OR EXISTS (SELECT 1 FROM friendships WHERE ((friendships.sender_id = @viewer AND friendships.receiver_id = "+column+")"+
+			" OR (friendships.receiver_id = @viewer AND friendships.sender_id = "+column+"))"+
+			" AND friendships.status = @accepted AND friendships.deleted_at IS NULL))",
+			sql.Named("viewer", viewerID), sql.Named("accepted", entity.FriendshipStatusAccepted))
+	}
+}
@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type ApiKeyScopeEnum string
+
+const (
+	ApiKeyScopeRead            ApiKeyScopeEnum = "read"
+	ApiKeyScopePostWrite       ApiKeyScopeEnum = "post:write"
+	ApiKeyScopeCommentWrite    ApiKeyScopeEnum = "comment:write"
+	ApiKeyScopeLikeWrite       ApiKeyScopeEnum = "like:write"
+	ApiKeyScopeFriendshipWrite ApiKeyScopeEnum = "friendship:write"
+)
+
+// ApiKey DB Model
+type ApiKey struct {
+	gorm.Model
+	UserID     uint       `gorm:"column:user_id;index"`
+	User       User       `gorm:"foreignkey:UserID"`
+	Name       string     `gorm:"column:name"`
+	Prefix     string     `gorm:"column:prefix"` // First characters of the key to tell keys apart, the key itself is not stored
+	KeyHash    string     `gorm:"column:key_hash;uniqueIndex"`
+	Scopes     string     `gorm:"column:scopes"` // Comma separated ApiKeyScopeEnum values
+	ExpiresAt  *time.Time `gorm:"column:expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+}
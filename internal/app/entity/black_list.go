@@ -1,5 +1,8 @@
 package entity
 
+import "time"
+
 type BlackList struct {
-	Token string `gorm:"primaryKey;autoIncrement:false"`
+	Token     string    `gorm:"primaryKey;autoIncrement:false"`
+	ExpiresAt time.Time `gorm:"column:expires_at;index"` // Expiry of the token, the row is purged after it
 }
@@ -0,0 +1,21 @@
+package entity
+
+import "gorm.io/gorm"
+
+// Block DB Model, users on either side of a block can not reach each other
+type Block struct {
+	gorm.Model
+	BlockerID uint `gorm:"column:blocker_id;uniqueIndex:idx_block_pair"`
+	Blocker   User `gorm:"foreignKey:BlockerID"`
+	BlockedID uint `gorm:"column:blocked_id;uniqueIndex:idx_block_pair;index"`
+	Blocked   User `gorm:"foreignKey:BlockedID"`
+}
+
+// Mute DB Model, content of the muted user is hidden from the feed of the muter only
+type Mute struct {
+	gorm.Model
+	MuterID uint `gorm:"column:muter_id;uniqueIndex:idx_mute_pair"`
+	Muter   User `gorm:"foreignKey:MuterID"`
+	MutedID uint `gorm:"column:muted_id;uniqueIndex:idx_mute_pair"`
+	Muted   User `gorm:"foreignKey:MutedID"`
+}
@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type DataExportStatusEnum string
+
+const (
+	DataExportStatusPending    DataExportStatusEnum = "pending"
+	DataExportStatusProcessing DataExportStatusEnum = "processing"
+	DataExportStatusReady      DataExportStatusEnum = "ready"
+	DataExportStatusFailed     DataExportStatusEnum = "failed"
+)
+
+// DataExport DB Model, an archive of the data of a user prepared in the background
+type DataExport struct {
+	gorm.Model
+	UserID      uint                 `gorm:"column:user_id;index"`
+	User        User                 `gorm:"foreignkey:UserID"`
+	Status      DataExportStatusEnum `gorm:"column:status;index"`
+	FilePath    string               `gorm:"column:file_path"` // Public id of the archive in the cdn
+	Error       string               `gorm:"column:error"`
+	ClaimedAt   *time.Time           `gorm:"column:claimed_at"` // Instance building the archive took it at this time
+	CompletedAt *time.Time           `gorm:"column:completed_at"`
+	ExpiresAt   *time.Time           `gorm:"column:expires_at"` // Archive is removed after this time
+}
@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// ExternalIdentity DB Model, an account of an OpenID Connect provider linked to a user
+type ExternalIdentity struct {
+	gorm.Model
+	UserID   uint   `gorm:"column:user_id;index"`
+	User     User   `gorm:"foreignkey:UserID"`
+	Provider string `gorm:"column:provider;uniqueIndex:idx_external_identity_provider_subject"`
+	Subject  string `gorm:"column:subject;uniqueIndex:idx_external_identity_provider_subject"`
+	Email    string `gorm:"column:email"`
+}
+
+// OidcState DB Model, an authorization request waiting for the provider to redirect back
+type OidcState struct {
+	gorm.Model
+	StateHash    string     `gorm:"column:state_hash;uniqueIndex"`
+	Provider     string     `gorm:"column:provider"`
+	CodeVerifier string     `gorm:"column:code_verifier"` // PKCE verifier, the provider only sees its challenge
+	Nonce        string     `gorm:"column:nonce"`
+	ExpiresAt    time.Time  `gorm:"column:expires_at"`
+	UsedAt       *time.Time `gorm:"column:used_at"`
+}
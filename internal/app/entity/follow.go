@@ -0,0 +1,14 @@
+package entity
+
+import "gorm.io/gorm"
+
+// Follow DB Model, a one way relationship. Follows of public accounts are accepted right away, follows of private
+// accounts wait for approval with the same statuses as friendships.
+type Follow struct {
+	gorm.Model
+	FollowerID uint                 `gorm:"column:follower_id;uniqueIndex:idx_follow_pair"`
+	Follower   User                 `gorm:"foreignKey:FollowerID"`
+	FolloweeID uint                 `gorm:"column:followee_id;uniqueIndex:idx_follow_pair;index"`
+	Followee   User                 `gorm:"foreignKey:FolloweeID"`
+	Status     FriendshipStatusEnum `gorm:"column:status"`
+}
@@ -0,0 +1,21 @@
+package entity
+
+import "gorm.io/gorm"
+
+// FriendList DB Model, a named group of friends of the user like close friends or family
+type FriendList struct {
+	gorm.Model
+	UserID uint   `gorm:"column:user_id;index"`
+	User   User   `gorm:"foreignKey:UserID"`
+	Name   string `gorm:"column:name"`
+}
+
+// FriendListMember DB Model, a member counts only while the friendship it is keyed on is accepted
+type FriendListMember struct {
+	gorm.Model
+	FriendListID uint       `gorm:"column:friend_list_id;uniqueIndex:idx_friend_list_member"`
+	FriendshipID uint       `gorm:"column:friendship_id;uniqueIndex:idx_friend_list_member"`
+	Friendship   Friendship `gorm:"foreignKey:FriendshipID"`
+	MemberID     uint       `gorm:"column:member_id;index"`
+	Member       User       `gorm:"foreignKey:MemberID"`
+}
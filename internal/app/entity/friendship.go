@@ -13,9 +13,9 @@ const (
 // Friendship DB Model
 type Friendship struct {
 	gorm.Model
-	SenderID   uint
+	SenderID   uint `gorm:"index"`
 	Sender     User `gorm:"foreignKey:SenderID"`
-	ReceiverID uint
+	ReceiverID uint `gorm:"index"`
 	Receiver   User `gorm:"foreignKey:ReceiverID"`
 	Status     FriendshipStatusEnum
 }
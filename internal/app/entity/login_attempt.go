@@ -0,0 +1,31 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// LoginAttempt DB Model, a failed login attempt counted towards a lockout
+type LoginAttempt struct {
+	gorm.Model
+	Username string `gorm:"column:username;index"`
+	IP       string `gorm:"column:ip;index"`
+}
+
+type LockoutScopeEnum string
+
+const (
+	LockoutScopeAccount LockoutScopeEnum = "account"
+	LockoutScopeIP      LockoutScopeEnum = "ip"
+)
+
+// Lockout DB Model, an event of too many failed login attempts for an account or an ip
+type Lockout struct {
+	gorm.Model
+	Scope        LockoutScopeEnum `gorm:"column:scope;index"`
+	Subject      string           `gorm:"column:subject;index"`
+	FailureCount int64            `gorm:"column:failure_count"`
+	LockedUntil  time.Time        `gorm:"column:locked_until"`
+	ClearedAt    *time.Time       `gorm:"column:cleared_at"`
+	ClearedBy    *uint            `gorm:"column:cleared_by"`
+}
@@ -2,11 +2,31 @@ package entity
 
 import "gorm.io/gorm"
 
+type PostVisibilityEnum string
+
+const (
+	PostVisibilityPublic  PostVisibilityEnum = "public"  // Everyone who can see the author
+	PostVisibilityFriends PostVisibilityEnum = "friends" // Friends of the author
+	PostVisibilityOnlyMe  PostVisibilityEnum = "only_me" // Only the author
+	PostVisibilityCustom  PostVisibilityEnum = "custom"  // Users picked by the author, see PostAudienceMember
+)
+
 // Post DB Model
 type Post struct {
 	gorm.Model
-	UserID uint   `gorm:"column:user_id"`
-	User   User   `gorm:"foreignkey:UserID"`
-	Body   string `gorm:"column:body"`
-	Image  string `gorm:"column:image"`
+	UserID     uint               `gorm:"column:user_id"`
+	User       User               `gorm:"foreignkey:UserID"`
+	Body       string             `gorm:"column:body"`
+	Image      string             `gorm:"column:image"`
+	Visibility PostVisibilityEnum `gorm:"column:visibility;default:public"`
+	// FriendListID limits the audience to the author and the members of the list, everyone who can see the author otherwise
+	FriendListID *uint                `gorm:"column:friend_list_id;index"`
+	Audience     []PostAudienceMember `gorm:"foreignKey:PostID"`
+}
+
+// PostAudienceMember DB Model, a user who can see a post with custom visibility
+type PostAudienceMember struct {
+	gorm.Model
+	PostID uint `gorm:"column:post_id;uniqueIndex:idx_post_audience_member"`
+	UserID uint `gorm:"column:user_id;uniqueIndex:idx_post_audience_member;index"`
 }
@@ -0,0 +1,15 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// RecoveryCode DB Model, one time codes to pass two-factor authentication without the authenticator
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `gorm:"column:user_id;index"`
+	User     User       `gorm:"foreignkey:UserID"`
+	CodeHash string     `gorm:"column:code_hash"`
+	UsedAt   *time.Time `gorm:"column:used_at"`
+}
@@ -0,0 +1,20 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// RefreshToken DB Model
+type RefreshToken struct {
+	gorm.Model
+	UserID      uint       `gorm:"column:user_id;index"`
+	User        User       `gorm:"foreignkey:UserID"`
+	TokenHash   string     `gorm:"column:token_hash;uniqueIndex"`
+	FamilyID    string     `gorm:"column:family_id;index"`
+	SessionID   uint       `gorm:"column:session_id;index"`
+	AccessToken string     `gorm:"column:access_token;index"` // Access token issued together with this refresh token
+	ExpiresAt   time.Time  `gorm:"column:expires_at"`
+	RotatedAt   *time.Time `gorm:"column:rotated_at"`
+	RevokedAt   *time.Time `gorm:"column:revoked_at"`
+}
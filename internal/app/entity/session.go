@@ -0,0 +1,18 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Session DB Model
+type Session struct {
+	gorm.Model
+	UserID     uint       `gorm:"column:user_id;index"`
+	User       User       `gorm:"foreignkey:UserID"`
+	DeviceName string     `gorm:"column:device_name"`
+	UserAgent  string     `gorm:"column:user_agent"`
+	IP         string     `gorm:"column:ip"`
+	LastSeenAt time.Time  `gorm:"column:last_seen_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// SigningKey DB Model, asymmetric keys to sign and verify jwt tokens
+type SigningKey struct {
+	gorm.Model
+	Kid        string     `gorm:"column:kid;uniqueIndex"`
+	Algorithm  string     `gorm:"column:algorithm"`
+	PrivateKey string     `gorm:"column:private_key" json:"-"` // PEM encoded
+	PublicKey  string     `gorm:"column:public_key"`           // PEM encoded
+	RetiredAt  *time.Time `gorm:"column:retired_at"`           // Key is not used for signing after this time
+	ExpiresAt  *time.Time `gorm:"column:expires_at"`           // Key is not used for verification after this time
+}
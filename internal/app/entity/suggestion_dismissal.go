@@ -0,0 +1,10 @@
+package entity
+
+import "gorm.io/gorm"
+
+// SuggestionDismissal DB Model, a dismissed user is not suggested as a friend to the user again
+type SuggestionDismissal struct {
+	gorm.Model
+	UserID      uint `gorm:"column:user_id;uniqueIndex:idx_suggestion_dismissal_pair"`
+	DismissedID uint `gorm:"column:dismissed_id;uniqueIndex:idx_suggestion_dismissal_pair"`
+}
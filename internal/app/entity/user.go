@@ -1,15 +1,50 @@
 package entity
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type RoleEnum string
+
+const (
+	RoleUser      RoleEnum = "user"
+	RoleModerator RoleEnum = "moderator"
+	RoleAdmin     RoleEnum = "admin"
+)
+
+type DeletionPolicyEnum string
+
+const (
+	DeletionPolicyDelete    DeletionPolicyEnum = "delete"    // Posts, comments and likes of the user are deleted with the account
+	DeletionPolicyAnonymize DeletionPolicyEnum = "anonymize" // Content is kept but no longer tells who wrote it
+)
 
 // User DB Model
 type User struct {
 	gorm.Model
-	FirstName    string `gorm:"column:first_name"`
-	LastName     string `gorm:"column:last_name"`
-	Email        string `gorm:"uniqueIndex"`
-	Username     string `gorm:"uniqueIndex"`
-	Password     string `gorm:"column:password"`
-	PhoneNumber  string `gorm:"column:phone_number"`
-	ProfilePhoto string `gorm:"column:profile_photo"`
+	FirstName       string     `gorm:"column:first_name"`
+	LastName        string     `gorm:"column:last_name"`
+	Email           string     `gorm:"uniqueIndex"`
+	Username        string     `gorm:"uniqueIndex"`
+	Password        string     `gorm:"column:password"`
+	Passwordless    bool       `gorm:"column:passwordless"` // Signed up through an identity provider and never set a password
+	PhoneNumber     string     `gorm:"column:phone_number"`
+	ProfilePhoto    string     `gorm:"column:profile_photo"`
+	EmailVerifiedAt *time.Time `gorm:"column:email_verified_at"`
+	TotpSecret      string     `gorm:"column:totp_secret" json:"-"`
+	TotpEnabledAt   *time.Time `gorm:"column:totp_enabled_at" json:"-"`
+	TotpLastStep    int64      `gorm:"column:totp_last_step" json:"-"` // Last accepted time step, a code can not be replayed
+	Role            RoleEnum   `gorm:"column:role;default:user"`
+	SuspendedAt     *time.Time `gorm:"column:suspended_at"`
+	Bio             string     `gorm:"column:bio"`
+	Location        string     `gorm:"column:location"`
+	Website         string     `gorm:"column:website"`
+	Birthday        *time.Time `gorm:"column:birthday;type:date"`
+	Pronouns        string     `gorm:"column:pronouns"`
+	CoverPhoto      string     `gorm:"column:cover_photo"`
+	PendingEmail    string     `gorm:"column:pending_email"`            // New email waiting to be verified, the current one is used until then
+	DeletionDueAt   *time.Time `gorm:"column:deletion_due_at;index"`    // Account is deleted at this time unless the user cancels
+	DeactivatedAt   *time.Time `gorm:"column:deactivated_at;index"`     // User and their content are hidden until they log in again
+	IsPrivate       bool       `gorm:"column:is_private;default:false"` // Follows need approval and only followers and friends see the posts
 }
@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type UserTokenPurpose string
+
+const (
+	UserTokenPurposeEmailVerification UserTokenPurpose = "email_verification"
+	UserTokenPurposePasswordReset     UserTokenPurpose = "password_reset"
+	UserTokenPurposeEmailChange       UserTokenPurpose = "email_change"
+)
+
+// UserToken DB Model, single use tokens sent to users by email
+type UserToken struct {
+	gorm.Model
+	UserID    uint             `gorm:"column:user_id;index"`
+	User      User             `gorm:"foreignkey:UserID"`
+	Purpose   UserTokenPurpose `gorm:"column:purpose"`
+	TokenHash string           `gorm:"column:token_hash;uniqueIndex"`
+	ExpiresAt time.Time        `gorm:"column:expires_at"`
+	UsedAt    *time.Time       `gorm:"column:used_at"`
+}
@@ -0,0 +1,15 @@
+package entity
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// UsernameAlias DB Model, a previous username of a user which still leads to the user for a grace period
+type UsernameAlias struct {
+	gorm.Model
+	UserID    uint      `gorm:"column:user_id;index"`
+	User      User      `gorm:"foreignkey:UserID"`
+	Username  string    `gorm:"column:username;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"column:expires_at"`
+}
@@ -0,0 +1,17 @@
+package follow
+
+import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+)
+
+type FollowResponse struct {
+	Status entity.FriendshipStatusEnum `json:"status" extensions:"x-order=1" example:"accepted"` // Accepted right away for public accounts, pending for private ones
+}
+
+type ReadFollowResponse struct {
+	Id        uint                        `json:"id" extensions:"x-order=1" example:"1"`
+	User      httpmodel.CommonUser        `json:"user" extensions:"x-order=2"` // Follower or followed user depending on the list
+	Status    entity.FriendshipStatusEnum `json:"status" extensions:"x-order=3" example:"accepted"`
+	CreatedAt string                      `json:"created_at" extensions:"x-order=4" example:"2024-01-22T11:31:40+03:00"`
+}
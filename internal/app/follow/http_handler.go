@@ -0,0 +1,287 @@
+package follow
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
+	"github.com/mehmetokdemir/social-media-api/internal/middleware"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type HttpHandler struct {
+	followService     IFollowService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
+}
+
+func NewHttpHandler(guardService guard.IGuardService, followService IFollowService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, followService: followService, logger: logger, signingKeyService: signingKeyService}
+}
+
+func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
+	followGroup := app.Group("/follow").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
+	followGroup.Get("/requests", h.ListFollowRequests)
+	followGroup.Post("/requests/:follow_id/accept", h.AcceptFollowRequest)
+	followGroup.Post("/requests/:follow_id/reject", h.RejectFollowRequest)
+	followGroup.Post("/:user_id", h.Follow)
+	followGroup.Delete("/:user_id", h.Unfollow)
+	followGroup.Get("/:user_id/followers", h.ListFollowers)
+	followGroup.Get("/:user_id/following", h.ListFollowing)
+}
+
+// Follow godoc
+// @Summary Follow user
+// @Description Follow a user. Public accounts are followed right away, private accounts receive a follow request which they can accept or reject.
+// @Tags Follow
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user to follow"
+// @Success 200 {object} FollowResponse "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Failure 500
+// @Router /follow/{user_id} [post]
+func (h *HttpHandler) Follow(ctx *fiber.Ctx) error {
+	userID, targetID, ok := h.parseRequest(ctx, "user_id")
+	if !ok {
+		return nil
+	}
+
+	rsp, err := h.followService.Follow(userID, targetID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrSelfFollow):
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not follow user", err.Error(), http.StatusBadRequest))
+		case errors.Is(err, block.ErrBlocked):
+			return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("can not follow user", err.Error(), http.StatusForbidden))
+		case errors.Is(err, ErrUserNotFound):
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not follow user", err.Error(), http.StatusNotFound))
+		case errors.Is(err, ErrAlreadyFollowing):
+			return ctx.Status(fiber.StatusConflict).JSON(httpresponse.NewError("can not follow user", err.Error(), http.StatusConflict))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not follow user", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// Unfollow godoc
+// @Summary Unfollow user
+// @Description Unfollow a user or withdraw a pending follow request
+// @Tags Follow
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user to unfollow"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /follow/{user_id} [delete]
+func (h *HttpHandler) Unfollow(ctx *fiber.Ctx) error {
+	userID, targetID, ok := h.parseRequest(ctx, "user_id")
+	if !ok {
+		return nil
+	}
+
+	if err := h.followService.Unfollow(userID, targetID); err != nil {
+		if errors.Is(err, ErrNotFollowing) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not unfollow user", err.Error(), http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not unfollow user", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// ListFollowers godoc
+// @Summary List followers
+// @Description List followers of a user. Followers of a private account are only visible to the account, its followers and its friends.
+// @Tags Follow
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user"
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadFollowResponse "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /follow/{user_id}/followers [get]
+func (h *HttpHandler) ListFollowers(ctx *fiber.Ctx) error {
+	return h.listFollows(ctx, h.followService.ListFollowers, "can not get followers")
+}
+
+// ListFollowing godoc
+// @Summary List following
+// @Description List users a user follows. Lists of a private account are only visible to the account, its followers and its friends.
+// @Tags Follow
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the user"
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadFollowResponse "Success"
+// @Failure 400
+// @Failure 403
+// @Failure 404
+// @Failure 500
+// @Router /follow/{user_id}/following [get]
+func (h *HttpHandler) ListFollowing(ctx *fiber.Ctx) error {
+	return h.listFollows(ctx, h.followService.ListFollowing, "can not get following")
+}
+
+// ListFollowRequests godoc
+// @Summary List follow requests
+// @Description List pending follow requests sent to the user
+// @Tags Follow
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadFollowResponse "Success"
+// @Failure 400
+// @Failure 500
+// @Router /follow/requests [get]
+func (h *HttpHandler) ListFollowRequests(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get follow requests", err.Error(), http.StatusBadRequest))
+	}
+
+	rsp, nextCursor, err := h.followService.ListFollowRequests(userID, page)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get follow requests", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, rsp, nextCursor))
+}
+
+// AcceptFollowRequest godoc
+// @Summary Accept follow request
+// @Description Accept a pending follow request sent to the user
+// @Tags Follow
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param follow_id path integer true "ID of the follow request"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /follow/requests/{follow_id}/accept [post]
+func (h *HttpHandler) AcceptFollowRequest(ctx *fiber.Ctx) error {
+	return h.answerFollowRequest(ctx, entity.FriendshipStatusAccepted, "can not accept follow request")
+}
+
+// RejectFollowRequest godoc
+// @Summary Reject follow request
+// @Description Reject a pending follow request sent to the user, the follower can send a new request later
+// @Tags Follow
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param follow_id path integer true "ID of the follow request"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /follow/requests/{follow_id}/reject [post]
+func (h *HttpHandler) RejectFollowRequest(ctx *fiber.Ctx) error {
+	return h.answerFollowRequest(ctx, entity.FriendshipStatusRejected, "can not reject follow request")
+}
+
+func (h *HttpHandler) answerFollowRequest(ctx *fiber.Ctx, status entity.FriendshipStatusEnum, message string) error {
+	userID, followID, ok := h.parseRequest(ctx, "follow_id")
+	if !ok {
+		return nil
+	}
+
+	if err := h.followService.AnswerFollowRequest(userID, followID, status); err != nil {
+		switch {
+		case errors.Is(err, ErrFollowRequestAnswer):
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError(message, err.Error(), http.StatusBadRequest))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError(message, err.Error(), http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError(message, err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+func (h *HttpHandler) listFollows(ctx *fiber.Ctx, list func(viewerID, userID uint, page pagination.Page) ([]ReadFollowResponse, string, error), message string) error {
+	viewerID, userID, ok := h.parseRequest(ctx, "user_id")
+	if !ok {
+		return nil
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError(message, err.Error(), http.StatusBadRequest))
+	}
+
+	rsp, nextCursor, err := list(viewerID, userID, page)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPrivateAccount):
+			return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError(message, err.Error(), http.StatusForbidden))
+		case errors.Is(err, ErrUserNotFound):
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError(message, err.Error(), http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError(message, err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, rsp, nextCursor))
+}
+
+// parseRequest checks the token and returns the logged-in user with the ID in the given path parameter, the error
+// response is already written when it is not ok
+func (h *HttpHandler) parseRequest(ctx *fiber.Ctx, param string) (uint, uint, bool) {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		_ = ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+		return 0, 0, false
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		_ = ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(ctx.Params(param), 10, 64)
+	if err != nil {
+		_ = ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse "+param, err.Error(), http.StatusBadRequest))
+		return 0, 0, false
+	}
+
+	return userID, uint(id), true
+}
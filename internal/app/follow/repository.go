@@ -0,0 +1,135 @@
+package follow
+
+import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/scopes"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type IFollowRepository interface {
+	Create(follow entity.Follow) (*entity.Follow, error)
+	Get(id uint) (*entity.Follow, error)
+	GetByUsers(followerID, followeeID uint) (*entity.Follow, error)
+	UpdateStatus(id uint, status entity.FriendshipStatusEnum) error
+	Delete(followerID, followeeID uint) (bool, error)
+	ListFollowers(viewerID, userID uint, status entity.FriendshipStatusEnum, page pagination.Page) ([]entity.Follow, error)
+	ListFollowing(viewerID, userID uint, page pagination.Page) ([]entity.Follow, error)
+	IsFriend(firstUserID, secondUserID uint) bool
+	CountFollowers(userID uint) (int64, error)
+	CountFollowing(userID uint) (int64, error)
+	GetUserByID(userID uint) (*entity.User, error)
+	Migration() error
+}
+
+type followRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewRepository(db *gorm.DB, logger *zap.SugaredLogger) IFollowRepository {
+	return &followRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *followRepository) Create(follow entity.Follow) (*entity.Follow, error) {
+	if err := r.db.Create(&follow).Error; err != nil {
+		return nil, err
+	}
+	return &follow, nil
+}
+
+func (r *followRepository) Get(id uint) (follow *entity.Follow, err error) {
+	if err = r.db.Where("id = ?", id).First(&follow).Error; err != nil {
+		return nil, err
+	}
+	return follow, nil
+}
+
+// GetByUsers returns nil without error when the user does not follow the other one
+func (r *followRepository) GetByUsers(followerID, followeeID uint) (*entity.Follow, error) {
+	var follows []entity.Follow
+	if err := r.db.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Limit(1).Find(&follows).Error; err != nil {
+		return nil, err
+	}
+	if len(follows) == 0 {
+		return nil, nil
+	}
+	return &follows[0], nil
+}
+
+func (r *followRepository) UpdateStatus(id uint, status entity.FriendshipStatusEnum) error {
+	return r.db.Model(&entity.Follow{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// Delete removes the follow for good, so that the pair can follow again later without hitting the unique index
+func (r *followRepository) Delete(followerID, followeeID uint) (bool, error) {
+	result := r.db.Unscoped().Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&entity.Follow{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListFollowers lists a page of the followers of the user, users blocked in either direction by the viewer are left out
+// before the page is cut
+func (r *followRepository) ListFollowers(viewerID, userID uint, status entity.FriendshipStatusEnum, page pagination.Page) ([]entity.Follow, error) {
+	var follows []entity.Follow
+	if err := r.db.Preload("Follower").Model(&entity.Follow{}).
+		Scopes(scopes.ActiveUser("follows.follower_id"), scopes.NotBlocked(viewerID, "follows.follower_id"), page.Scope("follows")).
+		Where("followee_id = ? AND status = ?", userID, status).
+		Find(&follows).Error; err != nil {
+		return nil, err
+	}
+	return follows, nil
+}
+
+// ListFollowing lists a page of the users the user follows, see ListFollowers
+func (r *followRepository) ListFollowing(viewerID, userID uint, page pagination.Page) ([]entity.Follow, error) {
+	var follows []entity.Follow
+	if err := r.db.Preload("Followee").Model(&entity.Follow{}).
+		Scopes(scopes.ActiveUser("follows.followee_id"), scopes.NotBlocked(viewerID, "follows.followee_id"), page.Scope("follows")).
+		Where("follower_id = ? AND status = ?", userID, entity.FriendshipStatusAccepted).
+		Find(&follows).Error; err != nil {
+		return nil, err
+	}
+	return follows, nil
+}
+
+func (r *followRepository) IsFriend(firstUserID, secondUserID uint) bool {
+	var count int64
+	r.db.Model(&entity.Friendship{}).
+		Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)", firstUserID, secondUserID, secondUserID, firstUserID).
+		Where("status = ?", entity.FriendshipStatusAccepted).
+		Count(&count)
+	return count > 0
+}
+
+func (r *followRepository) CountFollowers(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Follow{}).
+		Scopes(scopes.ActiveUser("follows.follower_id")).
+		Where("followee_id = ? AND status = ?", userID, entity.FriendshipStatusAccepted).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *followRepository) CountFollowing(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Follow{}).
+		Scopes(scopes.ActiveUser("follows.followee_id")).
+		Where("follower_id = ? AND status = ?", userID, entity.FriendshipStatusAccepted).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *followRepository) GetUserByID(userID uint) (user *entity.User, err error) {
+	if err = r.db.Where("id = ? AND deactivated_at IS NULL AND suspended_at IS NULL", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *followRepository) Migration() error {
+	return r.db.AutoMigrate(entity.Follow{})
+}
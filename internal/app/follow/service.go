@@ -0,0 +1,221 @@
+package follow
+
+import (
+	"errors"
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrSelfFollow          = errors.New("can not follow yourself")
+	ErrAlreadyFollowing    = errors.New("already following or requested to follow the user")
+	ErrNotFollowing        = errors.New("not following the user")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrPrivateAccount      = errors.New("account is private")
+	ErrFollowRequestAnswer = errors.New("only pending follow requests sent to the user can be answered")
+)
+
+type IFollowService interface {
+	Follow(userID, followeeID uint) (*FollowResponse, error)
+	Unfollow(userID, followeeID uint) error
+	ListFollowers(viewerID, userID uint, page pagination.Page) ([]ReadFollowResponse, string, error)
+	ListFollowing(viewerID, userID uint, page pagination.Page) ([]ReadFollowResponse, string, error)
+	ListFollowRequests(userID uint, page pagination.Page) ([]ReadFollowResponse, string, error)
+	AnswerFollowRequest(userID, followID uint, status entity.FriendshipStatusEnum) error
+	GetFollow(followerID, followeeID uint) (*entity.Follow, error)
+	CountFollowers(userID uint) (int64, error)
+	CountFollowing(userID uint) (int64, error)
+}
+
+type followService struct {
+	config       config.Config
+	logger       *zap.SugaredLogger
+	repository   IFollowRepository
+	blockService block.IBlockService
+}
+
+func NewFollowService(repository IFollowRepository, blockService block.IBlockService, logger *zap.SugaredLogger, config config.Config) IFollowService {
+	if repository == nil {
+		return nil
+	}
+
+	return &followService{
+		config:       config,
+		logger:       logger,
+		repository:   repository,
+		blockService: blockService,
+	}
+}
+
+// Follow follows a public account right away, a private account receives a follow request instead
+func (s *followService) Follow(userID, followeeID uint) (*FollowResponse, error) {
+	if userID == followeeID {
+		return nil, ErrSelfFollow
+	}
+
+	followee, err := s.repository.GetUserByID(followeeID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	blocked, err := s.blockService.IsBlocked(userID, followeeID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, block.ErrBlocked
+	}
+
+	status := entity.FriendshipStatusAccepted
+	if followee.IsPrivate {
+		status = entity.FriendshipStatusPending
+	}
+
+	existing, err := s.repository.GetByUsers(userID, followeeID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.Status != entity.FriendshipStatusRejected {
+			return nil, ErrAlreadyFollowing
+		}
+		// A rejected request can be sent again
+		if err = s.repository.UpdateStatus(existing.ID, status); err != nil {
+			return nil, err
+		}
+		return &FollowResponse{Status: status}, nil
+	}
+
+	if _, err = s.repository.Create(entity.Follow{FollowerID: userID, FolloweeID: followeeID, Status: status}); err != nil {
+		return nil, err
+	}
+	return &FollowResponse{Status: status}, nil
+}
+
+// Unfollow also withdraws a pending follow request
+func (s *followService) Unfollow(userID, followeeID uint) error {
+	deleted, err := s.repository.Delete(userID, followeeID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotFollowing
+	}
+	return nil
+}
+
+func (s *followService) ListFollowers(viewerID, userID uint, page pagination.Page) ([]ReadFollowResponse, string, error) {
+	if err := s.checkCanView(viewerID, userID); err != nil {
+		return nil, "", err
+	}
+
+	follows, err := s.repository.ListFollowers(viewerID, userID, entity.FriendshipStatusAccepted, page)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.toResponse(follows, page, func(follow entity.Follow) entity.User { return follow.Follower })
+}
+
+func (s *followService) ListFollowing(viewerID, userID uint, page pagination.Page) ([]ReadFollowResponse, string, error) {
+	if err := s.checkCanView(viewerID, userID); err != nil {
+		return nil, "", err
+	}
+
+	follows, err := s.repository.ListFollowing(viewerID, userID, page)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.toResponse(follows, page, func(follow entity.Follow) entity.User { return follow.Followee })
+}
+
+func (s *followService) ListFollowRequests(userID uint, page pagination.Page) ([]ReadFollowResponse, string, error) {
+	follows, err := s.repository.ListFollowers(userID, userID, entity.FriendshipStatusPending, page)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.toResponse(follows, page, func(follow entity.Follow) entity.User { return follow.Follower })
+}
+
+func (s *followService) AnswerFollowRequest(userID, followID uint, status entity.FriendshipStatusEnum) error {
+	follow, err := s.repository.Get(followID)
+	if err != nil {
+		return err
+	}
+
+	if follow.FolloweeID != userID || follow.Status != entity.FriendshipStatusPending {
+		return ErrFollowRequestAnswer
+	}
+
+	return s.repository.UpdateStatus(follow.ID, status)
+}
+
+// GetFollow returns nil without error when the user does not follow the other one
+func (s *followService) GetFollow(followerID, followeeID uint) (*entity.Follow, error) {
+	return s.repository.GetByUsers(followerID, followeeID)
+}
+
+func (s *followService) CountFollowers(userID uint) (int64, error) {
+	return s.repository.CountFollowers(userID)
+}
+
+func (s *followService) CountFollowing(userID uint) (int64, error) {
+	return s.repository.CountFollowing(userID)
+}
+
+// checkCanView lets the lists of a private account be seen only by the account itself, its followers and its friends
+func (s *followService) checkCanView(viewerID, userID uint) error {
+	user, err := s.repository.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	blocked, err := s.blockService.IsBlocked(viewerID, userID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrUserNotFound
+	}
+
+	if viewerID == userID || !user.IsPrivate || s.repository.IsFriend(viewerID, userID) {
+		return nil
+	}
+
+	follow, err := s.repository.GetByUsers(viewerID, userID)
+	if err != nil {
+		return err
+	}
+	if follow != nil && follow.Status == entity.FriendshipStatusAccepted {
+		return nil
+	}
+	return ErrPrivateAccount
+}
+
+// toResponse trims the follows to the page, blocked users are already left out by the repository
+func (s *followService) toResponse(follows []entity.Follow, page pagination.Page, user func(follow entity.Follow) entity.User) ([]ReadFollowResponse, string, error) {
+	follows, nextCursor := pagination.Next(follows, page, func(follow entity.Follow) (time.Time, uint) { return follow.CreatedAt, follow.ID })
+
+	rsp := make([]ReadFollowResponse, 0, len(follows))
+	for _, follow := range follows {
+		u := user(follow)
+		rsp = append(rsp, ReadFollowResponse{
+			Id:        follow.ID,
+			User:      httpmodel.CommonUser{Id: u.ID, Username: u.Username, FirstName: u.FirstName, LastName: u.LastName, ProfilePhoto: u.ProfilePhoto},
+			Status:    follow.Status,
+			CreatedAt: follow.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return rsp, nextCursor, nil
+}
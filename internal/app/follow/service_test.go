@@ -0,0 +1,199 @@
+package follow
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// memoryRepository keeps users and follows in memory
+type memoryRepository struct {
+	IFollowRepository
+	users   map[uint]entity.User
+	follows []entity.Follow
+}
+
+func (r *memoryRepository) GetUserByID(userID uint) (*entity.User, error) {
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryRepository) Create(follow entity.Follow) (*entity.Follow, error) {
+	follow.ID = uint(len(r.follows) + 1)
+	follow.CreatedAt = time.Now()
+	r.follows = append(r.follows, follow)
+	return &follow, nil
+}
+
+func (r *memoryRepository) GetByUsers(followerID, followeeID uint) (*entity.Follow, error) {
+	for _, follow := range r.follows {
+		if follow.FollowerID == followerID && follow.FolloweeID == followeeID {
+			return &follow, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryRepository) Get(id uint) (*entity.Follow, error) {
+	for _, follow := range r.follows {
+		if follow.ID == id {
+			return &follow, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryRepository) UpdateStatus(id uint, status entity.FriendshipStatusEnum) error {
+	for i := range r.follows {
+		if r.follows[i].ID == id {
+			r.follows[i].Status = status
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepository) ListFollowers(viewerID, userID uint, status entity.FriendshipStatusEnum, page pagination.Page) ([]entity.Follow, error) {
+	var follows []entity.Follow
+	for _, follow := range r.follows {
+		if follow.FolloweeID == userID && follow.Status == status {
+			follow.Follower = r.users[follow.FollowerID]
+			follows = append(follows, follow)
+		}
+	}
+	return follows, nil
+}
+
+func (r *memoryRepository) IsFriend(firstUserID, secondUserID uint) bool {
+	return false
+}
+
+// blockRepository keeps the blocks in memory, a block hides the users from each other whoever blocked
+type blockRepository struct {
+	block.IBlockRepository
+	blocks [][2]uint
+}
+
+func (r *blockRepository) IsBlocked(firstUserID, secondUserID uint) (bool, error) {
+	for _, b := range r.blocks {
+		if (b[0] == firstUserID && b[1] == secondUserID) || (b[0] == secondUserID && b[1] == firstUserID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func newFollowService(users ...entity.User) (*followService, *memoryRepository, *blockRepository) {
+	repository := &memoryRepository{users: map[uint]entity.User{}}
+	for _, user := range users {
+		repository.users[user.ID] = user
+	}
+	blocks := &blockRepository{}
+	blockService := block.NewBlockService(blocks, zap.NewNop().Sugar(), config.Config{})
+	s := NewFollowService(repository, blockService, zap.NewNop().Sugar(), config.Config{})
+	return s.(*followService), repository, blocks
+}
+
+func TestFollowIsRejectedBetweenBlockedUsers(t *testing.T) {
+	s, repository, blocks := newFollowService(entity.User{Model: gorm.Model{ID: 1}}, entity.User{Model: gorm.Model{ID: 2}})
+	blocks.blocks = append(blocks.blocks, [2]uint{2, 1})
+
+	if _, err := s.Follow(1, 2); !errors.Is(err, block.ErrBlocked) {
+		t.Fatalf("blocked user can follow the blocker: %v", err)
+	}
+	if _, err := s.Follow(2, 1); !errors.Is(err, block.ErrBlocked) {
+		t.Fatalf("blocker can follow the blocked user: %v", err)
+	}
+	if len(repository.follows) != 0 {
+		t.Fatalf("follows are created: %v", repository.follows)
+	}
+}
+
+func TestFollowListsOfBlockerLookMissing(t *testing.T) {
+	s, _, blocks := newFollowService(entity.User{Model: gorm.Model{ID: 1}}, entity.User{Model: gorm.Model{ID: 2}})
+	page := pagination.Page{Limit: pagination.DefaultLimit}
+
+	if _, _, err := s.ListFollowers(1, 2, page); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks.blocks = append(blocks.blocks, [2]uint{2, 1})
+	if _, _, err := s.ListFollowers(1, 2, page); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("followers of the blocker are listed: %v", err)
+	}
+	if _, _, err := s.ListFollowers(2, 1, page); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("followers of the blocked user are listed: %v", err)
+	}
+}
+
+func TestFollowRequestToPrivateAccount(t *testing.T) {
+	s, repository, _ := newFollowService(entity.User{Model: gorm.Model{ID: 1}}, entity.User{Model: gorm.Model{ID: 2}, IsPrivate: true})
+	page := pagination.Page{Limit: pagination.DefaultLimit}
+
+	rsp, err := s.Follow(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Status != entity.FriendshipStatusPending {
+		t.Fatalf("private account is followed right away: %s", rsp.Status)
+	}
+	if _, _, err = s.ListFollowers(1, 2, page); !errors.Is(err, ErrPrivateAccount) {
+		t.Fatalf("followers of a private account are listed before the request is approved: %v", err)
+	}
+
+	requests, _, err := s.ListFollowRequests(2, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || requests[0].User.Id != 1 {
+		t.Fatalf("follow request is not listed: %+v", requests)
+	}
+
+	if err = s.AnswerFollowRequest(1, requests[0].Id, entity.FriendshipStatusAccepted); !errors.Is(err, ErrFollowRequestAnswer) {
+		t.Fatalf("follower approves their own request: %v", err)
+	}
+	if err = s.AnswerFollowRequest(2, requests[0].Id, entity.FriendshipStatusAccepted); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.AnswerFollowRequest(2, requests[0].Id, entity.FriendshipStatusRejected); !errors.Is(err, ErrFollowRequestAnswer) {
+		t.Fatalf("answered request is answered again: %v", err)
+	}
+
+	if _, _, err = s.ListFollowers(1, 2, page); err != nil {
+		t.Fatalf("approved follower can not see the followers: %v", err)
+	}
+	if repository.follows[0].Status != entity.FriendshipStatusAccepted {
+		t.Fatalf("request is not accepted: %s", repository.follows[0].Status)
+	}
+}
+
+func TestRejectedFollowRequestCanBeSentAgain(t *testing.T) {
+	s, repository, _ := newFollowService(entity.User{Model: gorm.Model{ID: 1}}, entity.User{Model: gorm.Model{ID: 2}, IsPrivate: true})
+
+	if _, err := s.Follow(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Follow(1, 2); !errors.Is(err, ErrAlreadyFollowing) {
+		t.Fatalf("pending request is sent twice: %v", err)
+	}
+	if err := s.AnswerFollowRequest(2, repository.follows[0].ID, entity.FriendshipStatusRejected); err != nil {
+		t.Fatal(err)
+	}
+
+	rsp, err := s.Follow(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Status != entity.FriendshipStatusPending || len(repository.follows) != 1 || repository.follows[0].Status != entity.FriendshipStatusPending {
+		t.Fatalf("rejected request is not sent again: %+v", repository.follows)
+	}
+}
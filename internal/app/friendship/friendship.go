@@ -12,3 +12,25 @@ type ReadFriendship struct {
 	Receiver  httpmodel.CommonUser        `json:"receiver"`
 	Status    entity.FriendshipStatusEnum `json:"status"`
 }
+
+type ReadSuggestion struct {
+	User          httpmodel.CommonUser   `json:"user" extensions:"x-order=1"`
+	MutualFriends int64                  `json:"mutual_friends" extensions:"x-order=2" example:"3"` // Number of friends in common
+	MutualSample  []httpmodel.CommonUser `json:"mutual_sample" extensions:"x-order=3"`              // A few of the friends in common
+}
+
+type FriendListRequest struct {
+	Name string `json:"name" extensions:"x-order=1" example:"Close friends" validate:"required"` // 1 to 50 characters, unique among the lists of the user
+}
+
+type ReadFriendList struct {
+	Id          uint   `json:"id" extensions:"x-order=1" example:"1"`
+	Name        string `json:"name" extensions:"x-order=2" example:"Close friends"`
+	MemberCount int64  `json:"member_count" extensions:"x-order=3" example:"5"`
+	CreatedAt   string `json:"created_at" extensions:"x-order=4" example:"2024-01-22T11:31:40+03:00"`
+}
+
+type ReadFriendListDetail struct {
+	ReadFriendList `json:",inline" extensions:"x-order=1"`
+	Members        []httpmodel.CommonUser `json:"members" extensions:"x-order=2"` // Friends in the list, members who are not friends anymore are left out
+}
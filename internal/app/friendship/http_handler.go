@@ -1,13 +1,19 @@
 package friendship
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
 	"github.com/mehmetokdemir/social-media-api/internal/middleware"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 	"net/http"
 	"strconv"
 )
@@ -15,21 +21,33 @@ import (
 type HttpHandler struct {
 	friendshipService IFriendshipService
 	logger            *zap.SugaredLogger
-	jwtPrivateKey     string
+	signingKeyService signingkey.ISigningKeyService
 	guardService      guard.IGuardService
 }
 
-func NewHttpHandler(guardService guard.IGuardService, friendshipService IFriendshipService, logger *zap.SugaredLogger, jwtPrivateKey string) *HttpHandler {
-	return &HttpHandler{guardService: guardService, friendshipService: friendshipService, logger: logger, jwtPrivateKey: jwtPrivateKey}
+func NewHttpHandler(guardService guard.IGuardService, friendshipService IFriendshipService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, friendshipService: friendshipService, logger: logger, signingKeyService: signingKeyService}
 }
 
 func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
-	appGroup := app.Group("/friendship").Use(middleware.AuthMiddleware(h.jwtPrivateKey))
+	appGroup := app.Group("/friendship").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
 	appGroup.Post("/add/:user_id", h.Add)
 	appGroup.Post("/remove/:request_id", h.Remove)
 	appGroup.Post("/reject/:request_id", h.Reject)
 	appGroup.Post("/accept/:request_id", h.Accept)
+	appGroup.Post("/cancel/:request_id", h.Cancel)
 	appGroup.Get("/list/:status", h.List)
+	appGroup.Get("/requests/incoming", h.ListIncomingRequests)
+	appGroup.Get("/requests/outgoing", h.ListOutgoingRequests)
+	appGroup.Get("/suggestions", h.ListSuggestions)
+	appGroup.Post("/suggestions/:user_id/dismiss", h.DismissSuggestion)
+	appGroup.Get("/lists", h.ListFriendLists)
+	appGroup.Post("/lists", h.CreateFriendList)
+	appGroup.Get("/lists/:list_id", h.GetFriendList)
+	appGroup.Put("/lists/:list_id", h.RenameFriendList)
+	appGroup.Delete("/lists/:list_id", h.DeleteFriendList)
+	appGroup.Post("/lists/:list_id/members/:user_id", h.AddFriendListMember)
+	appGroup.Delete("/lists/:list_id/members/:user_id", h.RemoveFriendListMember)
 }
 
 // Add godoc
@@ -65,12 +83,60 @@ func (h *HttpHandler) Add(ctx *fiber.Ctx) error {
 	}
 
 	if err = h.friendshipService.AddFriend(userID, uint(friendID)); err != nil {
+		switch {
+		case errors.Is(err, block.ErrBlocked):
+			return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("can not request friendship", err.Error(), http.StatusForbidden))
+		case errors.Is(err, ErrRequestCooldown):
+			return ctx.Status(fiber.StatusTooManyRequests).JSON(httpresponse.NewError("can not request friendship", err.Error(), http.StatusTooManyRequests))
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not request friendship", err.Error(), http.StatusInternalServerError))
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
 }
 
+// Cancel godoc
+// @Summary Cancel sent friendship request
+// @Description Cancel a pending friendship request sent by the logged-in user, this endpoint needs authentication
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param request_id path integer true "ID of the friendship request"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /friendship/cancel/{request_id} [post]
+func (h *HttpHandler) Cancel(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	requestID, err := strconv.ParseUint(ctx.Params("request_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse request_id", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err = h.friendshipService.CancelFriendRequest(userID, uint(requestID)); err != nil {
+		switch {
+		case errors.Is(err, ErrCancelRequest):
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not cancel friendship request", err.Error(), http.StatusBadRequest))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not cancel friendship request", err.Error(), http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not cancel friendship request", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
 // Reject godoc
 // @Summary Reject user from pending friendship request
 // @Description Reject user from pending friendship request, this endpoint needs authentication
@@ -144,6 +210,9 @@ func (h *HttpHandler) Accept(ctx *fiber.Ctx) error {
 	}
 
 	if err = h.friendshipService.AcceptFriend(userID, uint(requestID)); err != nil {
+		if errors.Is(err, block.ErrBlocked) {
+			return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("can not accept friend request", err.Error(), http.StatusForbidden))
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not accept friend request", err.Error(), http.StatusInternalServerError))
 	}
 
@@ -198,6 +267,8 @@ func (h *HttpHandler) Remove(ctx *fiber.Ctx) error {
 // @Produce  json
 // @Param X-Auth-Token header string true "Auth token of logged-in user."
 // @Param status path string false "Filter with status it takes enum values which are; pending, accepted and also empty string. if status is empty string all documents will return"
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
 // @Success 200 {object} []ReadFriendship "Success"
 // @Failure 400
 // @Failure 500
@@ -230,10 +301,419 @@ func (h *HttpHandler) List(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
 	}
 
-	friendships, err := h.friendshipService.ListFriends(userID, filterStatus)
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get friend list", err.Error(), http.StatusBadRequest))
+	}
+
+	friendships, nextCursor, err := h.friendshipService.ListFriends(userID, filterStatus, page)
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get friend list", err.Error(), http.StatusInternalServerError))
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, friendships))
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, friendships, nextCursor))
+}
+
+// ListIncomingRequests godoc
+// @Summary List incoming friendship requests
+// @Description List pending friendship requests sent to the logged-in user, newest first
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadFriendship "Success"
+// @Failure 400
+// @Failure 500
+// @Router /friendship/requests/incoming [get]
+func (h *HttpHandler) ListIncomingRequests(ctx *fiber.Ctx) error {
+	return h.listRequests(ctx, h.friendshipService.ListIncomingRequests)
+}
+
+// ListOutgoingRequests godoc
+// @Summary List outgoing friendship requests
+// @Description List pending friendship requests sent by the logged-in user, newest first
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadFriendship "Success"
+// @Failure 400
+// @Failure 500
+// @Router /friendship/requests/outgoing [get]
+func (h *HttpHandler) ListOutgoingRequests(ctx *fiber.Ctx) error {
+	return h.listRequests(ctx, h.friendshipService.ListOutgoingRequests)
+}
+
+func (h *HttpHandler) listRequests(ctx *fiber.Ctx, list func(userID uint, page pagination.Page) ([]ReadFriendship, string, error)) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get friendship requests", err.Error(), http.StatusBadRequest))
+	}
+
+	friendships, nextCursor, err := list(userID, page)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get friendship requests", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, friendships, nextCursor))
+}
+
+// ListSuggestions godoc
+// @Summary List friend suggestions
+// @Description List people the logged-in user may know, ranked by the number of friends in common. Friends, users with a
+// @Description pending request, blocked users and dismissed users are not suggested.
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 50"
+// @Success 200 {object} []ReadSuggestion "Success"
+// @Failure 400
+// @Failure 500
+// @Router /friendship/suggestions [get]
+func (h *HttpHandler) ListSuggestions(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.OffsetFromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get friend suggestions", err.Error(), http.StatusBadRequest))
+	}
+
+	suggestions, nextCursor, err := h.friendshipService.ListSuggestions(userID, page)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get friend suggestions", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, suggestions, nextCursor))
+}
+
+// DismissSuggestion godoc
+// @Summary Dismiss friend suggestion
+// @Description Dismiss a suggested user, they are not suggested to the logged-in user again
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param user_id path integer true "ID of the suggested user"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /friendship/suggestions/{user_id}/dismiss [post]
+func (h *HttpHandler) DismissSuggestion(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	dismissedID, err := strconv.ParseUint(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse user_id", err.Error(), http.StatusBadRequest))
+	}
+
+	if err = h.friendshipService.DismissSuggestion(userID, uint(dismissedID)); err != nil {
+		switch {
+		case errors.Is(err, ErrSelfSuggestion):
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not dismiss suggestion", err.Error(), http.StatusBadRequest))
+		case errors.Is(err, ErrUserNotFound):
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not dismiss suggestion", err.Error(), http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not dismiss suggestion", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// ListFriendLists godoc
+// @Summary List friend lists
+// @Description List friend lists of the logged-in user with their member counts
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadFriendList "Success"
+// @Failure 400
+// @Failure 500
+// @Router /friendship/lists [get]
+func (h *HttpHandler) ListFriendLists(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.OffsetFromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get friend lists", err.Error(), http.StatusBadRequest))
+	}
+
+	friendLists, nextCursor, err := h.friendshipService.ListFriendLists(userID, page)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get friend lists", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, friendLists, nextCursor))
+}
+
+// CreateFriendList godoc
+// @Summary Create friend list
+// @Description Create a named friend list like close friends or family. Posts can be shared with the members of a list only.
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param request body FriendListRequest true "body params"
+// @Success 200 {object} httpmodel.CreateResponse "Success"
+// @Failure 400
+// @Failure 409
+// @Failure 500
+// @Router /friendship/lists [post]
+func (h *HttpHandler) CreateFriendList(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	var req FriendListRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	friendList, err := h.friendshipService.CreateFriendList(userID, req.Name)
+	if err != nil {
+		return h.friendListError(ctx, "can not create friend list", err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, httpmodel.CreateResponse{Id: friendList.ID}))
+}
+
+// GetFriendList godoc
+// @Summary Get friend list
+// @Description Get a friend list of the logged-in user with its members
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param list_id path integer true "ID of the friend list"
+// @Success 200 {object} ReadFriendListDetail "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /friendship/lists/{list_id} [get]
+func (h *HttpHandler) GetFriendList(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	friendListID, err := strconv.ParseUint(ctx.Params("list_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse list_id", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	friendList, err := h.friendshipService.GetFriendList(userID, uint(friendListID))
+	if err != nil {
+		return h.friendListError(ctx, "can not get friend list", err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, friendList))
+}
+
+// RenameFriendList godoc
+// @Summary Rename friend list
+// @Description Rename a friend list of the logged-in user
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param list_id path integer true "ID of the friend list"
+// @Param request body FriendListRequest true "body params"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 409
+// @Failure 500
+// @Router /friendship/lists/{list_id} [put]
+func (h *HttpHandler) RenameFriendList(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	friendListID, err := strconv.ParseUint(ctx.Params("list_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse list_id", err.Error(), http.StatusBadRequest))
+	}
+
+	var req FriendListRequest
+	if err = ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err = h.friendshipService.RenameFriendList(userID, uint(friendListID), req.Name); err != nil {
+		return h.friendListError(ctx, "can not rename friend list", err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// DeleteFriendList godoc
+// @Summary Delete friend list
+// @Description Delete a friend list of the logged-in user, posts shared with the list are seen only by the user from then on
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param list_id path integer true "ID of the friend list"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /friendship/lists/{list_id} [delete]
+func (h *HttpHandler) DeleteFriendList(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	friendListID, err := strconv.ParseUint(ctx.Params("list_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse list_id", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err = h.friendshipService.DeleteFriendList(userID, uint(friendListID)); err != nil {
+		return h.friendListError(ctx, "can not delete friend list", err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// AddFriendListMember godoc
+// @Summary Add friend to friend list
+// @Description Add a friend of the logged-in user to one of their friend lists, the friend leaves the list when the friendship ends
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param list_id path integer true "ID of the friend list"
+// @Param user_id path integer true "ID of the friend"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /friendship/lists/{list_id}/members/{user_id} [post]
+func (h *HttpHandler) AddFriendListMember(ctx *fiber.Ctx) error {
+	return h.changeFriendListMember(ctx, h.friendshipService.AddFriendListMember, "can not add friend to friend list")
+}
+
+// RemoveFriendListMember godoc
+// @Summary Remove friend from friend list
+// @Description Remove a friend from a friend list of the logged-in user, the friendship itself is kept
+// @Tags Friendship
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param list_id path integer true "ID of the friend list"
+// @Param user_id path integer true "ID of the friend"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /friendship/lists/{list_id}/members/{user_id} [delete]
+func (h *HttpHandler) RemoveFriendListMember(ctx *fiber.Ctx) error {
+	return h.changeFriendListMember(ctx, h.friendshipService.RemoveFriendListMember, "can not remove friend from friend list")
+}
+
+func (h *HttpHandler) changeFriendListMember(ctx *fiber.Ctx, change func(userID, friendListID, friendID uint) error, message string) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	friendListID, err := strconv.ParseUint(ctx.Params("list_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse list_id", err.Error(), http.StatusBadRequest))
+	}
+
+	friendID, err := strconv.ParseUint(ctx.Params("user_id"), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse user_id", err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err = change(userID, uint(friendListID), uint(friendID)); err != nil {
+		return h.friendListError(ctx, message, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+func (h *HttpHandler) friendListError(ctx *fiber.Ctx, message string, err error) error {
+	switch {
+	case errors.Is(err, ErrFriendListName), errors.Is(err, ErrNotFriend):
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError(message, err.Error(), http.StatusBadRequest))
+	case errors.Is(err, ErrFriendListTaken):
+		return ctx.Status(fiber.StatusConflict).JSON(httpresponse.NewError(message, err.Error(), http.StatusConflict))
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, ErrNotMember):
+		return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError(message, err.Error(), http.StatusNotFound))
+	}
+	return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError(message, err.Error(), http.StatusInternalServerError))
 }
@@ -1,9 +1,12 @@
 package friendship
 
 import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/scopes"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type IFriendshipRepository interface {
@@ -11,15 +14,52 @@ type IFriendshipRepository interface {
 	AcceptFriendRequest(requestID uint) error
 	RejectFriendRequest(requestID uint) error
 	DeleteFriendRequest(requestID uint) error
-	ListFriendRequests(userID uint, status *entity.FriendshipStatusEnum) ([]entity.Friendship, error)
+	ListFriendRequests(userID uint, status *entity.FriendshipStatusEnum, page pagination.Page) ([]entity.Friendship, error)
 	IsFriendShip(senderID, receiverID uint) (bool, error)
 	IsFriendShipPending(senderID, receiverID uint) (bool, error)
 	IsUserExist(userID uint) bool
 	GetUserByID(userID uint) (*entity.User, error)
 	GetFriendRequest(requestID uint) (*entity.Friendship, error)
+	ListPendingRequests(userID uint, incoming bool, page pagination.Page) ([]entity.Friendship, error)
+	GetLastRejectedRequest(senderID, receiverID uint) (*entity.Friendship, error)
+
+	ListSuggestions(userID uint, offset, limit int) ([]SuggestionResult, error)
+	ListMutualFriends(userID uint, candidateIDs []uint, perCandidate int) ([]MutualFriendResult, error)
+	DismissSuggestion(userID, dismissedID uint) error
+
+	CreateFriendList(friendList entity.FriendList) (*entity.FriendList, error)
+	GetFriendList(id uint) (*entity.FriendList, error)
+	ListFriendLists(userID uint, offset, limit int) ([]FriendListResult, error)
+	IsFriendListNameTaken(userID uint, name string, excludeID uint) bool
+	RenameFriendList(id uint, name string) error
+	DeleteFriendList(id uint) error
+	GetAcceptedFriendship(firstUserID, secondUserID uint) (*entity.Friendship, error)
+	GetLatestFriendship(firstUserID, secondUserID uint) (*entity.Friendship, error)
+	CountFriends(userID uint) (int64, error)
+	AddFriendListMember(member entity.FriendListMember) error
+	RemoveFriendListMember(friendListID, memberID uint) (bool, error)
+	ListFriendListMembers(friendListID uint) ([]entity.User, error)
 	Migration() error
 }
 
+// FriendListResult is a friend list with the number of members whose friendship is still accepted
+type FriendListResult struct {
+	entity.FriendList
+	MemberCount int64
+}
+
+// SuggestionResult is a user suggested as a friend with the number of friends in common
+type SuggestionResult struct {
+	entity.User
+	MutualFriends int64
+}
+
+// MutualFriendResult is a friend the user has in common with the candidate
+type MutualFriendResult struct {
+	entity.User
+	CandidateID uint
+}
+
 type friendshipRepository struct {
 	db     *gorm.DB
 	logger *zap.SugaredLogger
@@ -84,7 +124,7 @@ func (r *friendshipRepository) GetFriends(userID uint, status *entity.Friendship
 		query = query.Where("status = ?", *status)
 	}
 
-	if err := query.Model(&Friendships).Preload("User").Find(&Friendships).Error; err != nil {
+	if err := query.Model(&Friendships).Scopes(scopes.ActiveUser("friendships.sender_id"), scopes.ActiveUser("friendships.receiver_id")).Find(&Friendships).Error; err != nil {
 		return nil, err
 	}
 
@@ -92,7 +132,7 @@ func (r *friendshipRepository) GetFriends(userID uint, status *entity.Friendship
 }
 
 func (r *friendshipRepository) GetFriendshipRequest(senderID, receiverID uint) (Friendship *entity.Friendship, err error) {
-	if err = r.db.Preload("User").Model(&entity.Friendship{}).
+	if err = r.db.Model(&entity.Friendship{}).
 		Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
 			senderID, receiverID, receiverID, senderID).First(&Friendship).Error; err != nil {
 		return nil, err
@@ -103,7 +143,7 @@ func (r *friendshipRepository) GetFriendshipRequest(senderID, receiverID uint) (
 
 func (r *friendshipRepository) IsUserExist(userID uint) bool {
 	var user *entity.User
-	if err := r.db.Model(&entity.User{}).Where("id =?", userID).First(&user).Error; err != nil {
+	if err := r.db.Model(&entity.User{}).Where("id =? AND deactivated_at IS NULL", userID).First(&user).Error; err != nil {
 		return false
 	}
 	return true
@@ -120,22 +160,24 @@ func (r *friendshipRepository) GetFriendRequest(requestID uint) (friendship *ent
 	return friendship, nil
 }
 
-func (r *friendshipRepository) ListFriendRequests(userID uint, status *entity.FriendshipStatusEnum) ([]entity.Friendship, error) {
+func (r *friendshipRepository) ListFriendRequests(userID uint, status *entity.FriendshipStatusEnum, page pagination.Page) ([]entity.Friendship, error) {
 	var friendships []entity.Friendship
 	if status == nil {
 		err := r.db.Preload("Sender").Preload("Receiver").Model(&entity.Friendship{}).
+			Scopes(scopes.ActiveUser("friendships.sender_id"), scopes.ActiveUser("friendships.receiver_id")).
 			Where("sender_id = ? OR receiver_id = ?", userID, userID).
 			Where("status <> ?", entity.FriendshipStatusRejected).
-			Order("created_at DESC").
+			Scopes(page.Scope("friendships")).
 			Find(&friendships).Error
 		if err != nil {
 			return nil, err
 		}
 	} else {
 		err := r.db.Preload("Sender").Preload("Receiver").Model(&entity.Friendship{}).
+			Scopes(scopes.ActiveUser("friendships.sender_id"), scopes.ActiveUser("friendships.receiver_id")).
 			Where("sender_id = ? OR receiver_id = ?", userID, userID).
 			Where("status = ?", *status).
-			Order("created_at DESC").
+			Scopes(page.Scope("friendships")).
 			Find(&friendships).Error
 		if err != nil {
 			return nil, err
@@ -145,6 +187,221 @@ func (r *friendshipRepository) ListFriendRequests(userID uint, status *entity.Fr
 	return friendships, nil
 }
 
+// ListPendingRequests lists the pending requests sent to the user when incoming, the ones the user sent otherwise
+func (r *friendshipRepository) ListPendingRequests(userID uint, incoming bool, page pagination.Page) ([]entity.Friendship, error) {
+	column := "sender_id"
+	if incoming {
+		column = "receiver_id"
+	}
+
+	var friendships []entity.Friendship
+	if err := r.db.Preload("Sender").Preload("Receiver").Model(&entity.Friendship{}).
+		Scopes(scopes.ActiveUser("friendships.sender_id"), scopes.ActiveUser("friendships.receiver_id")).
+		Where(column+" = ? AND status = ?", userID, entity.FriendshipStatusPending).
+		Scopes(page.Scope("friendships")).
+		Find(&friendships).Error; err != nil {
+		return nil, err
+	}
+	return friendships, nil
+}
+
+// GetLastRejectedRequest returns nil without error when the receiver never rejected a request of the sender
+func (r *friendshipRepository) GetLastRejectedRequest(senderID, receiverID uint) (*entity.Friendship, error) {
+	var friendships []entity.Friendship
+	if err := r.db.Where("sender_id = ? AND receiver_id = ? AND status = ?", senderID, receiverID, entity.FriendshipStatusRejected).
+		Order("updated_at DESC").Limit(1).Find(&friendships).Error; err != nil {
+		return nil, err
+	}
+	if len(friendships) == 0 {
+		return nil, nil
+	}
+	return &friendships[0], nil
+}
+
+// userFriendsSQL lists the active friends of @user as friend_id
+const userFriendsSQL = `
+SELECT CASE WHEN friendships.sender_id = @user THEN friendships.receiver_id ELSE friendships.sender_id END AS friend_id
+FROM friendships
+JOIN users ON users.id = CASE WHEN friendships.sender_id = @user THEN friendships.receiver_id ELSE friendships.sender_id END
+WHERE (friendships.sender_id = @user OR friendships.receiver_id = @user) AND friendships.status = @accepted AND friendships.deleted_at IS NULL
+	AND users.deleted_at IS NULL AND users.suspended_at IS NULL AND users.deactivated_at IS NULL`
+
+// ListSuggestions ranks the friends of the friends of the user by the number of friends in common. Users the user is
+// friends with, has a pending request with, blocked or was blocked by, or dismissed are left out.
+func (r *friendshipRepository) ListSuggestions(userID uint, offset, limit int) ([]SuggestionResult, error) {
+	var results []SuggestionResult
+	err := r.db.Raw(`
+WITH user_friends AS (`+userFriendsSQL+`
+), candidates AS (
+	SELECT CASE WHEN friendships.sender_id = user_friends.friend_id THEN friendships.receiver_id ELSE friendships.sender_id END AS candidate_id,
+		COUNT(DISTINCT user_friends.friend_id) AS mutual_friends
+	FROM user_friends
+	JOIN friendships ON (friendships.sender_id = user_friends.friend_id OR friendships.receiver_id = user_friends.friend_id)
+		AND friendships.status = @accepted AND friendships.deleted_at IS NULL
+	GROUP BY candidate_id
+)
+SELECT users.*, candidates.mutual_friends
+FROM candidates
+JOIN users ON users.id = candidates.candidate_id
+WHERE users.deleted_at IS NULL
+	AND users.suspended_at IS NULL
+	AND users.deactivated_at IS NULL
+	AND users.id <> @user
+	AND users.id NOT IN (SELECT friend_id FROM user_friends)
+	AND NOT EXISTS (SELECT 1 FROM friendships WHERE friendships.status = @pending AND friendships.deleted_at IS NULL
+		AND ((friendships.sender_id = @user AND friendships.receiver_id = users.id) OR (friendships.sender_id = users.id AND friendships.receiver_id = @user)))
+	AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @user AND blocks.blocked_id = users.id) OR (blocks.blocker_id = users.id AND blocks.blocked_id = @user))
+	AND NOT EXISTS (SELECT 1 FROM suggestion_dismissals WHERE suggestion_dismissals.user_id = @user AND suggestion_dismissals.dismissed_id = users.id AND suggestion_dismissals.deleted_at IS NULL)
+ORDER BY candidates.mutual_friends DESC, users.id
+OFFSET @offset LIMIT @limit`, map[string]interface{}{
+		"user":     userID,
+		"accepted": entity.FriendshipStatusAccepted,
+		"pending":  entity.FriendshipStatusPending,
+		"offset":   offset,
+		"limit":    limit,
+	}).Scan(&results).Error
+	return results, err
+}
+
+// ListMutualFriends returns at most perCandidate friends the user has in common with each candidate in one query
+func (r *friendshipRepository) ListMutualFriends(userID uint, candidateIDs []uint, perCandidate int) ([]MutualFriendResult, error) {
+	var results []MutualFriendResult
+	if len(candidateIDs) == 0 {
+		return results, nil
+	}
+
+	err := r.db.Raw(`
+WITH user_friends AS (`+userFriendsSQL+`
+), mutual AS (
+	SELECT CASE WHEN friendships.sender_id = user_friends.friend_id THEN friendships.receiver_id ELSE friendships.sender_id END AS candidate_id,
+		user_friends.friend_id,
+		ROW_NUMBER() OVER (PARTITION BY CASE WHEN friendships.sender_id = user_friends.friend_id THEN friendships.receiver_id ELSE friendships.sender_id END
+			ORDER BY user_friends.friend_id) AS position
+	FROM user_friends
+	JOIN friendships ON (friendships.sender_id = user_friends.friend_id OR friendships.receiver_id = user_friends.friend_id)
+		AND friendships.status = @accepted AND friendships.deleted_at IS NULL
+	WHERE (CASE WHEN friendships.sender_id = user_friends.friend_id THEN friendships.receiver_id ELSE friendships.sender_id END) IN @candidates
+)
+SELECT users.*, mutual.candidate_id
+FROM mutual
+JOIN users ON users.id = mutual.friend_id
+WHERE mutual.position <= @per_candidate
+ORDER BY mutual.candidate_id, mutual.position`, map[string]interface{}{
+		"user":          userID,
+		"accepted":      entity.FriendshipStatusAccepted,
+		"candidates":    candidateIDs,
+		"per_candidate": perCandidate,
+	}).Scan(&results).Error
+	return results, err
+}
+
+func (r *friendshipRepository) DismissSuggestion(userID, dismissedID uint) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.SuggestionDismissal{UserID: userID, DismissedID: dismissedID}).Error
+}
+
+func (r *friendshipRepository) CreateFriendList(friendList entity.FriendList) (*entity.FriendList, error) {
+	if err := r.db.Create(&friendList).Error; err != nil {
+		return nil, err
+	}
+	return &friendList, nil
+}
+
+func (r *friendshipRepository) GetFriendList(id uint) (friendList *entity.FriendList, err error) {
+	if err = r.db.Where("id = ?", id).First(&friendList).Error; err != nil {
+		return nil, err
+	}
+	return friendList, nil
+}
+
+func (r *friendshipRepository) ListFriendLists(userID uint, offset, limit int) ([]FriendListResult, error) {
+	var results []FriendListResult
+	err := r.db.Model(&entity.FriendList{}).
+		Select("friend_lists.*, (SELECT COUNT(*) FROM friend_list_members"+
+			" JOIN friendships ON friendships.id = friend_list_members.friendship_id AND friendships.status = ? AND friendships.deleted_at IS NULL"+
+			" WHERE friend_list_members.friend_list_id = friend_lists.id AND friend_list_members.deleted_at IS NULL) AS member_count", entity.FriendshipStatusAccepted).
+		Where("friend_lists.user_id = ?", userID).
+		Order("friend_lists.name, friend_lists.id").
+		Offset(offset).Limit(limit).
+		Find(&results).Error
+	return results, err
+}
+
+func (r *friendshipRepository) IsFriendListNameTaken(userID uint, name string, excludeID uint) bool {
+	var count int64
+	r.db.Model(&entity.FriendList{}).Where("user_id = ? AND lower(name) = lower(?) AND id <> ?", userID, name, excludeID).Count(&count)
+	return count > 0
+}
+
+func (r *friendshipRepository) RenameFriendList(id uint, name string) error {
+	return r.db.Model(&entity.FriendList{}).Where("id = ?", id).Update("name", name).Error
+}
+
+// DeleteFriendList removes the list with its members, posts shared with it are seen only by their author from then on
+func (r *friendshipRepository) DeleteFriendList(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("friend_list_id = ?", id).Delete(&entity.FriendListMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&entity.FriendList{}).Error
+	})
+}
+
+func (r *friendshipRepository) GetAcceptedFriendship(firstUserID, secondUserID uint) (friendship *entity.Friendship, err error) {
+	if err = r.db.Model(&entity.Friendship{}).
+		Where("(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)", firstUserID, secondUserID, secondUserID, firstUserID).
+		Where("status = ?", entity.FriendshipStatusAccepted).
+		First(&friendship).Error; err != nil {
+		return nil, err
+	}
+	return friendship, nil
+}
+
+// GetLatestFriendship returns the latest pending or accepted friendship between the users in either direction
+func (r *friendshipRepository) GetLatestFriendship(firstUserID, secondUserID uint) (*entity.Friendship, error) {
+	var friendship entity.Friendship
+	if err := r.db.Model(&entity.Friendship{}).
+		Where("((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)) AND status IN ?",
+			firstUserID, secondUserID, secondUserID, firstUserID,
+			[]entity.FriendshipStatusEnum{entity.FriendshipStatusPending, entity.FriendshipStatusAccepted}).
+		Order("created_at DESC").
+		First(&friendship).Error; err != nil {
+		return nil, err
+	}
+	return &friendship, nil
+}
+
+func (r *friendshipRepository) CountFriends(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Friendship{}).
+		Scopes(scopes.ActiveUser("friendships.sender_id"), scopes.ActiveUser("friendships.receiver_id")).
+		Where("(sender_id = ? OR receiver_id = ?) AND status = ?", userID, userID, entity.FriendshipStatusAccepted).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *friendshipRepository) AddFriendListMember(member entity.FriendListMember) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error
+}
+
+// RemoveFriendListMember removes the member for good, so that the friend can be added again without hitting the unique index
+func (r *friendshipRepository) RemoveFriendListMember(friendListID, memberID uint) (bool, error) {
+	result := r.db.Unscoped().Where("friend_list_id = ? AND member_id = ?", friendListID, memberID).Delete(&entity.FriendListMember{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *friendshipRepository) ListFriendListMembers(friendListID uint) ([]entity.User, error) {
+	var users []entity.User
+	if err := r.db.Model(&entity.User{}).
+		Joins("JOIN friend_list_members ON friend_list_members.member_id = users.id AND friend_list_members.deleted_at IS NULL").
+		Joins("JOIN friendships ON friendships.id = friend_list_members.friendship_id AND friendships.status = ? AND friendships.deleted_at IS NULL", entity.FriendshipStatusAccepted).
+		Where("friend_list_members.friend_list_id = ? AND users.deactivated_at IS NULL", friendListID).
+		Order("users.username").
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (r *friendshipRepository) Migration() error {
-	return r.db.AutoMigrate(entity.Friendship{})
+	return r.db.AutoMigrate(entity.Friendship{}, entity.SuggestionDismissal{}, entity.FriendList{}, entity.FriendListMember{})
 }
@@ -3,11 +3,16 @@ package friendship
 import (
 	"errors"
 	"fmt"
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"github.com/mehmetokdemir/social-media-api/internal/config"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type IFriendshipService interface {
@@ -15,17 +20,50 @@ type IFriendshipService interface {
 	AcceptFriend(userID, friendshipRequestID uint) error
 	RemoveFriend(userID, friendshipRequestID uint) error
 	RejectFriend(userID, friendshipRequestID uint) error
-	ListFriends(userID uint, status *entity.FriendshipStatusEnum) ([]ReadFriendship, error)
+	ListFriends(userID uint, status *entity.FriendshipStatusEnum, page pagination.Page) ([]ReadFriendship, string, error)
 	GetFriendShipByRequestID(requestID uint) (*entity.Friendship, error)
+	GetLatestFriendship(firstUserID, secondUserID uint) (*entity.Friendship, error)
+	CountFriends(userID uint) (int64, error)
+	CancelFriendRequest(userID, friendshipRequestID uint) error
+	ListIncomingRequests(userID uint, page pagination.Page) ([]ReadFriendship, string, error)
+	ListOutgoingRequests(userID uint, page pagination.Page) ([]ReadFriendship, string, error)
+	ListSuggestions(userID uint, page pagination.Page) ([]ReadSuggestion, string, error)
+	DismissSuggestion(userID, dismissedID uint) error
+
+	CreateFriendList(userID uint, name string) (*entity.FriendList, error)
+	ListFriendLists(userID uint, page pagination.Page) ([]ReadFriendList, string, error)
+	GetFriendList(userID, friendListID uint) (*ReadFriendListDetail, error)
+	RenameFriendList(userID, friendListID uint, name string) error
+	DeleteFriendList(userID, friendListID uint) error
+	AddFriendListMember(userID, friendListID, friendID uint) error
+	RemoveFriendListMember(userID, friendListID, friendID uint) error
 }
 
+const (
+	maxSuggestionSize   = 50
+	mutualFriendsSample = 3
+	maxFriendListName   = 50
+)
+
+var (
+	ErrSelfSuggestion  = errors.New("can not dismiss yourself")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrRequestCooldown = errors.New("friend request was rejected recently, try again later")
+	ErrCancelRequest   = errors.New("only pending friend requests sent by the user can be cancelled")
+	ErrFriendListName  = fmt.Errorf("friend list name must be 1 to %d characters", maxFriendListName)
+	ErrFriendListTaken = errors.New("a friend list with the same name already exists")
+	ErrNotFriend       = errors.New("only friends can be added to a friend list")
+	ErrNotMember       = errors.New("user is not in the friend list")
+)
+
 type friendshipService struct {
 	config               config.Config
 	logger               *zap.SugaredLogger
 	friendshipRepository IFriendshipRepository
+	blockService         block.IBlockService
 }
 
-func NewFriendshipService(friendshipRepository IFriendshipRepository, logger *zap.SugaredLogger, config config.Config) IFriendshipService {
+func NewFriendshipService(friendshipRepository IFriendshipRepository, blockService block.IBlockService, logger *zap.SugaredLogger, config config.Config) IFriendshipService {
 	if friendshipRepository == nil {
 		return nil
 	}
@@ -33,6 +71,7 @@ func NewFriendshipService(friendshipRepository IFriendshipRepository, logger *za
 	return &friendshipService{
 		config:               config,
 		friendshipRepository: friendshipRepository,
+		blockService:         blockService,
 		logger:               logger,
 	}
 }
@@ -41,6 +80,14 @@ func (s *friendshipService) GetFriendShipByRequestID(requestID uint) (*entity.Fr
 	return s.friendshipRepository.GetFriendRequest(requestID)
 }
 
+func (s *friendshipService) GetLatestFriendship(firstUserID, secondUserID uint) (*entity.Friendship, error) {
+	return s.friendshipRepository.GetLatestFriendship(firstUserID, secondUserID)
+}
+
+func (s *friendshipService) CountFriends(userID uint) (int64, error) {
+	return s.friendshipRepository.CountFriends(userID)
+}
+
 func (s *friendshipService) AddFriend(senderID, receiverID uint) error {
 
 	if senderID == receiverID {
@@ -51,6 +98,12 @@ func (s *friendshipService) AddFriend(senderID, receiverID uint) error {
 		return errors.New("can not find users")
 	}
 
+	if blocked, err := s.blockService.IsBlocked(senderID, receiverID); err != nil {
+		return err
+	} else if blocked {
+		return block.ErrBlocked
+	}
+
 	isFriend, err := s.friendshipRepository.IsFriendShip(senderID, receiverID)
 	if err != nil {
 		return err
@@ -65,6 +118,15 @@ func (s *friendshipService) AddFriend(senderID, receiverID uint) error {
 		return fmt.Errorf("already friend or waiting friend request from user %d", receiverID)
 	}
 
+	// The receiver is not asked again by the same sender for a while after rejecting
+	rejected, err := s.friendshipRepository.GetLastRejectedRequest(senderID, receiverID)
+	if err != nil {
+		return err
+	}
+	if rejected != nil && time.Since(rejected.UpdatedAt) < time.Duration(s.config.FriendRequestCooldownDays)*24*time.Hour {
+		return ErrRequestCooldown
+	}
+
 	if _, err = s.friendshipRepository.CreateFriendRequest(entity.Friendship{
 		SenderID:   senderID,
 		ReceiverID: receiverID,
@@ -86,7 +148,7 @@ func (s *friendshipService) RemoveFriend(userID, friendshipRequestID uint) error
 		return errors.New("can not delete friendship, because of you are not friends")
 	}
 
-	if friendShip.SenderID != userID || friendShip.ReceiverID != userID {
+	if friendShip.SenderID != userID && friendShip.ReceiverID != userID {
 		return errors.New("do not have permission to remove this friend")
 	}
 
@@ -110,24 +172,64 @@ func (s *friendshipService) RejectFriend(userID, friendshipRequestID uint) error
 	return s.friendshipRepository.RejectFriendRequest(friendShip.ID)
 }
 
-func (s *friendshipService) ListFriends(userID uint, status *entity.FriendshipStatusEnum) ([]ReadFriendship, error) {
-	friendShips, err := s.friendshipRepository.ListFriendRequests(userID, status)
+// CancelFriendRequest withdraws a pending request the user sent
+func (s *friendshipService) CancelFriendRequest(userID, friendshipRequestID uint) error {
+	friendShip, err := s.friendshipRepository.GetFriendRequest(friendshipRequestID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var readFriendships []ReadFriendship
+	if friendShip.Status != entity.FriendshipStatusPending || friendShip.SenderID != userID {
+		return ErrCancelRequest
+	}
+
+	return s.friendshipRepository.DeleteFriendRequest(friendShip.ID)
+}
+
+func (s *friendshipService) ListIncomingRequests(userID uint, page pagination.Page) ([]ReadFriendship, string, error) {
+	return s.listPendingRequests(userID, true, page)
+}
+
+func (s *friendshipService) ListOutgoingRequests(userID uint, page pagination.Page) ([]ReadFriendship, string, error) {
+	return s.listPendingRequests(userID, false, page)
+}
+
+func (s *friendshipService) listPendingRequests(userID uint, incoming bool, page pagination.Page) ([]ReadFriendship, string, error) {
+	friendShips, err := s.friendshipRepository.ListPendingRequests(userID, incoming, page)
+	if err != nil {
+		return nil, "", err
+	}
+	return toReadFriendshipPage(friendShips, page)
+}
+
+// toReadFriendshipPage trims the friendships fetched with pagination.Page.Scope to the page
+func toReadFriendshipPage(friendShips []entity.Friendship, page pagination.Page) ([]ReadFriendship, string, error) {
+	friendShips, nextCursor := pagination.Next(friendShips, page, func(fs entity.Friendship) (time.Time, uint) { return fs.CreatedAt, fs.ID })
+
+	readFriendships := make([]ReadFriendship, 0, len(friendShips))
 	for _, fs := range friendShips {
-		readFriendships = append(readFriendships, ReadFriendship{
-			Id:        fs.ID,
-			CreatedAt: fs.Model.CreatedAt.Format(time.RFC3339),
-			Sender:    httpmodel.CommonUser{Id: fs.SenderID, Username: fs.Sender.Username, FirstName: fs.Sender.FirstName, LastName: fs.Sender.LastName, ProfilePhoto: fs.Sender.ProfilePhoto},
-			Receiver:  httpmodel.CommonUser{Id: fs.ReceiverID, Username: fs.Receiver.Username, FirstName: fs.Receiver.FirstName, LastName: fs.Receiver.LastName, ProfilePhoto: fs.Receiver.ProfilePhoto},
-			Status:    fs.Status,
-		})
+		readFriendships = append(readFriendships, toReadFriendship(fs))
 	}
+	return readFriendships, nextCursor, nil
+}
 
-	return readFriendships, nil
+func toReadFriendship(fs entity.Friendship) ReadFriendship {
+	return ReadFriendship{
+		Id:        fs.ID,
+		CreatedAt: fs.Model.CreatedAt.Format(time.RFC3339),
+		Sender:    httpmodel.CommonUser{Id: fs.SenderID, Username: fs.Sender.Username, FirstName: fs.Sender.FirstName, LastName: fs.Sender.LastName, ProfilePhoto: fs.Sender.ProfilePhoto},
+		Receiver:  httpmodel.CommonUser{Id: fs.ReceiverID, Username: fs.Receiver.Username, FirstName: fs.Receiver.FirstName, LastName: fs.Receiver.LastName, ProfilePhoto: fs.Receiver.ProfilePhoto},
+		Status:    fs.Status,
+	}
+}
+
+func (s *friendshipService) ListFriends(userID uint, status *entity.FriendshipStatusEnum, page pagination.Page) ([]ReadFriendship, string, error) {
+	friendShips, err := s.friendshipRepository.ListFriendRequests(userID, status, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return toReadFriendshipPage(friendShips, page)
 }
 
 func (s *friendshipService) AcceptFriend(userID uint, friendshipRequestID uint) error {
@@ -144,5 +246,204 @@ func (s *friendshipService) AcceptFriend(userID uint, friendshipRequestID uint)
 		return errors.New("can not accept to friendship")
 	}
 
+	if blocked, err := s.blockService.IsBlocked(friendship.SenderID, friendship.ReceiverID); err != nil {
+		return err
+	} else if blocked {
+		return block.ErrBlocked
+	}
+
 	return s.friendshipRepository.AcceptFriendRequest(friendshipRequestID)
 }
+
+// ListSuggestions lists people the user may know, ranked by the number of friends in common. The ranking has no stable
+// keyset, so the list is paged by offset.
+func (s *friendshipService) ListSuggestions(userID uint, page pagination.Page) ([]ReadSuggestion, string, error) {
+	if page.Limit > maxSuggestionSize {
+		page.Limit = maxSuggestionSize
+	}
+
+	suggestions, err := s.friendshipRepository.ListSuggestions(userID, page.Offset(), page.Limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	suggestions, nextCursor := pagination.NextOffset(suggestions, page)
+
+	candidateIDs := make([]uint, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		candidateIDs = append(candidateIDs, suggestion.ID)
+	}
+
+	// Samples of every suggestion are fetched together instead of one query per suggestion
+	mutualFriends, err := s.friendshipRepository.ListMutualFriends(userID, candidateIDs, mutualFriendsSample)
+	if err != nil {
+		return nil, "", err
+	}
+	samples := make(map[uint][]httpmodel.CommonUser)
+	for _, friend := range mutualFriends {
+		samples[friend.CandidateID] = append(samples[friend.CandidateID], httpmodel.CommonUser{Id: friend.ID, Username: friend.Username, FirstName: friend.FirstName, LastName: friend.LastName, ProfilePhoto: friend.ProfilePhoto})
+	}
+
+	rsp := make([]ReadSuggestion, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		rsp = append(rsp, ReadSuggestion{
+			User:          httpmodel.CommonUser{Id: suggestion.ID, Username: suggestion.Username, FirstName: suggestion.FirstName, LastName: suggestion.LastName, ProfilePhoto: suggestion.ProfilePhoto},
+			MutualFriends: suggestion.MutualFriends,
+			MutualSample:  samples[suggestion.ID],
+		})
+	}
+	return rsp, nextCursor, nil
+}
+
+// DismissSuggestion keeps the user out of the suggestions of the logged-in user from now on
+func (s *friendshipService) DismissSuggestion(userID, dismissedID uint) error {
+	if userID == dismissedID {
+		return ErrSelfSuggestion
+	}
+
+	if !s.friendshipRepository.IsUserExist(dismissedID) {
+		return ErrUserNotFound
+	}
+
+	return s.friendshipRepository.DismissSuggestion(userID, dismissedID)
+}
+
+func (s *friendshipService) CreateFriendList(userID uint, name string) (*entity.FriendList, error) {
+	name, err := s.checkFriendListName(userID, name, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.friendshipRepository.CreateFriendList(entity.FriendList{UserID: userID, Name: name})
+}
+
+// ListFriendLists lists the friend lists by name, the list is paged by offset as names can change
+func (s *friendshipService) ListFriendLists(userID uint, page pagination.Page) ([]ReadFriendList, string, error) {
+	friendLists, err := s.friendshipRepository.ListFriendLists(userID, page.Offset(), page.Limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	friendLists, nextCursor := pagination.NextOffset(friendLists, page)
+
+	rsp := make([]ReadFriendList, 0, len(friendLists))
+	for _, friendList := range friendLists {
+		rsp = append(rsp, ReadFriendList{
+			Id:          friendList.ID,
+			Name:        friendList.Name,
+			MemberCount: friendList.MemberCount,
+			CreatedAt:   friendList.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return rsp, nextCursor, nil
+}
+
+func (s *friendshipService) GetFriendList(userID, friendListID uint) (*ReadFriendListDetail, error) {
+	friendList, err := s.getOwnFriendList(userID, friendListID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.friendshipRepository.ListFriendListMembers(friendList.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp := &ReadFriendListDetail{
+		ReadFriendList: ReadFriendList{
+			Id:          friendList.ID,
+			Name:        friendList.Name,
+			MemberCount: int64(len(members)),
+			CreatedAt:   friendList.CreatedAt.Format(time.RFC3339),
+		},
+		Members: make([]httpmodel.CommonUser, 0, len(members)),
+	}
+	for _, member := range members {
+		rsp.Members = append(rsp.Members, httpmodel.CommonUser{Id: member.ID, Username: member.Username, FirstName: member.FirstName, LastName: member.LastName, ProfilePhoto: member.ProfilePhoto})
+	}
+	return rsp, nil
+}
+
+func (s *friendshipService) RenameFriendList(userID, friendListID uint, name string) error {
+	friendList, err := s.getOwnFriendList(userID, friendListID)
+	if err != nil {
+		return err
+	}
+
+	name, err = s.checkFriendListName(userID, name, friendList.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.friendshipRepository.RenameFriendList(friendList.ID, name)
+}
+
+func (s *friendshipService) DeleteFriendList(userID, friendListID uint) error {
+	friendList, err := s.getOwnFriendList(userID, friendListID)
+	if err != nil {
+		return err
+	}
+
+	return s.friendshipRepository.DeleteFriendList(friendList.ID)
+}
+
+// AddFriendListMember adds an accepted friend of the user to the list, the membership ends with the friendship
+func (s *friendshipService) AddFriendListMember(userID, friendListID, friendID uint) error {
+	friendList, err := s.getOwnFriendList(userID, friendListID)
+	if err != nil {
+		return err
+	}
+
+	friendship, err := s.friendshipRepository.GetAcceptedFriendship(userID, friendID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFriend
+		}
+		return err
+	}
+
+	return s.friendshipRepository.AddFriendListMember(entity.FriendListMember{
+		FriendListID: friendList.ID,
+		FriendshipID: friendship.ID,
+		MemberID:     friendID,
+	})
+}
+
+func (s *friendshipService) RemoveFriendListMember(userID, friendListID, friendID uint) error {
+	friendList, err := s.getOwnFriendList(userID, friendListID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.friendshipRepository.RemoveFriendListMember(friendList.ID, friendID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// getOwnFriendList hides lists of other users as if they did not exist
+func (s *friendshipService) getOwnFriendList(userID, friendListID uint) (*entity.FriendList, error) {
+	friendList, err := s.friendshipRepository.GetFriendList(friendListID)
+	if err != nil {
+		return nil, err
+	}
+
+	if friendList.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return friendList, nil
+}
+
+func (s *friendshipService) checkFriendListName(userID uint, name string, excludeID uint) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxFriendListName {
+		return "", ErrFriendListName
+	}
+
+	if s.friendshipRepository.IsFriendListNameTaken(userID, name, excludeID) {
+		return "", ErrFriendListTaken
+	}
+	return name, nil
+}
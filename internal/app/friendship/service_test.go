@@ -0,0 +1,55 @@
+package friendship
+
+import (
+	"testing"
+
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// memoryRepository keeps one friendship in memory
+type memoryRepository struct {
+	IFriendshipRepository
+	friendship *entity.Friendship
+}
+
+func (r *memoryRepository) GetFriendRequest(requestID uint) (*entity.Friendship, error) {
+	if r.friendship == nil || r.friendship.ID != requestID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *r.friendship
+	return &copied, nil
+}
+
+func (r *memoryRepository) DeleteFriendRequest(requestID uint) error {
+	r.friendship = nil
+	return nil
+}
+
+func TestRemoveFriendByEitherFriend(t *testing.T) {
+	for name, userID := range map[string]uint{"sender": 1, "receiver": 2} {
+		repository := &memoryRepository{friendship: &entity.Friendship{Model: gorm.Model{ID: 7}, SenderID: 1, ReceiverID: 2, Status: entity.FriendshipStatusAccepted}}
+		s := NewFriendshipService(repository, nil, zap.NewNop().Sugar(), config.Config{})
+
+		if err := s.RemoveFriend(userID, 7); err != nil {
+			t.Fatalf("%s can not remove the friendship: %v", name, err)
+		}
+		if repository.friendship != nil {
+			t.Fatalf("friendship is not deleted for the %s", name)
+		}
+	}
+}
+
+func TestRemoveFriendByOtherUser(t *testing.T) {
+	repository := &memoryRepository{friendship: &entity.Friendship{Model: gorm.Model{ID: 7}, SenderID: 1, ReceiverID: 2, Status: entity.FriendshipStatusAccepted}}
+	s := NewFriendshipService(repository, nil, zap.NewNop().Sugar(), config.Config{})
+
+	if err := s.RemoveFriend(3, 7); err == nil {
+		t.Fatal("someone else removes the friendship")
+	}
+	if repository.friendship == nil {
+		t.Fatal("friendship is deleted")
+	}
+}
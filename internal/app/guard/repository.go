@@ -4,10 +4,16 @@ import (
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"time"
 )
 
 type IGuardRepository interface {
-	CheckTokenInBlacklist(token string) bool
+	FindBlacklistedToken(token string) (*entity.BlackList, error)
+	DeleteExpiredBlacklistedTokens() (int64, error)
+	IsSessionActive(sessionID uint) bool
+	TouchSession(sessionID uint) error
+	GetActiveApiKeyByHash(keyHash string) (*entity.ApiKey, error)
+	TouchApiKey(apiKeyID uint) error
 }
 
 type guardRepository struct {
@@ -22,8 +28,57 @@ func NewRepository(db *gorm.DB, logger *zap.SugaredLogger) IGuardRepository {
 	}
 }
 
-func (r *guardRepository) CheckTokenInBlacklist(token string) bool {
+// FindBlacklistedToken returns nil without an error when the token is not blacklisted
+func (r *guardRepository) FindBlacklistedToken(token string) (*entity.BlackList, error) {
+	var blackLists []entity.BlackList
+	if err := r.db.Where("token = ?", token).Limit(1).Find(&blackLists).Error; err != nil {
+		return nil, err
+	}
+	if len(blackLists) == 0 {
+		return nil, nil
+	}
+	return &blackLists[0], nil
+}
+
+// DeleteExpiredBlacklistedTokens removes tokens which are rejected for their expiry anyway. Rows without an expiry are
+// from before tokens were signed with rotating keys, so none of them can be verified any more either.
+func (r *guardRepository) DeleteExpiredBlacklistedTokens() (int64, error) {
+	result := r.db.Where("expires_at IS NULL OR expires_at < ?", time.Now()).Delete(&entity.BlackList{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *guardRepository) IsSessionActive(sessionID uint) bool {
 	var count int64
-	r.db.Model(&entity.BlackList{}).Where("token = ?", token).Count(&count)
+	r.db.Model(&entity.Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).Count(&count)
 	return count > 0
 }
+
+// TouchSession refreshes last seen time of the session, at most once a minute to avoid a write per request
+func (r *guardRepository) TouchSession(sessionID uint) error {
+	now := time.Now()
+	return r.db.Model(&entity.Session{}).
+		Where("id = ? AND last_seen_at < ?", sessionID, now.Add(-time.Minute)).
+		Update("last_seen_at", now).Error
+}
+
+// GetActiveApiKeyByHash finds a key which is neither revoked nor expired and whose owner is not suspended
+func (r *guardRepository) GetActiveApiKeyByHash(keyHash string) (*entity.ApiKey, error) {
+	var apiKey entity.ApiKey
+	if err := r.db.Model(&entity.ApiKey{}).
+		Joins("JOIN users ON users.id = api_keys.user_id AND users.deleted_at IS NULL").
+		Where("api_keys.key_hash = ? AND api_keys.revoked_at IS NULL", keyHash).
+		Where("api_keys.expires_at IS NULL OR api_keys.expires_at > ?", time.Now()).
+		Where("users.suspended_at IS NULL AND users.deactivated_at IS NULL").
+		First(&apiKey).Error; err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// TouchApiKey refreshes last used time of the key, at most once a minute like sessions
+func (r *guardRepository) TouchApiKey(apiKeyID uint) error {
+	now := time.Now()
+	return r.db.Model(&entity.ApiKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKeyID, now.Add(-time.Minute)).
+		Update("last_used_at", now).Error
+}
@@ -1,17 +1,118 @@
 package guard
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/cache"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	blacklistCacheSize = 100000
+	// A token blacklisted by another instance is rejected after at most this long, its session is revoked at once anyway
+	blacklistNegativeCacheTTL = 10 * time.Second
+	blacklistPurgeInterval    = time.Hour
+)
+
 type IGuardService interface {
 	CheckTokenInBlacklist(token string) bool
+	EvictToken(token string)
+	IsSessionActive(sessionID uint) bool
+	TouchSession(sessionID uint) error
+	AuthenticateApiKey(key string) (*entity.ApiKey, bool)
+	TouchApiKey(apiKeyID uint) error
+	StartBlacklistPurge()
 }
 
 type guardService struct {
 	guardRepository IGuardRepository
+	logger          *zap.SugaredLogger
+	// blacklistCache is keyed by the hash of the token, so that a full cache does not hold megabytes of tokens
+	blacklistCache *cache.LRU[[sha256.Size]byte, bool]
 }
 
-func NewGuardService(guardRepository IGuardRepository) IGuardService {
-	return &guardService{guardRepository: guardRepository}
+func NewGuardService(guardRepository IGuardRepository, logger *zap.SugaredLogger) IGuardService {
+	return &guardService{
+		guardRepository: guardRepository,
+		logger:          logger,
+		blacklistCache:  cache.NewLRU[[sha256.Size]byte, bool](blacklistCacheSize),
+	}
 }
 
+// CheckTokenInBlacklist answers from the cache when it can. Blacklisted tokens are cached until they expire since they can
+// not be taken back, tokens which are not blacklisted only for a short while.
 func (s *guardService) CheckTokenInBlacklist(token string) bool {
-	return s.guardRepository.CheckTokenInBlacklist(token)
+	if token == "" {
+		return false
+	}
+
+	key := sha256.Sum256([]byte(token))
+	if blacklisted, ok := s.blacklistCache.Get(key); ok {
+		return blacklisted
+	}
+
+	blackList, err := s.guardRepository.FindBlacklistedToken(token)
+	if err != nil {
+		return false
+	}
+
+	if blackList == nil {
+		s.blacklistCache.Set(key, false, blacklistNegativeCacheTTL)
+		return false
+	}
+
+	ttl := time.Until(blackList.ExpiresAt)
+	if ttl < blacklistNegativeCacheTTL {
+		ttl = blacklistNegativeCacheTTL
+	}
+	s.blacklistCache.Set(key, true, ttl)
+	return true
+}
+
+// EvictToken drops the cached answer for the token once it is blacklisted, so that this instance does not keep letting
+// it in until a cached "not blacklisted" expires
+func (s *guardService) EvictToken(token string) {
+	s.blacklistCache.Delete(sha256.Sum256([]byte(token)))
+}
+
+// StartBlacklistPurge deletes expired tokens from the blacklist periodically so that it does not grow forever
+func (s *guardService) StartBlacklistPurge() {
+	go func() {
+		ticker := time.NewTicker(blacklistPurgeInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := s.guardRepository.DeleteExpiredBlacklistedTokens(); err != nil {
+				s.logger.Errorf("can not delete expired blacklisted tokens: %v", err)
+			}
+		}
+	}()
+}
+
+func (s *guardService) IsSessionActive(sessionID uint) bool {
+	return s.guardRepository.IsSessionActive(sessionID)
+}
+
+func (s *guardService) TouchSession(sessionID uint) error {
+	return s.guardRepository.TouchSession(sessionID)
+}
+
+func (s *guardService) AuthenticateApiKey(key string) (*entity.ApiKey, bool) {
+	apiKey, err := s.guardRepository.GetActiveApiKeyByHash(HashApiKey(key))
+	if err != nil {
+		return nil, false
+	}
+	return apiKey, true
+}
+
+func (s *guardService) TouchApiKey(apiKeyID uint) error {
+	return s.guardRepository.TouchApiKey(apiKeyID)
+}
+
+// HashApiKey returns the form api keys are stored and looked up with
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
 }
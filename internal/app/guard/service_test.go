@@ -0,0 +1,47 @@
+package guard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"go.uber.org/zap"
+)
+
+// blacklistRepository is a guard repository with an in-memory blacklist which counts its lookups
+type blacklistRepository struct {
+	IGuardRepository
+	tokens  map[string]time.Time
+	lookups int
+}
+
+func (r *blacklistRepository) FindBlacklistedToken(token string) (*entity.BlackList, error) {
+	r.lookups++
+	expiresAt, ok := r.tokens[token]
+	if !ok {
+		return nil, nil
+	}
+	return &entity.BlackList{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+func TestCheckTokenInBlacklistSeesEvictedToken(t *testing.T) {
+	repository := &blacklistRepository{tokens: map[string]time.Time{}}
+	s := NewGuardService(repository, zap.NewNop().Sugar())
+
+	if s.CheckTokenInBlacklist("token") || s.CheckTokenInBlacklist("token") {
+		t.Fatal("token is not blacklisted yet")
+	}
+	if repository.lookups != 1 {
+		t.Fatalf("second check is not answered from the cache, %d lookups", repository.lookups)
+	}
+
+	repository.tokens["token"] = time.Now().Add(time.Hour)
+	s.EvictToken("token")
+
+	if !s.CheckTokenInBlacklist("token") {
+		t.Fatal("blacklisted token is let in from the cache")
+	}
+	if !s.CheckTokenInBlacklist("token") || repository.lookups != 2 {
+		t.Fatalf("blacklisted token is not cached, %d lookups", repository.lookups)
+	}
+}
@@ -1,10 +1,13 @@
 package like
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
 	"github.com/mehmetokdemir/social-media-api/internal/middleware"
 	"go.uber.org/zap"
 	"net/http"
@@ -12,20 +15,22 @@ import (
 )
 
 type HttpHandler struct {
-	likeService   ILikeService
-	logger        *zap.SugaredLogger
-	jwtPrivateKey string
-	guardService  guard.IGuardService
+	likeService       ILikeService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
 }
 
-func NewHttpHandler(guardService guard.IGuardService, likeService ILikeService, logger *zap.SugaredLogger, jwtPrivateKey string) *HttpHandler {
-	return &HttpHandler{guardService: guardService, likeService: likeService, logger: logger, jwtPrivateKey: jwtPrivateKey}
+func NewHttpHandler(guardService guard.IGuardService, likeService ILikeService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, likeService: likeService, logger: logger, signingKeyService: signingKeyService}
 }
 
 func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
-	appGroup := app.Group("/like").Use(middleware.AuthMiddleware(h.jwtPrivateKey))
+	appGroup := app.Group("/like").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
 	appGroup.Post("/posts/:post_id", h.LikePost)
 	appGroup.Post("/comments/:comment_id", h.LikeComment)
+	appGroup.Get("/posts/:post_id", h.ListPostLikers)
+	appGroup.Get("/comments/:comment_id", h.ListCommentLikers)
 }
 
 // LikePost godoc
@@ -38,6 +43,8 @@ func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
 // @Param post_id path integer true "ID of the post to be liked"
 // @Success 200 {object} httpresponse.Response "Success"
 // @Failure 400
+// @Failure 403
+// @Failure 404
 // @Failure 500
 // @Router /like/posts/{post_id} [post]
 func (h *HttpHandler) LikePost(ctx *fiber.Ctx) error {
@@ -62,6 +69,9 @@ func (h *HttpHandler) LikePost(ctx *fiber.Ctx) error {
 	}
 
 	if err = h.likeService.LikePost(userID, uint(postID)); err != nil {
+		if errors.Is(err, ErrPostNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not like post", err.Error(), http.StatusNotFound))
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not like post", err.Error(), http.StatusInternalServerError))
 	}
 
@@ -78,6 +88,8 @@ func (h *HttpHandler) LikePost(ctx *fiber.Ctx) error {
 // @Param comment_id path integer true "ID of the comment to be liked"
 // @Success 200 {object} httpresponse.Response "Success"
 // @Failure 400
+// @Failure 403
+// @Failure 404
 // @Failure 500
 // @Router /like/comments/{comment_id} [post]
 func (h *HttpHandler) LikeComment(ctx *fiber.Ctx) error {
@@ -102,8 +114,81 @@ func (h *HttpHandler) LikeComment(ctx *fiber.Ctx) error {
 	}
 
 	if err = h.likeService.LikeComment(userID, uint(commentID)); err != nil {
+		if errors.Is(err, ErrCommentNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not like comment", err.Error(), http.StatusNotFound))
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not like comment", err.Error(), http.StatusInternalServerError))
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
 }
+
+// ListPostLikers godoc
+// @Summary List likers of post
+// @Description List users who liked the post newest first, blocked users are left out
+// @Tags Like
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param post_id path integer true "ID of the post"
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadLikerResponse "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /like/posts/{post_id} [get]
+func (h *HttpHandler) ListPostLikers(ctx *fiber.Ctx) error {
+	return h.listLikers(ctx, "post_id", h.likeService.ListPostLikers)
+}
+
+// ListCommentLikers godoc
+// @Summary List likers of comment
+// @Description List users who liked the comment newest first, blocked users are left out
+// @Tags Like
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param comment_id path integer true "ID of the comment"
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadLikerResponse "Success"
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /like/comments/{comment_id} [get]
+func (h *HttpHandler) ListCommentLikers(ctx *fiber.Ctx) error {
+	return h.listLikers(ctx, "comment_id", h.likeService.ListCommentLikers)
+}
+
+func (h *HttpHandler) listLikers(ctx *fiber.Ctx, param string, list func(viewerID, contentID uint, page pagination.Page) ([]ReadLikerResponse, string, error)) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	contentID, err := strconv.ParseUint(ctx.Params(param), 10, 64)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse "+param, err.Error(), http.StatusBadRequest))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get likers", err.Error(), http.StatusBadRequest))
+	}
+
+	likers, nextCursor, err := list(userID, uint(contentID), page)
+	if err != nil {
+		if errors.Is(err, ErrPostNotFound) || errors.Is(err, ErrCommentNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not get likers", "content not found", http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get likers", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, likers, nextCursor))
+}
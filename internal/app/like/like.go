@@ -0,0 +1,8 @@
+package like
+
+import "github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+
+type ReadLikerResponse struct {
+	User    httpmodel.CommonUser `json:"user" extensions:"x-order=1"`
+	LikedAt string               `json:"liked_at" extensions:"x-order=2" example:"2024-01-22T11:31:40+03:00"`
+}
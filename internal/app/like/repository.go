@@ -1,6 +1,8 @@
 package like
 
 import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/scopes"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -9,17 +11,20 @@ import (
 type ILikeRepository interface {
 	Like(like entity.Like) (*entity.Like, error)
 
-	IsPostExist(postID uint) bool
-	IsCommentExist(commentID uint) bool
+	IsPostVisible(viewerID, postID uint) bool
+	IsCommentVisible(viewerID, commentID uint) bool
 
 	IsPostLikedByUser(userID uint, postID uint) (bool, error)
 	IsCommentLikedByUser(userID uint, commentID uint) (bool, error)
 
 	GetLikesByID(contentID uint, contentType entity.ContentType) ([]*entity.Like, error)
 	DeleteLikes(id uint, contentType entity.ContentType) error
-	GetCountOfLikes(id uint, contentType entity.ContentType) int64
+	CountLikesByIDs(ids []uint, contentType entity.ContentType) (map[uint]int64, error)
+	ListLikedIDs(userID uint, ids []uint, contentType entity.ContentType) (map[uint]bool, error)
+	CountLikesReceived(userID uint) (int64, error)
 
 	ListCommentLikesByParentID(parentID uint) ([]*entity.Like, error)
+	ListLikers(viewerID, contentID uint, contentType entity.ContentType, page pagination.Page) ([]entity.Like, error)
 	Migration() error
 }
 
@@ -42,22 +47,21 @@ func (r *likeRepository) Like(like entity.Like) (*entity.Like, error) {
 	return &like, nil
 }
 
-func (r *likeRepository) IsPostExist(postID uint) bool {
-	var post *entity.Post
-	if err := r.db.Model(&entity.Post{}).Where("id =?", postID).First(&post).Error; err != nil || post == nil {
-		return false
-	}
-
-	return true
+// IsPostVisible tells whether the post exists and the viewer can see it
+func (r *likeRepository) IsPostVisible(viewerID, postID uint) bool {
+	var count int64
+	r.db.Model(&entity.Post{}).Scopes(scopes.VisiblePost(viewerID)).Where("posts.id = ?", postID).Count(&count)
+	return count > 0
 }
 
-func (r *likeRepository) IsCommentExist(commentID uint) bool {
-	var comment *entity.Comment
-	if err := r.db.Model(&entity.Comment{}).Where("id =?", commentID).First(&comment).Error; err != nil || comment == nil {
-		return false
-	}
-
-	return true
+// IsCommentVisible tells whether the comment exists, its author did not block the viewer nor was blocked by them and the
+// viewer can see the post it was left on
+func (r *likeRepository) IsCommentVisible(viewerID, commentID uint) bool {
+	var count int64
+	r.db.Model(&entity.Comment{}).Joins("JOIN posts ON posts.id = comments.post_id AND posts.deleted_at IS NULL").
+		Scopes(scopes.ActiveUser("comments.user_id"), scopes.NotBlocked(viewerID, "comments.user_id"), scopes.VisiblePost(viewerID)).
+		Where("comments.id = ?", commentID).Count(&count)
+	return count > 0
 }
 
 func (r *likeRepository) IsPostLikedByUser(userID, postID uint) (bool, error) {
@@ -116,12 +120,72 @@ func (r *likeRepository) ListCommentLikesByParentID(parentID uint) ([]*entity.Li
 	return likes, nil
 }
 
-func (r *likeRepository) GetCountOfLikes(id uint, contentType entity.ContentType) int64 {
-	var count int64
-	if err := r.db.Model(&entity.Like{}).Where("content_id = ? AND content_type = ?", id, contentType).Count(&count).Error; err != nil {
-		return 0
+// ListLikers lists the likes of the post or comment newest first with the users who liked it, users blocked in either
+// direction by the viewer are left out before the page is cut
+func (r *likeRepository) ListLikers(viewerID, contentID uint, contentType entity.ContentType, page pagination.Page) ([]entity.Like, error) {
+	var likes []entity.Like
+	if err := r.db.Preload("User").Model(&entity.Like{}).
+		Scopes(scopes.ActiveUser("likes.user_id"), scopes.NotBlocked(viewerID, "likes.user_id"), page.Scope("likes")).
+		Where("content_id = ? AND content_type = ?", contentID, contentType).
+		Find(&likes).Error; err != nil {
+		return nil, err
 	}
-	return count
+	return likes, nil
+}
+
+// CountLikesByIDs counts the likes of all the posts or comments with one grouped query, content without likes is
+// missing from the map
+func (r *likeRepository) CountLikesByIDs(ids []uint, contentType entity.ContentType) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		ContentID uint
+		Count     int64
+	}
+	if err := r.db.Model(&entity.Like{}).Select("likes.content_id, COUNT(*) AS count").
+		Scopes(scopes.ActiveUser("likes.user_id")).
+		Where("likes.content_id IN ? AND likes.content_type = ?", ids, contentType).
+		Group("likes.content_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.ContentID] = row.Count
+	}
+	return counts, nil
+}
+
+// ListLikedIDs returns which of the posts or comments the user liked
+func (r *likeRepository) ListLikedIDs(userID uint, ids []uint, contentType entity.ContentType) (map[uint]bool, error) {
+	liked := make(map[uint]bool, len(ids))
+	if len(ids) == 0 {
+		return liked, nil
+	}
+
+	var likedIDs []uint
+	if err := r.db.Model(&entity.Like{}).Where("user_id = ? AND content_id IN ? AND content_type = ?", userID, ids, contentType).Pluck("content_id", &likedIDs).Error; err != nil {
+		return nil, err
+	}
+
+	for _, id := range likedIDs {
+		liked[id] = true
+	}
+	return liked, nil
+}
+
+// CountLikesReceived counts likes of the posts and comments of the user which are not deleted
+func (r *likeRepository) CountLikesReceived(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Like{}).
+		Scopes(scopes.ActiveUser("likes.user_id")).
+		Joins("LEFT JOIN posts ON likes.content_type = ? AND posts.id = likes.content_id AND posts.deleted_at IS NULL", entity.ContentTypePost).
+		Joins("LEFT JOIN comments ON likes.content_type = ? AND comments.id = likes.content_id AND comments.deleted_at IS NULL", entity.ContentTypeComment).
+		Where("posts.user_id = ? OR comments.user_id = ?", userID, userID).
+		Count(&count).Error
+	return count, err
 }
 
 func (r *likeRepository) Migration() error {
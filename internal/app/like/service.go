@@ -1,10 +1,19 @@
 package like
 
 import (
+	"errors"
 	"fmt"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"github.com/mehmetokdemir/social-media-api/internal/config"
 	"go.uber.org/zap"
+	"time"
+)
+
+var (
+	ErrPostNotFound    = errors.New("post not found")
+	ErrCommentNotFound = errors.New("comment not found")
 )
 
 type ILikeService interface {
@@ -12,10 +21,14 @@ type ILikeService interface {
 	DeleteLikesByPostID(postID uint) error
 	GetCommentsLikeByID(commentID uint) ([]*entity.Like, error)
 	GetPostsLikeByID(postID uint) ([]*entity.Like, error)
-	GetPostCountLikeByID(postID uint) int64
-	GetCommentCountLikeByID(commentID uint) int64
+	CountPostLikes(postIDs []uint) (map[uint]int64, error)
+	CountCommentLikes(commentIDs []uint) (map[uint]int64, error)
+	PostsLikedByUser(userID uint, postIDs []uint) (map[uint]bool, error)
+	CountLikesReceived(userID uint) (int64, error)
 	LikePost(userID, postID uint) error
 	LikeComment(userID, commentID uint) error
+	ListPostLikers(viewerID, postID uint, page pagination.Page) ([]ReadLikerResponse, string, error)
+	ListCommentLikers(viewerID, commentID uint, page pagination.Page) ([]ReadLikerResponse, string, error)
 }
 
 type likeService struct {
@@ -44,8 +57,8 @@ func (s *likeService) DeleteLikesByPostID(postID uint) error {
 }
 
 func (s *likeService) LikePost(userID, postID uint) error {
-	if ok := s.likeRepository.IsPostExist(postID); !ok {
-		return fmt.Errorf("can not find post with id %d", postID)
+	if ok := s.likeRepository.IsPostVisible(userID, postID); !ok {
+		return ErrPostNotFound
 	}
 
 	isPostLikedByUser, err := s.likeRepository.IsPostLikedByUser(userID, postID)
@@ -70,8 +83,8 @@ func (s *likeService) LikePost(userID, postID uint) error {
 }
 
 func (s *likeService) LikeComment(userID, commentID uint) error {
-	if ok := s.likeRepository.IsCommentExist(commentID); !ok {
-		return fmt.Errorf("can not find post with id %d", commentID)
+	if ok := s.likeRepository.IsCommentVisible(userID, commentID); !ok {
+		return ErrCommentNotFound
 	}
 
 	if ok, err := s.likeRepository.IsCommentLikedByUser(userID, commentID); err != nil || ok {
@@ -89,6 +102,38 @@ func (s *likeService) LikeComment(userID, commentID uint) error {
 	return nil
 }
 
+func (s *likeService) ListPostLikers(viewerID, postID uint, page pagination.Page) ([]ReadLikerResponse, string, error) {
+	if ok := s.likeRepository.IsPostVisible(viewerID, postID); !ok {
+		return nil, "", ErrPostNotFound
+	}
+	return s.listLikers(viewerID, postID, entity.ContentTypePost, page)
+}
+
+func (s *likeService) ListCommentLikers(viewerID, commentID uint, page pagination.Page) ([]ReadLikerResponse, string, error) {
+	if ok := s.likeRepository.IsCommentVisible(viewerID, commentID); !ok {
+		return nil, "", ErrCommentNotFound
+	}
+	return s.listLikers(viewerID, commentID, entity.ContentTypeComment, page)
+}
+
+// listLikers lists who liked the content, users blocked by or blocking the viewer are left out
+func (s *likeService) listLikers(viewerID, contentID uint, contentType entity.ContentType, page pagination.Page) ([]ReadLikerResponse, string, error) {
+	likes, err := s.likeRepository.ListLikers(viewerID, contentID, contentType, page)
+	if err != nil {
+		return nil, "", err
+	}
+	likes, nextCursor := pagination.Next(likes, page, func(like entity.Like) (time.Time, uint) { return like.CreatedAt, like.ID })
+
+	rsp := make([]ReadLikerResponse, 0, len(likes))
+	for _, like := range likes {
+		rsp = append(rsp, ReadLikerResponse{
+			User:    httpmodel.CommonUser{Id: like.UserID, Username: like.User.Username, FirstName: like.User.FirstName, LastName: like.User.LastName, ProfilePhoto: like.User.ProfilePhoto},
+			LikedAt: like.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return rsp, nextCursor, nil
+}
+
 func (s *likeService) GetCommentsLikeByID(commentID uint) ([]*entity.Like, error) {
 	fmt.Println("get GetCommentsLikeByID")
 	likes, err := s.likeRepository.GetLikesByID(commentID, entity.ContentTypeComment)
@@ -99,11 +144,20 @@ func (s *likeService) GetCommentsLikeByID(commentID uint) ([]*entity.Like, error
 	return likes, nil
 }
 
-func (s *likeService) GetPostCountLikeByID(postID uint) int64 {
-	return s.likeRepository.GetCountOfLikes(postID, entity.ContentTypePost)
+func (s *likeService) CountPostLikes(postIDs []uint) (map[uint]int64, error) {
+	return s.likeRepository.CountLikesByIDs(postIDs, entity.ContentTypePost)
 }
-func (s *likeService) GetCommentCountLikeByID(commentID uint) int64 {
-	return s.likeRepository.GetCountOfLikes(commentID, entity.ContentTypeComment)
+
+func (s *likeService) CountCommentLikes(commentIDs []uint) (map[uint]int64, error) {
+	return s.likeRepository.CountLikesByIDs(commentIDs, entity.ContentTypeComment)
+}
+
+func (s *likeService) PostsLikedByUser(userID uint, postIDs []uint) (map[uint]bool, error) {
+	return s.likeRepository.ListLikedIDs(userID, postIDs, entity.ContentTypePost)
+}
+
+func (s *likeService) CountLikesReceived(userID uint) (int64, error) {
+	return s.likeRepository.CountLikesReceived(userID)
 }
 
 func (s *likeService) GetPostsLikeByID(postID uint) ([]*entity.Like, error) {
@@ -0,0 +1,68 @@
+package like
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// blockCheck matches the check that neither the viewer blocked the author in column nor the author blocked the viewer
+func blockCheck(column string) string {
+	return `NOT EXISTS \(SELECT 1 FROM blocks WHERE \(blocks.blocker_id = \$\d+ AND blocks.blocked_id = ` + column +
+		`\) OR \(blocks.blocker_id = ` + column + ` AND blocks.blocked_id = \$\d+\)\)`
+}
+
+func newLikeService(t *testing.T) (ILikeService, sqlmock.Sqlmock) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewLikeService(NewRepository(db, zap.NewNop().Sugar()), zap.NewNop().Sugar(), config.Config{}), mock
+}
+
+func TestBlockedPairCanNotLikeOrSeeLikesOfPost(t *testing.T) {
+	s, mock := newLikeService(t)
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "posts" WHERE posts.id = \$1 AND .*` + blockCheck("posts.user_id")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	}
+
+	if err := s.LikePost(1, 9); !errors.Is(err, ErrPostNotFound) {
+		t.Fatalf("post of a blocked pair can be liked: %v", err)
+	}
+	if _, _, err := s.ListPostLikers(1, 9, pagination.Page{Limit: pagination.DefaultLimit}); !errors.Is(err, ErrPostNotFound) {
+		t.Fatalf("likers of a post of a blocked pair are listed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockedPairCanNotLikeComment(t *testing.T) {
+	s, mock := newLikeService(t)
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "comments" JOIN posts .* WHERE comments.id = \$\d+ AND .*` +
+		blockCheck("comments.user_id") + `.*` + blockCheck("posts.user_id")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	if err := s.LikeComment(1, 9); !errors.Is(err, ErrCommentNotFound) {
+		t.Fatalf("comment of a blocked pair can be liked: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
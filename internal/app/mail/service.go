@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DriverSmtp   = "smtp"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type IMailer interface {
+	Send(message Message) error
+}
+
+// NewMailer returns the mailer selected with MAIL_DRIVER, file mailer is used when it is not set
+func NewMailer(config config.Config) (IMailer, error) {
+	switch config.MailDriver {
+	case DriverSmtp:
+		return NewSmtpMailer(config), nil
+	case DriverMemory:
+		return NewMemoryMailer(), nil
+	case DriverFile, "":
+		return NewFileMailer(config.MailFileDir, config.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %s", config.MailDriver)
+	}
+}
+
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewSmtpMailer(config config.Config) IMailer {
+	return &smtpMailer{
+		host:     config.SmtpHost,
+		port:     config.SmtpPort,
+		username: config.SmtpUsername,
+		password: config.SmtpPassword,
+		from:     config.MailFrom,
+	}
+}
+
+func (m *smtpMailer) Send(message Message) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	return smtp.SendMail(fmt.Sprintf("%s:%s", m.host, m.port), auth, m.from, []string{message.To}, buildMessage(m.from, message))
+}
+
+// fileMailer writes every message into a directory instead of sending it, for local development
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) IMailer {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return &fileMailer{dir: dir, from: from}
+}
+
+func (m *fileMailer) Send(message Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), strings.ReplaceAll(message.To, "@", "_at_"))
+	return os.WriteFile(filepath.Join(m.dir, fileName), buildMessage(m.from, message), 0o644)
+}
+
+// MemoryMailer keeps sent messages in memory so tests can read them back
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(message Message) error {
+	if message.To == "" {
+		return errors.New("recipient is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+func buildMessage(from string, message Message) []byte {
+	return []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		from, message.To, message.Subject, message.Body))
+}
@@ -0,0 +1,98 @@
+package oidc
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/auth"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type HttpHandler struct {
+	oidcService IOidcService
+	logger      *zap.SugaredLogger
+}
+
+func NewHttpHandler(oidcService IOidcService, logger *zap.SugaredLogger) *HttpHandler {
+	return &HttpHandler{oidcService: oidcService, logger: logger}
+}
+
+func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
+	noAuthGroup := app.Group("/oidc")
+	noAuthGroup.Get("/:provider/authorize", h.Authorize)
+	noAuthGroup.Get("/:provider/callback", h.Callback)
+}
+
+// Authorize godoc
+// @Summary Start login with an identity provider
+// @Description Start an authorization code flow with PKCE against the provider and return the url to send the user to.
+// @Description Providers are configured with OIDC_PROVIDERS.
+// @Tags Oidc
+// @Accept  json
+// @Produce  json
+// @Param provider path string true "Name of the provider, like google"
+// @Success 200 {object} AuthorizeResponse
+// @Failure 404
+// @Failure 500
+// @Router /oidc/{provider}/authorize [get]
+func (h *HttpHandler) Authorize(ctx *fiber.Ctx) error {
+	rsp, err := h.oidcService.Authorize(ctx.Params("provider"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownProvider) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not start login", err.Error(), http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not start login", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
+
+// Callback godoc
+// @Summary Complete login with an identity provider
+// @Description The provider redirects here after the user logs in. The external identity is linked to the user with the same
+// @Description verified email or a new user is created. Response is the same as /auth/login, including mfa_required.
+// @Tags Oidc
+// @Accept  json
+// @Produce  json
+// @Param provider path string true "Name of the provider, like google"
+// @Param code query string true "Authorization code given by the provider"
+// @Param state query string true "State given at authorize"
+// @Success 200 {object} auth.LoginResponse
+// @Failure 400
+// @Failure 401
+// @Failure 403
+// @Failure 404
+// @Failure 409
+// @Failure 500
+// @Router /oidc/{provider}/callback [get]
+func (h *HttpHandler) Callback(ctx *fiber.Ctx) error {
+	if providerErr := ctx.Query("error"); providerErr != "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not create token", providerErr, http.StatusBadRequest))
+	}
+
+	code, state := ctx.Query("code"), ctx.Query("state")
+	if code == "" || state == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("code and state are required", "code and state are required", http.StatusBadRequest))
+	}
+
+	rsp, err := h.oidcService.Callback(ctx.Params("provider"), code, state, auth.DeviceInfo{
+		UserAgent: ctx.Get(fiber.HeaderUserAgent),
+		IP:        ctx.IP(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownProvider):
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusNotFound))
+		case errors.Is(err, ErrInvalidState):
+			return ctx.Status(fiber.StatusUnauthorized).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusUnauthorized))
+		case errors.Is(err, ErrUnlinkableEmail):
+			return ctx.Status(fiber.StatusConflict).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusConflict))
+		case errors.Is(err, auth.ErrSuspendedUser), errors.Is(err, auth.ErrDeactivatedUser):
+			return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusForbidden))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not create token", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, rsp))
+}
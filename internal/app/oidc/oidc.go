@@ -0,0 +1,5 @@
+package oidc
+
+type AuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url" extensions:"x-order=1" example:"https://accounts.google.com/o/oauth2/v2/auth?client_id=..."` // Send the user to this url to login with the provider
+}
@@ -0,0 +1,77 @@
+package oidc
+
+import (
+	"errors"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type IOidcRepository interface {
+	CreateState(state entity.OidcState) error
+	ConsumeState(stateHash, provider string) (*entity.OidcState, error)
+	GetExternalIdentity(provider, subject string) (*entity.ExternalIdentity, error)
+	CreateExternalIdentity(externalIdentity entity.ExternalIdentity) (*entity.ExternalIdentity, error)
+	Migration() error
+}
+
+type oidcRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewRepository(db *gorm.DB, logger *zap.SugaredLogger) IOidcRepository {
+	return &oidcRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *oidcRepository) CreateState(state entity.OidcState) error {
+	return r.db.Create(&state).Error
+}
+
+// ConsumeState marks the state used so that a callback can not be replayed, expired states are not accepted
+func (r *oidcRepository) ConsumeState(stateHash, provider string) (*entity.OidcState, error) {
+	var state entity.OidcState
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ? AND provider = ?", stateHash, provider).First(&state).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&entity.OidcState{}).
+			Where("id = ? AND used_at IS NULL AND expires_at > ?", state.ID, time.Now()).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("state is already used or expired")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *oidcRepository) GetExternalIdentity(provider, subject string) (*entity.ExternalIdentity, error) {
+	var externalIdentity entity.ExternalIdentity
+	if err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&externalIdentity).Error; err != nil {
+		return nil, err
+	}
+	return &externalIdentity, nil
+}
+
+func (r *oidcRepository) CreateExternalIdentity(externalIdentity entity.ExternalIdentity) (*entity.ExternalIdentity, error) {
+	if err := r.db.Create(&externalIdentity).Error; err != nil {
+		return nil, err
+	}
+	return &externalIdentity, nil
+}
+
+func (r *oidcRepository) Migration() error {
+	return r.db.AutoMigrate(entity.OidcState{}, entity.ExternalIdentity{})
+}
@@ -0,0 +1,244 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mehmetokdemir/social-media-api/internal/app/auth"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/user"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	stateDuration          = 10 * time.Minute
+	usernameAttemptCount   = 5
+	generatedPasswordBytes = 32
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidState    = errors.New("invalid or expired state")
+	ErrUnlinkableEmail = errors.New("an account with this email exists, login with password to use it")
+)
+
+type IOidcService interface {
+	Authorize(providerName string) (*AuthorizeResponse, error)
+	Callback(providerName, code, state string, device auth.DeviceInfo) (*auth.LoginResponse, error)
+}
+
+type oidcService struct {
+	config      config.Config
+	logger      *zap.SugaredLogger
+	repository  IOidcRepository
+	providers   map[string]IProvider
+	userService user.IUserService
+	authService auth.IAuthService
+}
+
+func NewOidcService(repository IOidcRepository, providers []IProvider, userService user.IUserService, authService auth.IAuthService, logger *zap.SugaredLogger, config config.Config) IOidcService {
+	if repository == nil {
+		return nil
+	}
+
+	providersByName := make(map[string]IProvider)
+	for _, provider := range providers {
+		providersByName[provider.Name()] = provider
+	}
+
+	return &oidcService{
+		config:      config,
+		logger:      logger,
+		repository:  repository,
+		providers:   providersByName,
+		userService: userService,
+		authService: authService,
+	}
+}
+
+func (s *oidcService) Authorize(providerName string) (*AuthorizeResponse, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	state, err := s.generateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := s.generateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	codeVerifier, err := s.generateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.repository.CreateState(entity.OidcState{
+		StateHash:    s.hash(state),
+		Provider:     provider.Name(),
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(stateDuration),
+	}); err != nil {
+		return nil, err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	authorizationURL, err := provider.AuthCodeURL(state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]), s.redirectURI(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthorizeResponse{AuthorizationURL: authorizationURL}, nil
+}
+
+func (s *oidcService) Callback(providerName, code, state string, device auth.DeviceInfo) (*auth.LoginResponse, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	storedState, err := s.repository.ConsumeState(s.hash(state), provider.Name())
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+
+	identity, err := provider.Exchange(code, storedState.CodeVerifier, s.redirectURI(provider))
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(identity.Nonce), []byte(storedState.Nonce)) != 1 {
+		return nil, errors.New("id token nonce does not match")
+	}
+
+	userID, err := s.resolveUser(provider.Name(), identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authService.CreateTokenForUser(userID, device)
+}
+
+// resolveUser finds the user linked to the identity, links an existing user by verified email or creates a new one
+func (s *oidcService) resolveUser(providerName string, identity *Identity) (uint, error) {
+	if externalIdentity, err := s.repository.GetExternalIdentity(providerName, identity.Subject); err == nil {
+		return externalIdentity.UserID, nil
+	}
+
+	if identity.Email == "" {
+		return 0, errors.New("identity provider did not share an email")
+	}
+
+	if userByEmail, err := s.userService.GetUserByEmail(identity.Email); err == nil {
+		// Both sides must have proven the email, otherwise whoever registered it first could take the account over
+		if !identity.EmailVerified || userByEmail.EmailVerifiedAt == nil {
+			return 0, ErrUnlinkableEmail
+		}
+		return s.link(providerName, identity, userByEmail.ID)
+	}
+
+	password, err := s.generateRandomString(generatedPasswordBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	username, err := s.availableUsername(identity.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	newUser := entity.User{
+		FirstName:    identity.GivenName,
+		LastName:     identity.FamilyName,
+		Email:        identity.Email,
+		Username:     username,
+		Password:     password,
+		Passwordless: true,
+	}
+	if identity.EmailVerified {
+		now := time.Now()
+		newUser.EmailVerifiedAt = &now
+	}
+
+	createdUser, err := s.userService.CreateUser(newUser)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.link(providerName, identity, createdUser.ID)
+}
+
+func (s *oidcService) link(providerName string, identity *Identity, userID uint) (uint, error) {
+	if _, err := s.repository.CreateExternalIdentity(entity.ExternalIdentity{
+		UserID:   userID,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// availableUsername derives a username from the local part of the email, adding a number when it is taken
+func (s *oidcService) availableUsername(email string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.SplitN(email, "@", 2)[0]) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+
+	base := b.String()
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > user.MaxUsernameLength-5 {
+		base = base[:user.MaxUsernameLength-5]
+	}
+
+	if _, err := s.userService.GetUserByUsername(base); err != nil {
+		return base, nil
+	}
+
+	for i := 0; i < usernameAttemptCount; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate := fmt.Sprintf("%s%04d", base, n.Int64())
+		if _, err = s.userService.GetUserByUsername(candidate); err != nil {
+			return candidate, nil
+		}
+	}
+
+	return "", errors.New("can not find an available username")
+}
+
+func (s *oidcService) redirectURI(provider IProvider) string {
+	return strings.TrimSuffix(s.config.AppBaseURL, "/") + "/oidc/" + provider.Name() + "/callback"
+}
+
+func (s *oidcService) generateRandomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *oidcService) hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
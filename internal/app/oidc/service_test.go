@@ -0,0 +1,207 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mehmetokdemir/social-media-api/internal/app/auth"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// stateRepository keeps the states in memory, a state is consumed the way the database one is: once and before it expires
+type stateRepository struct {
+	IOidcRepository
+	states []entity.OidcState
+}
+
+func (r *stateRepository) CreateState(state entity.OidcState) error {
+	r.states = append(r.states, state)
+	return nil
+}
+
+func (r *stateRepository) ConsumeState(stateHash, provider string) (*entity.OidcState, error) {
+	for i := range r.states {
+		state := &r.states[i]
+		if state.StateHash != stateHash || state.Provider != provider {
+			continue
+		}
+		if state.UsedAt != nil || !state.ExpiresAt.After(time.Now()) {
+			return nil, errors.New("state is already used or expired")
+		}
+		now := time.Now()
+		state.UsedAt = &now
+		copied := *state
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *stateRepository) GetExternalIdentity(provider, subject string) (*entity.ExternalIdentity, error) {
+	return &entity.ExternalIdentity{UserID: 5, Provider: provider, Subject: subject}, nil
+}
+
+// pkceProvider checks the code verifier against the challenge of the authorization request like a provider does
+type pkceProvider struct {
+	name      string
+	challenge string
+	nonce     string
+	exchanges int
+}
+
+func (p *pkceProvider) Name() string {
+	return p.name
+}
+
+func (p *pkceProvider) AuthCodeURL(state, nonce, codeChallenge, redirectURI string) (string, error) {
+	p.challenge, p.nonce = codeChallenge, nonce
+	return "https://idp.example.com/authorize?" + url.Values{"state": {state}}.Encode(), nil
+}
+
+func (p *pkceProvider) Exchange(code, codeVerifier, redirectURI string) (*Identity, error) {
+	p.exchanges++
+	sum := sha256.Sum256([]byte(codeVerifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		return nil, errors.New("code verifier does not match the challenge")
+	}
+	return &Identity{Subject: "subject", Nonce: p.nonce}, nil
+}
+
+type tokenAuthService struct {
+	auth.IAuthService
+}
+
+func (s *tokenAuthService) CreateTokenForUser(userID uint, device auth.DeviceInfo) (*auth.LoginResponse, error) {
+	return &auth.LoginResponse{TokenHash: "token"}, nil
+}
+
+func newOidcService(providers ...IProvider) (*oidcService, *stateRepository) {
+	repository := &stateRepository{}
+	s := NewOidcService(repository, providers, nil, &tokenAuthService{}, zap.NewNop().Sugar(), config.Config{AppBaseURL: "https://app.example.com"})
+	return s.(*oidcService), repository
+}
+
+// authorize starts a login and returns the state the provider redirects back with
+func authorize(t *testing.T, s *oidcService, providerName string) string {
+	t.Helper()
+
+	rsp, err := s.Authorize(providerName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizationURL, err := url.Parse(rsp.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authorizationURL.Query().Get("state")
+}
+
+func TestCallbackSendsVerifierOfChallenge(t *testing.T) {
+	provider := &pkceProvider{name: "google"}
+	s, repository := newOidcService(provider)
+	state := authorize(t, s, "google")
+
+	if repository.states[0].StateHash == state {
+		t.Fatal("state is stored in plain")
+	}
+	if provider.challenge == repository.states[0].CodeVerifier {
+		t.Fatal("code verifier is sent to the provider in plain")
+	}
+
+	rsp, err := s.Callback("google", "code", state, auth.DeviceInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.TokenHash != "token" {
+		t.Fatalf("user is not logged in: %+v", rsp)
+	}
+}
+
+func TestCallbackRejectsUnknownAndReplayedState(t *testing.T) {
+	provider := &pkceProvider{name: "google"}
+	s, _ := newOidcService(provider)
+	state := authorize(t, s, "google")
+
+	if _, err := s.Callback("google", "code", state+"x", auth.DeviceInfo{}); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("unknown state is accepted: %v", err)
+	}
+	if _, err := s.Callback("google", "code", state, auth.DeviceInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Callback("google", "code", state, auth.DeviceInfo{}); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("state is accepted twice: %v", err)
+	}
+	if provider.exchanges != 1 {
+		t.Fatalf("code of a rejected state is exchanged, %d exchanges", provider.exchanges)
+	}
+}
+
+func TestCallbackRejectsStateOfOtherProvider(t *testing.T) {
+	google, github := &pkceProvider{name: "google"}, &pkceProvider{name: "github"}
+	s, _ := newOidcService(google, github)
+	state := authorize(t, s, "google")
+
+	if _, err := s.Callback("github", "code", state, auth.DeviceInfo{}); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("state of another provider is accepted: %v", err)
+	}
+	if _, err := s.Callback("gitlab", "code", state, auth.DeviceInfo{}); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("expected unknown provider, got %v", err)
+	}
+}
+
+func TestCallbackRejectsExpiredState(t *testing.T) {
+	s, repository := newOidcService(&pkceProvider{name: "google"})
+	state := authorize(t, s, "google")
+	repository.states[0].ExpiresAt = time.Now().Add(-time.Second)
+
+	if _, err := s.Callback("google", "code", state, auth.DeviceInfo{}); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expired state is accepted: %v", err)
+	}
+}
+
+func TestCallbackRejectsNonceMismatch(t *testing.T) {
+	provider := &pkceProvider{name: "google"}
+	s, _ := newOidcService(provider)
+	state := authorize(t, s, "google")
+	provider.nonce = "other"
+
+	if _, err := s.Callback("google", "code", state, auth.DeviceInfo{}); err == nil {
+		t.Fatal("id token with another nonce is accepted")
+	}
+}
+
+func TestConsumeStateRejectsUsedOrExpiredState(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "oidc_states" WHERE \(state_hash = \$1 AND provider = \$2\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state_hash", "provider"}).AddRow(1, "hash", "google"))
+	mock.ExpectExec(`UPDATE "oidc_states" SET .* WHERE \(id = \$3 AND used_at IS NULL AND expires_at > \$4\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	if _, err = NewRepository(db, zap.NewNop().Sugar()).ConsumeState("hash", "google"); err == nil {
+		t.Fatal("used or expired state is consumed")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
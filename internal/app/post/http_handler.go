@@ -1,12 +1,15 @@
 package post
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
 	"github.com/mehmetokdemir/social-media-api/internal/middleware"
 	"go.uber.org/zap"
 	"net/http"
@@ -14,24 +17,27 @@ import (
 )
 
 type HttpHandler struct {
-	postService   IPostService
-	logger        *zap.SugaredLogger
-	jwtPrivateKey string
-	guardService  guard.IGuardService
+	postService       IPostService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
 }
 
-func NewHttpHandler(guardService guard.IGuardService, postService IPostService, logger *zap.SugaredLogger, jwtPrivateKey string) *HttpHandler {
-	return &HttpHandler{guardService: guardService, postService: postService, logger: logger, jwtPrivateKey: jwtPrivateKey}
+func NewHttpHandler(guardService guard.IGuardService, postService IPostService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, postService: postService, logger: logger, signingKeyService: signingKeyService}
 }
 
 func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
-	appGroup := app.Group("/post").Use(middleware.AuthMiddleware(h.jwtPrivateKey))
+	appGroup := app.Group("/post").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
 	appGroup.Post("/create", h.Create)
 	appGroup.Put("/update", h.Update)
 	appGroup.Put("/update/:post_id/image", h.UpdateImage)
 	appGroup.Delete("/delete/:post_id", h.Delete)
 	appGroup.Get("/list", h.List)
 	appGroup.Get("/get/:post_id", h.Get)
+
+	feedGroup := app.Group("/feed").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
+	feedGroup.Get("", h.Feed)
 }
 
 // Create godoc
@@ -44,6 +50,7 @@ func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
 // @Param request body CreateRequest true "body params"
 // @Success 200 {object} httpmodel.CreateResponse
 // @Failure 400
+// @Failure 403
 // @Failure 500
 // @Router /post/create [post]
 func (h *HttpHandler) Create(ctx *fiber.Ctx) error {
@@ -64,11 +71,25 @@ func (h *HttpHandler) Create(ctx *fiber.Ctx) error {
 
 	// TODO ADD VALIDATOR
 
+	audience := make([]entity.PostAudienceMember, 0, len(req.AudienceIDs))
+	for _, audienceID := range req.AudienceIDs {
+		audience = append(audience, entity.PostAudienceMember{UserID: audienceID})
+	}
+
 	post, err := h.postService.CreatePost(entity.Post{
-		UserID: userID,
-		Body:   req.Body,
+		UserID:       userID,
+		Body:         req.Body,
+		Visibility:   req.Visibility,
+		Audience:     audience,
+		FriendListID: req.FriendListID,
 	})
 	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnverifiedUser):
+			return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("can not create post", err.Error(), http.StatusForbidden))
+		case errors.Is(err, ErrInvalidAudience), errors.Is(err, ErrInvalidVisibility), errors.Is(err, ErrCustomAudience):
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not create post", err.Error(), http.StatusBadRequest))
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not create post", err.Error(), http.StatusInternalServerError))
 	}
 
@@ -202,6 +223,8 @@ func (h *HttpHandler) Delete(ctx *fiber.Ctx) error {
 // @Accept  json
 // @Produce  json
 // @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
 // @Success 200 {object} []ReadPostResponse "Success"
 // @Failure 400
 // @Failure 500
@@ -212,23 +235,88 @@ func (h *HttpHandler) List(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
 	}
 
-	posts, err := h.postService.ListPosts()
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get posts", err.Error(), http.StatusBadRequest))
+	}
+
+	posts, nextCursor, err := h.postService.ListPosts(userID, page)
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get posts", err.Error(), http.StatusInternalServerError))
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, posts))
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, posts, nextCursor))
+}
+
+// Feed godoc
+// @Summary Home feed
+// @Description List posts of the logged-in user, their friends and the users they follow. Muted authors and authors blocked
+// @Description in either direction are left out. Recent sort puts the newest posts first, ranked sort weighs likes and
+// @Description comments against the age of the post.
+// @Tags Post
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param sort query string false "Order of the feed" Enums(recent, ranked)
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 100"
+// @Success 200 {object} []ReadFeedPostResponse "Success"
+// @Failure 400
+// @Failure 500
+// @Router /feed [get]
+func (h *HttpHandler) Feed(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	// Ranked feeds are paged by offset, a cursor of the recent feed is refused and the other way around
+	sort := FeedSortEnum(ctx.Query("sort"))
+	pageFromCtx := pagination.FromCtx
+	if sort == FeedSortRanked {
+		pageFromCtx = pagination.OffsetFromCtx
+	}
+
+	page, err := pageFromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get feed", err.Error(), http.StatusBadRequest))
+	}
+
+	feed, nextCursor, err := h.postService.ListFeed(userID, sort, page)
+	if err != nil {
+		if errors.Is(err, ErrInvalidFeedSort) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get feed", err.Error(), http.StatusBadRequest))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get feed", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, feed, nextCursor))
 }
 
 // Get godoc
 // @Summary Get post by id post
-// @Description authenticates given user by giving an access jwttoken.
+// @Description Get the post with its author, like and comment counts, whether the logged-in user liked it and a page of
+// @Description its comments newest first, each with its replies. next_cursor pages the comments.
 // @Tags Post
 // @Accept  json
 // @Produce  json
 // @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param post_id path integer true "ID of the post"
+// @Param cursor query string false "next_cursor of the previous page of comments, empty for the first page"
+// @Param limit query integer false "Number of comments, at most 100"
 // @Success 200 {object} ReadPostResponse "Success"
 // @Failure 400
+// @Failure 404
 // @Failure 500
 // @Router /post/get/{post_id} [get]
 func (h *HttpHandler) Get(ctx *fiber.Ctx) error {
@@ -247,10 +335,20 @@ func (h *HttpHandler) Get(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse post_id", err.Error(), http.StatusBadRequest))
 	}
 
-	post, err := h.postService.GetPostById(uint(postID))
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.FromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get post", err.Error(), http.StatusBadRequest))
+	}
+
+	post, nextCursor, err := h.postService.GetPostById(userID, uint(postID), page)
 	if err != nil {
 		return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not get post", err.Error(), http.StatusNotFound))
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, post))
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, post, nextCursor))
 }
@@ -1,9 +1,15 @@
 package post
 
-import "github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+)
 
 type CreateRequest struct {
-	Body string `json:"body"`
+	Body         string                    `json:"body"`
+	Visibility   entity.PostVisibilityEnum `json:"visibility"`     // public, friends, only_me or custom, public when empty
+	AudienceIDs  []uint                    `json:"audience_ids"`   // Users who can see a post with custom visibility
+	FriendListID *uint                     `json:"friend_list_id"` // Shares the post only with the members of one of the user's friend lists
 }
 
 type UpdateRequest struct {
@@ -13,13 +19,33 @@ type UpdateRequest struct {
 }
 
 type ReadPostResponse struct {
-	Id         uint                      `json:"id"`
-	CreatedAt  string                    `json:"created_at"`
-	User       httpmodel.CommonUser      `json:"user"`
-	Body       string                    `json:"body"`
-	Image      string                    `json:"image"`
-	LikedCount int64                     `json:"liked_count"`
-	Comments   []ReadPostResponseComment `json:"comments,omitempty"`
+	Id           uint                      `json:"id"`
+	CreatedAt    string                    `json:"created_at"`
+	User         httpmodel.CommonUser      `json:"user"`
+	Body         string                    `json:"body"`
+	Image        string                    `json:"image"`
+	Visibility   entity.PostVisibilityEnum `json:"visibility"`
+	LikedCount   int64                     `json:"liked_count"`
+	ViewerLiked  bool                      `json:"viewer_liked"` // Whether the logged-in user liked the post
+	CommentCount int64                     `json:"comment_count"`
+	Comments     []ReadPostResponseComment `json:"comments,omitempty"`
+}
+
+type FeedSortEnum string
+
+const (
+	FeedSortRecent FeedSortEnum = "recent" // Newest first
+	FeedSortRanked FeedSortEnum = "ranked" // Likes and comments weighed against the age of the post
+)
+
+type ReadFeedPostResponse struct {
+	Id           uint                 `json:"id" extensions:"x-order=1" example:"1"`
+	CreatedAt    string               `json:"created_at" extensions:"x-order=2" example:"2024-01-22T11:31:40+03:00"`
+	User         httpmodel.CommonUser `json:"user" extensions:"x-order=3"`
+	Body         string               `json:"body" extensions:"x-order=4" example:"Hello"`
+	Image        string               `json:"image" extensions:"x-order=5" example:"https://res-cdn.com/post"`
+	LikedCount   int64                `json:"liked_count" extensions:"x-order=6" example:"12"`
+	CommentCount int64                `json:"comment_count" extensions:"x-order=7" example:"3"`
 }
 
 type ReadPostResponseComment struct {
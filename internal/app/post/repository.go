@@ -1,7 +1,10 @@
 package post
 
 import (
+	"database/sql"
 	"fmt"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/scopes"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -12,10 +15,24 @@ type IPostRepository interface {
 	Update(post entity.Post) (*entity.Post, error)
 	Get(id uint) (*entity.Post, error)
 	Delete(id uint) error
-	List() ([]entity.Post, error)
+	List(viewerID uint, page pagination.Page) ([]entity.Post, error)
+	ListByIDs(ids []uint) ([]entity.Post, error)
+	ListFeed(viewerID uint, ranked bool, page pagination.Page) ([]FeedPost, error)
+	IsPostVisible(viewerID, postID uint) bool
+	IsFriendListOwner(friendListID, userID uint) bool
+	IsUserEmailVerified(userID uint) bool
+	CountActiveUsers(ids []uint) (int64, error)
+	CountByUserID(viewerID, userID uint) (int64, error)
 	Migration() error
 }
 
+// FeedPost is a post of the feed with its like and comment counts
+type FeedPost struct {
+	entity.Post
+	LikeCount    int64
+	CommentCount int64
+}
+
 type postRepository struct {
 	db     *gorm.DB
 	logger *zap.SugaredLogger
@@ -47,22 +64,118 @@ func (r *postRepository) Delete(id uint) error {
 }
 
 func (r *postRepository) Get(id uint) (post *entity.Post, err error) {
-	if err = r.db.Model(&entity.Post{}).Where("id =?", id).First(&post).Error; err != nil {
+	if err = r.db.Model(&entity.Post{}).Scopes(scopes.ActiveUser("posts.user_id")).Where("id =?", id).First(&post).Error; err != nil {
 		fmt.Println("get get endpoint err", err.Error())
 		return nil, err
 	}
 	return post, nil
 }
 
-func (r *postRepository) List() ([]entity.Post, error) {
+// ListByIDs loads the posts with their authors, callers check that the viewer can see them
+func (r *postRepository) ListByIDs(ids []uint) ([]entity.Post, error) {
+	var posts []entity.Post
+	if err := r.db.Preload("User").Model(&entity.Post{}).Scopes(scopes.ActiveUser("posts.user_id")).Where("id IN ?", ids).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// List lists the posts the viewer can see, posts of private users are shown only to their followers and friends and
+// posts shared with a friend list only to its members. Authors blocked in either direction or muted by the viewer are
+// left out before the page is cut.
+func (r *postRepository) List(viewerID uint, page pagination.Page) ([]entity.Post, error) {
 	var posts []entity.Post
-	if err := r.db.Preload("User").Model(&entity.Post{}).Order("created_at DESC").Find(&posts).Error; err != nil {
+	if err := r.db.Preload("User").Model(&entity.Post{}).Scopes(scopes.ActiveUser("posts.user_id"), scopes.VisibleAuthor(viewerID, "posts.user_id"), scopes.PostAudience(viewerID), scopes.NotBlocked(viewerID, "posts.user_id"), scopes.NotMuted(viewerID, "posts.user_id"), page.Scope("posts")).Find(&posts).Error; err != nil {
 		return nil, err
 	}
 
 	return posts, nil
 }
 
+// ListFeed lists the posts of the viewer, their friends and the users they follow. Authors blocked in either direction
+// or muted by the viewer are left out. Ranked feeds put posts with likes and comments first, giving less weight as they age,
+// and are paged by offset since their order changes over time.
+func (r *postRepository) ListFeed(viewerID uint, ranked bool, page pagination.Page) ([]FeedPost, error) {
+	query := r.db.Scopes(page.Scope("posts"))
+	if ranked {
+		query = r.db.Order("(post_likes.like_count + 2 * post_comments.comment_count + 1) / POWER(EXTRACT(EPOCH FROM (NOW() - posts.created_at)) / 3600 + 2, 1.5) DESC, posts.id DESC").
+			Offset(page.Offset()).Limit(page.Limit + 1)
+	}
+
+	var feed []FeedPost
+	if err := query.Model(&entity.Post{}).
+		Select("posts.*, post_likes.like_count, post_comments.comment_count").
+		Joins("CROSS JOIN LATERAL (SELECT COUNT(*) AS like_count FROM likes WHERE likes.content_type = ? AND likes.content_id = posts.id"+
+			" AND likes.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = likes.user_id AND users.deactivated_at IS NOT NULL)) post_likes",
+			entity.ContentTypePost).
+		Joins("CROSS JOIN LATERAL (SELECT COUNT(*) AS comment_count FROM comments WHERE comments.post_id = posts.id"+
+			" AND comments.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = comments.user_id AND users.deactivated_at IS NOT NULL)) post_comments").
+		Scopes(scopes.ActiveUser("posts.user_id"), scopes.PostAudience(viewerID), scopes.NotBlocked(viewerID, "posts.user_id"), scopes.NotMuted(viewerID, "posts.user_id")).
+		Where("(posts.user_id = @viewer"+
+			" OR EXISTS (SELECT 1 FROM friendships WHERE ((friendships.sender_id = @viewer AND friendships.receiver_id = posts.user_id)"+
+			" OR (friendships.receiver_id = @viewer AND friendships.sender_id = posts.user_id)) AND friendships.status = @accepted AND friendships.deleted_at IS NULL)"+
+			" OR EXISTS (SELECT 1 FROM follows WHERE follows.follower_id = @viewer AND follows.followee_id = posts.user_id AND follows.status = @accepted AND follows.deleted_at IS NULL))",
+			sql.Named("viewer", viewerID), sql.Named("accepted", entity.FriendshipStatusAccepted)).
+		Find(&feed).Error; err != nil {
+		return nil, err
+	}
+
+	// Authors are loaded in one query for the whole page
+	userIDs := make([]uint, 0, len(feed))
+	for _, post := range feed {
+		userIDs = append(userIDs, post.UserID)
+	}
+	var users []entity.User
+	if len(userIDs) > 0 {
+		if err := r.db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			return nil, err
+		}
+	}
+	usersByID := make(map[uint]entity.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+	for i := range feed {
+		feed[i].User = usersByID[feed[i].UserID]
+	}
+
+	return feed, nil
+}
+
+func (r *postRepository) IsPostVisible(viewerID, postID uint) bool {
+	var count int64
+	r.db.Model(&entity.Post{}).Scopes(scopes.VisiblePost(viewerID)).Where("posts.id = ?", postID).Count(&count)
+	return count > 0
+}
+
+func (r *postRepository) IsFriendListOwner(friendListID, userID uint) bool {
+	var count int64
+	r.db.Model(&entity.FriendList{}).Where("id = ? AND user_id = ?", friendListID, userID).Count(&count)
+	return count > 0
+}
+
+func (r *postRepository) IsUserEmailVerified(userID uint) bool {
+	var count int64
+	r.db.Model(&entity.User{}).Where("id = ? AND email_verified_at IS NOT NULL", userID).Count(&count)
+	return count > 0
+}
+
+// CountActiveUsers counts the users among the ids who exist and are not deactivated
+func (r *postRepository) CountActiveUsers(ids []uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.User{}).Where("id IN ? AND deactivated_at IS NULL", ids).Count(&count).Error
+	return count, err
+}
+
+// CountByUserID counts the posts of the user with the scopes of List, so that the count matches the posts the viewer
+// can list. A private account the viewer can not see has none for them.
+func (r *postRepository) CountByUserID(viewerID, userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&entity.Post{}).Scopes(scopes.ActiveUser("posts.user_id"), scopes.VisibleAuthor(viewerID, "posts.user_id"), scopes.PostAudience(viewerID), scopes.NotBlocked(viewerID, "posts.user_id"), scopes.NotMuted(viewerID, "posts.user_id")).
+		Where("posts.user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
 func (r *postRepository) Migration() error {
-	return r.db.AutoMigrate(entity.Post{})
+	return r.db.AutoMigrate(entity.Post{}, entity.PostAudienceMember{})
 }
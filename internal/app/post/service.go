@@ -2,9 +2,12 @@ package post
 
 import (
 	"errors"
+	"fmt"
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
 	"github.com/mehmetokdemir/social-media-api/internal/app/cdn"
 	"github.com/mehmetokdemir/social-media-api/internal/app/comment"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"github.com/mehmetokdemir/social-media-api/internal/app/like"
 	"github.com/mehmetokdemir/social-media-api/internal/app/transaction"
@@ -15,13 +18,26 @@ import (
 	"time"
 )
 
+var (
+	ErrUnverifiedUser    = errors.New("email must be verified before posting")
+	ErrInvalidAudience   = errors.New("friend list of the post must belong to the user")
+	ErrInvalidVisibility = errors.New("visibility must be public, friends, only_me or custom")
+	ErrCustomAudience    = fmt.Errorf("custom visibility needs 1 to %d existing users in audience_ids, other visibilities none", maxCustomAudience)
+	ErrInvalidFeedSort   = errors.New("sort must be recent or ranked")
+)
+
+const maxCustomAudience = 100
+
 type IPostService interface {
 	CreatePost(post entity.Post) (*entity.Post, error)
 	UpdatePost(userID uint, post UpdateRequest) (*entity.Post, error)
-	GetPostById(id uint) (*ReadPostResponse, error)
+	GetPostById(viewerID, id uint, page pagination.Page) (*ReadPostResponse, string, error)
 	DeletePostById(userID uint, id uint) error
-	ListPosts() ([]ReadPostResponse, error)
+	ForceDeletePostById(id uint) error
+	ListPosts(viewerID uint, page pagination.Page) ([]ReadPostResponse, string, error)
+	ListFeed(viewerID uint, sort FeedSortEnum, page pagination.Page) ([]ReadFeedPostResponse, string, error)
 	UpdatePostImage(postID, userID uint, header *multipart.FileHeader) (string, error)
+	CountPosts(viewerID, userID uint) (int64, error)
 }
 
 type postService struct {
@@ -32,9 +48,10 @@ type postService struct {
 	likeService        like.ILikeService
 	transactionService transaction.ITransactionService
 	cdnService         cdn.ICdnService
+	blockService       block.IBlockService
 }
 
-func NewPostService(repository IPostRepository, cdnService cdn.ICdnService, transactionService transaction.ITransactionService, commentService comment.ICommentService, likeService like.ILikeService, logger *zap.SugaredLogger, config config.Config) IPostService {
+func NewPostService(repository IPostRepository, cdnService cdn.ICdnService, transactionService transaction.ITransactionService, commentService comment.ICommentService, likeService like.ILikeService, blockService block.IBlockService, logger *zap.SugaredLogger, config config.Config) IPostService {
 	if repository == nil {
 		return nil
 	}
@@ -47,13 +64,71 @@ func NewPostService(repository IPostRepository, cdnService cdn.ICdnService, tran
 		likeService:        likeService,
 		logger:             logger,
 		cdnService:         cdnService,
+		blockService:       blockService,
 	}
 }
 
 func (s *postService) CreatePost(post entity.Post) (*entity.Post, error) {
+	if !s.repository.IsUserEmailVerified(post.UserID) {
+		return nil, ErrUnverifiedUser
+	}
+
+	if post.FriendListID != nil && !s.repository.IsFriendListOwner(*post.FriendListID, post.UserID) {
+		return nil, ErrInvalidAudience
+	}
+
+	if err := s.checkVisibility(&post); err != nil {
+		return nil, err
+	}
+
 	return s.repository.Create(post)
 }
 
+// checkVisibility defaults the visibility to public and checks the custom audience, the author is dropped from it as
+// they always see their posts
+func (s *postService) checkVisibility(post *entity.Post) error {
+	switch post.Visibility {
+	case "":
+		post.Visibility = entity.PostVisibilityPublic
+	case entity.PostVisibilityPublic, entity.PostVisibilityFriends, entity.PostVisibilityOnlyMe, entity.PostVisibilityCustom:
+	default:
+		return ErrInvalidVisibility
+	}
+
+	if post.Visibility != entity.PostVisibilityCustom {
+		if len(post.Audience) > 0 {
+			return ErrCustomAudience
+		}
+		return nil
+	}
+
+	seen := make(map[uint]bool, len(post.Audience))
+	audience := make([]entity.PostAudienceMember, 0, len(post.Audience))
+	userIDs := make([]uint, 0, len(post.Audience))
+	for _, member := range post.Audience {
+		if member.UserID == post.UserID || seen[member.UserID] {
+			continue
+		}
+		seen[member.UserID] = true
+		audience = append(audience, entity.PostAudienceMember{UserID: member.UserID})
+		userIDs = append(userIDs, member.UserID)
+	}
+	if len(userIDs) == 0 || len(userIDs) > maxCustomAudience {
+		return ErrCustomAudience
+	}
+
+	count, err := s.repository.CountActiveUsers(userIDs)
+	if err != nil {
+		return err
+	}
+	if count != int64(len(userIDs)) {
+		return ErrCustomAudience
+	}
+
+	post.Audience = audience
+	return nil
+}
+
 func (s *postService) UpdatePostImage(postID, userID uint, file *multipart.FileHeader) (string, error) {
 	postById, err := s.repository.Get(postID)
 	if err != nil {
@@ -101,18 +176,57 @@ func (s *postService) UpdatePost(userID uint, post UpdateRequest) (*entity.Post,
 	})
 }
 
-func (s *postService) GetPostById(id uint) (*ReadPostResponse, error) {
+// GetPostById returns the post with a page of its comments, each with its replies. The cursor is of the comments.
+func (s *postService) GetPostById(viewerID, id uint, page pagination.Page) (*ReadPostResponse, string, error) {
 	post, err := s.repository.Get(id)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	// Posts of blocked or private users and posts shared with a friend list look missing to everyone outside their
+	// audience, so that they can not tell the post exists
+	if !s.repository.IsPostVisible(viewerID, post.ID) {
+		return nil, "", gorm.ErrRecordNotFound
+	}
+
+	posts, err := s.repository.ListByIDs([]uint{post.ID})
+	if err != nil {
+		return nil, "", err
 	}
 
-	return &ReadPostResponse{
-		Id:        post.ID,
-		CreatedAt: post.CreatedAt.Format(time.RFC3339),
-		Body:      post.Body,
-		Image:     post.Image,
-	}, nil
+	hidden, err := s.hiddenFromFeed(viewerID)
+	if err != nil {
+		return nil, "", err
+	}
+	// Muting keeps the author out of feeds, a post opened directly is still shown
+	delete(hidden, post.UserID)
+
+	var nextCursor string
+	rsp, err := s.assemblePosts(viewerID, posts, hidden, func(postIDs []uint) ([]entity.Comment, error) {
+		comments, err := s.commentService.PaginateMainCommentsByPostID(viewerID, post.ID, page)
+		if err != nil {
+			return nil, err
+		}
+		comments, nextCursor = pagination.Next(comments, page, func(com entity.Comment) (time.Time, uint) { return com.CreatedAt, com.ID })
+
+		parentIDs := make([]uint, 0, len(comments))
+		for _, com := range comments {
+			parentIDs = append(parentIDs, com.ID)
+		}
+
+		replies, err := s.commentService.ListCommentsByParentIDs(parentIDs)
+		if err != nil {
+			return nil, err
+		}
+		return append(comments, replies...), nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(rsp) == 0 {
+		return nil, "", gorm.ErrRecordNotFound
+	}
+	return &rsp[0], nextCursor, nil
 }
 
 func (s *postService) DeletePostById(userID uint, id uint) error {
@@ -126,6 +240,20 @@ func (s *postService) DeletePostById(userID uint, id uint) error {
 		return errors.New("do not have permission to update this post")
 	}
 
+	return s.deletePost(postByID)
+}
+
+// ForceDeletePostById deletes the post without ownership check, callers must authorize the request
+func (s *postService) ForceDeletePostById(id uint) error {
+	postByID, err := s.repository.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return s.deletePost(postByID)
+}
+
+func (s *postService) deletePost(postByID *entity.Post) error {
 	comments, err := s.commentService.ListCommentsByPostID(postByID.ID)
 	if err != nil {
 		return err
@@ -156,58 +284,180 @@ func (s *postService) DeletePostById(userID uint, id uint) error {
 	return nil
 }
 
-func (s *postService) ListPosts() ([]ReadPostResponse, error) {
-	posts, err := s.repository.List()
+func (s *postService) ListPosts(viewerID uint, page pagination.Page) ([]ReadPostResponse, string, error) {
+	hidden, err := s.hiddenFromFeed(viewerID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	posts, err := s.repository.List(viewerID, page)
+	if err != nil {
+		return nil, "", err
+	}
+	posts, nextCursor := pagination.Next(posts, page, func(post entity.Post) (time.Time, uint) { return post.CreatedAt, post.ID })
+
+	rsp, err := s.assemblePosts(viewerID, posts, hidden, s.commentService.ListCommentsByPostIDs)
+	if err != nil {
+		return nil, "", err
+	}
+	return rsp, nextCursor, nil
+}
+
+// ListFeed lists the posts of the viewer, their friends and the users they follow, see FeedSortEnum for the orders
+func (s *postService) ListFeed(viewerID uint, sort FeedSortEnum, page pagination.Page) ([]ReadFeedPostResponse, string, error) {
+	if sort == "" {
+		sort = FeedSortRecent
+	}
+	if sort != FeedSortRecent && sort != FeedSortRanked {
+		return nil, "", ErrInvalidFeedSort
+	}
+
+	feed, err := s.repository.ListFeed(viewerID, sort == FeedSortRanked, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if sort == FeedSortRanked {
+		feed, nextCursor = pagination.NextOffset(feed, page)
+	} else {
+		feed, nextCursor = pagination.Next(feed, page, func(post FeedPost) (time.Time, uint) { return post.CreatedAt, post.ID })
+	}
+
+	rsp := make([]ReadFeedPostResponse, 0, len(feed))
+	for _, post := range feed {
+		rsp = append(rsp, ReadFeedPostResponse{
+			Id:           post.ID,
+			CreatedAt:    post.CreatedAt.Format(time.RFC3339),
+			User:         httpmodel.CommonUser{Id: post.UserID, Username: post.User.Username, FirstName: post.User.FirstName, LastName: post.User.LastName, ProfilePhoto: post.User.ProfilePhoto},
+			Body:         post.Body,
+			Image:        post.Image,
+			LikedCount:   post.LikeCount,
+			CommentCount: post.CommentCount,
+		})
+	}
+	return rsp, nextCursor, nil
+}
+
+func (s *postService) CountPosts(viewerID, userID uint) (int64, error) {
+	return s.repository.CountByUserID(viewerID, userID)
+}
+
+// assemblePosts builds the responses of the posts with their comments, replies, like and comment counts. Everything is
+// loaded in batches for the whole page, so the number of queries does not grow with the number of posts or comments.
+// loadComments returns the comments and replies to show for the posts, replies whose parent is not among them are
+// left out.
+func (s *postService) assemblePosts(viewerID uint, posts []entity.Post, hidden map[uint]bool, loadComments func(postIDs []uint) ([]entity.Comment, error)) ([]ReadPostResponse, error) {
+	postIDs := make([]uint, 0, len(posts))
+	for _, post := range posts {
+		if !hidden[post.UserID] {
+			postIDs = append(postIDs, post.ID)
+		}
+	}
+
+	if len(postIDs) == 0 {
+		return nil, nil
+	}
+
+	comments, err := loadComments(postIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	commentIDs := make([]uint, 0, len(comments))
+	for _, com := range comments {
+		commentIDs = append(commentIDs, com.ID)
+	}
+
+	postLikes, err := s.likeService.CountPostLikes(postIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	commentLikes, err := s.likeService.CountCommentLikes(commentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	viewerLikes, err := s.likeService.PostsLikedByUser(viewerID, postIDs)
 	if err != nil {
 		return nil, err
 	}
 
+	commentCounts, err := s.commentService.CountCommentsByPostIDs(viewerID, postIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Comments come newest first, grouping them keeps that order within each post and each parent
+	mainComments := make(map[uint][]entity.Comment)
+	subComments := make(map[uint][]entity.Comment)
+	for _, com := range comments {
+		if hidden[com.UserID] {
+			continue
+		}
+		if com.ParenId == nil {
+			mainComments[com.PostID] = append(mainComments[com.PostID], com)
+		} else {
+			subComments[*com.ParenId] = append(subComments[*com.ParenId], com)
+		}
+	}
+
 	var rsp []ReadPostResponse
 	for _, post := range posts {
-		var rspComments []ReadPostResponseComment
-		// Get main comments without belongs to other comments
-		comments, err := s.commentService.ListMainCommentsByPostID(post.ID)
-		if err != nil {
-			return nil, err
+		if hidden[post.UserID] {
+			continue
 		}
 
-		for _, com := range comments {
+		var rspComments []ReadPostResponseComment
+		for _, com := range mainComments[post.ID] {
 			var rspSubComments []ReadPostResponseComment
-			subComments, err := s.commentService.ListCommentsByParentID(com.ID)
-			if err != nil {
-				return nil, err
+			for _, subComment := range subComments[com.ID] {
+				rspSubComments = append(rspSubComments, toResponseComment(subComment, commentLikes, nil))
 			}
-
-			for _, subComment := range subComments {
-				rspSubComments = append(rspSubComments, ReadPostResponseComment{
-					Id:         subComment.ID,
-					Body:       subComment.Body,
-					Image:      subComment.Image,
-					User:       httpmodel.CommonUser{Id: subComment.UserID, Username: subComment.User.Username, FirstName: subComment.User.FirstName, LastName: subComment.User.LastName, ProfilePhoto: subComment.User.ProfilePhoto},
-					LikedCount: s.likeService.GetCommentCountLikeByID(subComment.ID),
-				})
-			}
-
-			rspComments = append(rspComments, ReadPostResponseComment{
-				Id:          com.ID,
-				Body:        com.Body,
-				Image:       com.Image,
-				User:        httpmodel.CommonUser{Id: com.UserID, Username: com.User.Username, FirstName: com.User.FirstName, LastName: com.User.LastName, ProfilePhoto: com.User.ProfilePhoto},
-				LikedCount:  s.likeService.GetCommentCountLikeByID(com.ID),
-				SubComments: rspSubComments,
-			})
+			rspComments = append(rspComments, toResponseComment(com, commentLikes, rspSubComments))
 		}
 
 		rsp = append(rsp, ReadPostResponse{
-			Id:         post.ID,
-			CreatedAt:  post.CreatedAt.Format(time.RFC3339),
-			User:       httpmodel.CommonUser{Id: post.UserID, Username: post.User.Username, FirstName: post.User.FirstName, LastName: post.User.LastName, ProfilePhoto: post.User.ProfilePhoto},
-			Body:       post.Body,
-			Image:      post.Image,
-			LikedCount: s.likeService.GetPostCountLikeByID(post.ID),
-			Comments:   rspComments,
+			Id:           post.ID,
+			CreatedAt:    post.CreatedAt.Format(time.RFC3339),
+			User:         httpmodel.CommonUser{Id: post.UserID, Username: post.User.Username, FirstName: post.User.FirstName, LastName: post.User.LastName, ProfilePhoto: post.User.ProfilePhoto},
+			Body:         post.Body,
+			Image:        post.Image,
+			Visibility:   post.Visibility,
+			LikedCount:   postLikes[post.ID],
+			ViewerLiked:  viewerLikes[post.ID],
+			CommentCount: commentCounts[post.ID],
+			Comments:     rspComments,
 		})
 	}
-
 	return rsp, nil
 }
+
+func toResponseComment(com entity.Comment, likes map[uint]int64, subComments []ReadPostResponseComment) ReadPostResponseComment {
+	return ReadPostResponseComment{
+		Id:          com.ID,
+		Body:        com.Body,
+		Image:       com.Image,
+		User:        httpmodel.CommonUser{Id: com.UserID, Username: com.User.Username, FirstName: com.User.FirstName, LastName: com.User.LastName, ProfilePhoto: com.User.ProfilePhoto},
+		LikedCount:  likes[com.ID],
+		SubComments: subComments,
+	}
+}
+
+// hiddenFromFeed is the set of users whose posts and comments the viewer does not see, blocked in either direction or muted
+func (s *postService) hiddenFromFeed(viewerID uint) (map[uint]bool, error) {
+	hidden, err := s.blockService.HiddenUserIDs(viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	muted, err := s.blockService.MutedUserIDs(viewerID)
+	if err != nil {
+		return nil, err
+	}
+	for userID := range muted {
+		hidden[userID] = true
+	}
+	return hidden, nil
+}
@@ -0,0 +1,188 @@
+package post
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mehmetokdemir/social-media-api/internal/app/comment"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/like"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newCountingDB opens gorm on sqlmock and counts every statement gorm runs
+func newCountingDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock, *int) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := new(int)
+	counter := func(*gorm.DB) { *count++ }
+	if err = db.Callback().Query().After("gorm:query").Register("test:count_query", counter); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Callback().Row().After("gorm:row").Register("test:count_row", counter); err != nil {
+		t.Fatal(err)
+	}
+	return db, mock, count
+}
+
+// expectAssembly scripts the queries assemblePosts is allowed to run, each post gets a comment and a reply, all by user 9
+func expectAssembly(mock sqlmock.Sqlmock, postIDs []uint) {
+	now := time.Now()
+	comments := sqlmock.NewRows([]string{"id", "created_at", "user_id", "post_id", "body", "parent_id"})
+	postLikes := sqlmock.NewRows([]string{"content_id", "count"})
+	commentLikes := sqlmock.NewRows([]string{"content_id", "count"})
+	commentCounts := sqlmock.NewRows([]string{"post_id", "count"})
+	for _, postID := range postIDs {
+		mainID, replyID := postID*10, postID*10+1
+		comments.AddRow(replyID, now, 9, postID, "reply", mainID)
+		comments.AddRow(mainID, now.Add(-time.Minute), 9, postID, "comment", nil)
+		postLikes.AddRow(postID, 3)
+		commentLikes.AddRow(mainID, 2)
+		commentCounts.AddRow(postID, 2)
+	}
+
+	mock.ExpectQuery(`FROM "comments" WHERE post_id IN`).WillReturnRows(comments)
+	mock.ExpectQuery(`FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(9, "commenter"))
+	mock.ExpectQuery(`SELECT likes.content_id, COUNT\(\*\)`).WillReturnRows(postLikes)
+	mock.ExpectQuery(`SELECT likes.content_id, COUNT\(\*\)`).WillReturnRows(commentLikes)
+	mock.ExpectQuery(`SELECT "content_id" FROM "likes"`).WillReturnRows(sqlmock.NewRows([]string{"content_id"}).AddRow(driver.Value(postIDs[0])))
+	mock.ExpectQuery(`SELECT comments.post_id, COUNT\(\*\) .* FROM blocks .* FROM mutes`).WillReturnRows(commentCounts)
+}
+
+func assemble(t *testing.T, postCount int) ([]ReadPostResponse, int) {
+	t.Helper()
+
+	db, mock, count := newCountingDB(t)
+	log := zap.NewNop().Sugar()
+	likeService := like.NewLikeService(like.NewRepository(db, log), log, config.Config{})
+	commentService := comment.NewCommentService(comment.NewRepository(db, log), likeService, nil, nil, log, config.Config{})
+	s := &postService{repository: NewRepository(db, log), commentService: commentService, likeService: likeService, logger: log}
+
+	posts := make([]entity.Post, 0, postCount)
+	postIDs := make([]uint, 0, postCount)
+	for i := 1; i <= postCount; i++ {
+		posts = append(posts, entity.Post{Model: gorm.Model{ID: uint(i)}, UserID: 1})
+		postIDs = append(postIDs, uint(i))
+	}
+	expectAssembly(mock, postIDs)
+
+	rsp, err := s.assemblePosts(1, posts, map[uint]bool{}, commentService.ListCommentsByPostIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	return rsp, *count
+}
+
+func TestAssemblePostsRunsFixedNumberOfQueries(t *testing.T) {
+	_, single := assemble(t, 1)
+	rsp, many := assemble(t, 50)
+
+	if single != many {
+		t.Fatalf("queries grow with the page: %d for 1 post, %d for 50 posts", single, many)
+	}
+	if len(rsp) != 50 {
+		t.Fatalf("expected 50 posts, got %d", len(rsp))
+	}
+
+	first := rsp[0]
+	if first.LikedCount != 3 || !first.ViewerLiked || first.CommentCount != 2 {
+		t.Fatalf("counts are not assembled: %+v", first)
+	}
+	if len(first.Comments) != 1 || first.Comments[0].LikedCount != 2 || len(first.Comments[0].SubComments) != 1 {
+		t.Fatalf("comment tree is not assembled: %+v", first.Comments)
+	}
+	if rsp[1].ViewerLiked {
+		t.Fatal("only the first post is liked by the viewer")
+	}
+}
+
+// audienceRepository treats the users in active as existing and not deactivated
+type audienceRepository struct {
+	IPostRepository
+	active map[uint]bool
+}
+
+func (r *audienceRepository) CountActiveUsers(ids []uint) (int64, error) {
+	var count int64
+	for _, id := range ids {
+		if r.active[id] {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func TestCheckVisibility(t *testing.T) {
+	s := &postService{repository: &audienceRepository{active: map[uint]bool{2: true, 3: true}}}
+	audience := func(ids ...uint) []entity.PostAudienceMember {
+		members := make([]entity.PostAudienceMember, 0, len(ids))
+		for _, id := range ids {
+			members = append(members, entity.PostAudienceMember{UserID: id})
+		}
+		return members
+	}
+
+	for name, tc := range map[string]struct {
+		post     entity.Post
+		err      error
+		expected entity.PostVisibilityEnum
+		members  int
+	}{
+		"defaults to public":              {post: entity.Post{UserID: 1}, expected: entity.PostVisibilityPublic},
+		"unknown visibility":              {post: entity.Post{UserID: 1, Visibility: "everyone"}, err: ErrInvalidVisibility},
+		"audience without custom":         {post: entity.Post{UserID: 1, Visibility: entity.PostVisibilityFriends, Audience: audience(2)}, err: ErrCustomAudience},
+		"custom without audience":         {post: entity.Post{UserID: 1, Visibility: entity.PostVisibilityCustom}, err: ErrCustomAudience},
+		"custom with only the author":     {post: entity.Post{UserID: 1, Visibility: entity.PostVisibilityCustom, Audience: audience(1)}, err: ErrCustomAudience},
+		"custom with unknown user":        {post: entity.Post{UserID: 1, Visibility: entity.PostVisibilityCustom, Audience: audience(2, 4)}, err: ErrCustomAudience},
+		"custom drops author and repeats": {post: entity.Post{UserID: 1, Visibility: entity.PostVisibilityCustom, Audience: audience(1, 2, 3, 2)}, expected: entity.PostVisibilityCustom, members: 2},
+	} {
+		post := tc.post
+		err := s.checkVisibility(&post)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%s: expected %v, got %v", name, tc.err, err)
+		}
+		if err == nil && (post.Visibility != tc.expected || len(post.Audience) != tc.members) {
+			t.Fatalf("%s: got visibility %s with %d members", name, post.Visibility, len(post.Audience))
+		}
+	}
+}
+
+func TestPostDetailOfBlockedPairLooksMissing(t *testing.T) {
+	db, mock, _ := newCountingDB(t)
+	s := &postService{repository: NewRepository(db, zap.NewNop().Sugar()), logger: zap.NewNop().Sugar()}
+
+	mock.ExpectQuery(`SELECT \* FROM "posts"`).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(9, 2))
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "posts" WHERE posts.id = \$1 AND .*` +
+		`NOT EXISTS \(SELECT 1 FROM blocks WHERE \(blocks.blocker_id = \$\d+ AND blocks.blocked_id = posts.user_id\)` +
+		` OR \(blocks.blocker_id = posts.user_id AND blocks.blocked_id = \$\d+\)\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	if _, _, err := s.GetPostById(1, 9, pagination.Page{Limit: pagination.DefaultLimit}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("post of a blocked pair is shown: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,32 @@
+package signingkey
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type HttpHandler struct {
+	signingKeyService ISigningKeyService
+	logger            *zap.SugaredLogger
+}
+
+func NewHttpHandler(signingKeyService ISigningKeyService, logger *zap.SugaredLogger) *HttpHandler {
+	return &HttpHandler{signingKeyService: signingKeyService, logger: logger}
+}
+
+func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/.well-known/jwks.json", h.JWKS)
+}
+
+// JWKS godoc
+// @Summary Public signing keys
+// @Description Public keys to verify access tokens, in JWK Set format. Tokens carry the key id in kid header.
+// @Tags Auth
+// @Produce  json
+// @Success 200 {object} JWKSResponse
+// @Router /.well-known/jwks.json [get]
+func (h *HttpHandler) JWKS(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(JWKSMaxAge.Seconds())))
+	return ctx.Status(fiber.StatusOK).JSON(h.signingKeyService.JWKS())
+}
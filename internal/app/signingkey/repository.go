@@ -0,0 +1,66 @@
+package signingkey
+
+import (
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type ISigningKeyRepository interface {
+	Create(signingKey entity.SigningKey) (*entity.SigningKey, error)
+	ListVerifiable() ([]entity.SigningKey, error)
+	RetireKeysBefore(id uint, expiresAt time.Time) error
+	DeleteExpired() error
+	Migration() error
+}
+
+type signingKeyRepository struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+}
+
+func NewRepository(db *gorm.DB, logger *zap.SugaredLogger) ISigningKeyRepository {
+	return &signingKeyRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *signingKeyRepository) Create(signingKey entity.SigningKey) (*entity.SigningKey, error) {
+	if err := r.db.Create(&signingKey).Error; err != nil {
+		return nil, err
+	}
+	return &signingKey, nil
+}
+
+// ListVerifiable returns keys whose tokens may still be alive, newest first
+func (r *signingKeyRepository) ListVerifiable() ([]entity.SigningKey, error) {
+	var signingKeys []entity.SigningKey
+	if err := r.db.Model(&entity.SigningKey{}).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&signingKeys).Error; err != nil {
+		return nil, err
+	}
+	return signingKeys, nil
+}
+
+// RetireKeysBefore stops signing with every active key created before the given one, they are kept for verification
+// until expiresAt. Keys created after it are still waiting to be published long enough and are left alone.
+func (r *signingKeyRepository) RetireKeysBefore(id uint, expiresAt time.Time) error {
+	return r.db.Model(&entity.SigningKey{}).
+		Where("id < ? AND retired_at IS NULL", id).
+		Updates(map[string]interface{}{
+			"retired_at": time.Now(),
+			"expires_at": expiresAt,
+		}).Error
+}
+
+func (r *signingKeyRepository) DeleteExpired() error {
+	return r.db.Where("expires_at IS NOT NULL AND expires_at < ?", time.Now()).Delete(&entity.SigningKey{}).Error
+}
+
+func (r *signingKeyRepository) Migration() error {
+	return r.db.AutoMigrate(entity.SigningKey{})
+}
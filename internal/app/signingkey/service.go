@@ -0,0 +1,352 @@
+package signingkey
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	algorithmRS256 = "RS256"
+	rsaKeySize     = 2048
+
+	// rotationCheckInterval is how often keys are reloaded from database and rotated if needed,
+	// other instances of the service pick up a rotated key in this period
+	rotationCheckInterval = 10 * time.Minute
+
+	// minVerificationWindow keeps a retired key for short-lived tokens even if access tokens expire sooner
+	minVerificationWindow = 10 * time.Minute
+
+	// JWKSMaxAge is how long clients may cache the JWKS response. A new key is published for this long before it signs,
+	// so that a client holding a cached key set never sees a token signed with a key it does not know.
+	JWKSMaxAge = 5 * time.Minute
+
+	// unknownKidReloadInterval limits the reloads caused by tokens with a kid that is not known, tokens with made-up
+	// kids can not turn every request into a database query
+	unknownKidReloadInterval = 30 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type ISigningKeyService interface {
+	Sign(claims jwt.Claims) (string, error)
+	Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error)
+	JWKS() JWKSResponse
+	Rotate() error
+	StartRotation()
+}
+
+type signingKey struct {
+	id         uint
+	kid        string
+	privateKey *rsa.PrivateKey
+	publicKey  *rsa.PublicKey
+	retired    bool
+	createdAt  time.Time
+}
+
+type signingKeyService struct {
+	config     config.Config
+	logger     *zap.SugaredLogger
+	repository ISigningKeyRepository
+
+	mu         sync.RWMutex
+	signing    []*signingKey // Keys which are not retired, newest first
+	keys       map[string]*signingKey
+	lastReload time.Time
+}
+
+func NewSigningKeyService(repository ISigningKeyRepository, logger *zap.SugaredLogger, config config.Config) (ISigningKeyService, error) {
+	if repository == nil {
+		return nil, errors.New("signing key repository is required")
+	}
+
+	s := &signingKeyService{
+		config:     config,
+		logger:     logger,
+		repository: repository,
+		keys:       map[string]*signingKey{},
+	}
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	// First start of the service
+	if s.activeKey() == nil {
+		if err := s.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *signingKeyService) Sign(claims jwt.Claims) (string, error) {
+	key := s.activeKey()
+	if key == nil {
+		return "", errors.New("there is no active signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.privateKey)
+}
+
+func (s *signingKeyService) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Only asymmetric tokens are accepted, a token signed with the public key as HMAC secret must not pass
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key := s.key(kid)
+		if key == nil {
+			// The key may be created by another instance after the last reload
+			if err := s.reloadForUnknownKid(); err != nil {
+				return nil, err
+			}
+			if key = s.key(kid); key == nil {
+				return nil, ErrUnknownKey
+			}
+		}
+		return key.publicKey, nil
+	})
+}
+
+func (s *signingKeyService) JWKS() JWKSResponse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rsp := JWKSResponse{Keys: []JWK{}}
+	for _, key := range s.keys {
+		rsp.Keys = append(rsp.Keys, s.toJWK(key))
+	}
+	return rsp
+}
+
+// Rotate creates a new signing key. The key is published in JWKS right away but signs only after JWKSMaxAge, the
+// previous key keeps signing until then and is retired by StartRotation afterwards.
+func (s *signingKeyService) Rotate() error {
+	privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return err
+	}
+
+	privateKeyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	publicKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})
+
+	if _, err = s.repository.Create(entity.SigningKey{
+		Kid:        s.thumbprint(&privateKey.PublicKey),
+		Algorithm:  algorithmRS256,
+		PrivateKey: string(privateKeyPem),
+		PublicKey:  string(publicKeyPem),
+	}); err != nil {
+		return err
+	}
+
+	return s.reload()
+}
+
+// StartRotation reloads keys periodically, retires the keys replaced by a published key and rotates the newest key
+// when it is older than the rotation period
+func (s *signingKeyService) StartRotation() {
+	go func() {
+		ticker := time.NewTicker(rotationCheckInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.rotate()
+		}
+	}()
+}
+
+func (s *signingKeyService) rotate() {
+	if err := s.repository.DeleteExpired(); err != nil {
+		s.logger.Errorf("can not delete expired signing keys: %v", err)
+	}
+
+	if err := s.reload(); err != nil {
+		s.logger.Errorf("can not reload signing keys: %v", err)
+		return
+	}
+
+	if err := s.retireReplacedKeys(); err != nil {
+		s.logger.Errorf("can not retire signing keys: %v", err)
+	}
+
+	newest := s.newestKey()
+	if newest == nil || time.Since(newest.createdAt) > s.rotationPeriod() {
+		if err := s.Rotate(); err != nil {
+			s.logger.Errorf("can not rotate signing key: %v", err)
+		}
+	}
+}
+
+// retireReplacedKeys retires the keys created before the active key. Other instances may sign with them until their next
+// reload, so they are kept for verification one check interval longer than the tokens live.
+func (s *signingKeyService) retireReplacedKeys() error {
+	s.mu.RLock()
+	signing := s.signing
+	s.mu.RUnlock()
+
+	active := s.activeKey()
+	if active == nil || signing[len(signing)-1] == active {
+		return nil
+	}
+
+	if err := s.repository.RetireKeysBefore(active.id, time.Now().Add(rotationCheckInterval+s.verificationWindow())); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+// reloadForUnknownKid reloads the keys at most once in unknownKidReloadInterval
+func (s *signingKeyService) reloadForUnknownKid() error {
+	s.mu.RLock()
+	recent := time.Since(s.lastReload) < unknownKidReloadInterval
+	s.mu.RUnlock()
+	if recent {
+		return ErrUnknownKey
+	}
+	return s.reload()
+}
+
+func (s *signingKeyService) reload() error {
+	signingKeys, err := s.repository.ListVerifiable()
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]*signingKey{}
+	var signing []*signingKey
+	for _, storedKey := range signingKeys {
+		key, err := s.parseKey(storedKey)
+		if err != nil {
+			return err
+		}
+		keys[key.kid] = key
+
+		// Keys are ordered newest first
+		if !key.retired {
+			signing = append(signing, key)
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.signing = signing
+	s.lastReload = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *signingKeyService) parseKey(storedKey entity.SigningKey) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(storedKey.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("can not decode signing key %s", storedKey.Kid)
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingKey{
+		id:         storedKey.ID,
+		kid:        storedKey.Kid,
+		privateKey: privateKey,
+		publicKey:  &privateKey.PublicKey,
+		retired:    storedKey.RetiredAt != nil,
+		createdAt:  storedKey.CreatedAt,
+	}, nil
+}
+
+// activeKey is the newest key published for at least JWKSMaxAge. Until a key is published that long the oldest key
+// which is not retired signs, which is also the only key on the first start.
+func (s *signingKeyService) activeKey() *signingKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.signing {
+		if time.Since(key.createdAt) >= JWKSMaxAge {
+			return key
+		}
+	}
+	if len(s.signing) == 0 {
+		return nil
+	}
+	return s.signing[len(s.signing)-1]
+}
+
+func (s *signingKeyService) newestKey() *signingKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.signing) == 0 {
+		return nil
+	}
+	return s.signing[0]
+}
+
+func (s *signingKeyService) key(kid string) *signingKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[kid]
+}
+
+func (s *signingKeyService) rotationPeriod() time.Duration {
+	return time.Duration(s.config.JwtKeyRotationHours) * time.Hour
+}
+
+func (s *signingKeyService) verificationWindow() time.Duration {
+	window := time.Duration(s.config.JwtATExpirationMinutes) * time.Minute
+	if window < minVerificationWindow {
+		window = minVerificationWindow
+	}
+	return window
+}
+
+func (s *signingKeyService) toJWK(key *signingKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: algorithmRS256,
+		Kid: key.kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.publicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.publicKey.E)).Bytes()),
+	}
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the key to be used as kid
+func (s *signingKeyService) thumbprint(publicKey *rsa.PublicKey) string {
+	canonical, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+	})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,200 @@
+package signingkey
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+)
+
+// keyRepository keeps the signing keys in memory and counts how often they are listed
+type keyRepository struct {
+	ISigningKeyRepository
+	keys  []entity.SigningKey
+	lists int
+}
+
+func (r *keyRepository) Create(signingKey entity.SigningKey) (*entity.SigningKey, error) {
+	signingKey.ID = uint(len(r.keys) + 1)
+	signingKey.CreatedAt = time.Now()
+	r.keys = append(r.keys, signingKey)
+	return &signingKey, nil
+}
+
+func (r *keyRepository) ListVerifiable() ([]entity.SigningKey, error) {
+	r.lists++
+	var keys []entity.SigningKey
+	for _, key := range r.keys {
+		if key.ExpiresAt == nil || key.ExpiresAt.After(time.Now()) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (r *keyRepository) RetireKeysBefore(id uint, expiresAt time.Time) error {
+	now := time.Now()
+	for i := range r.keys {
+		if r.keys[i].ID < id && r.keys[i].RetiredAt == nil {
+			r.keys[i].RetiredAt, r.keys[i].ExpiresAt = &now, &expiresAt
+		}
+	}
+	return nil
+}
+
+// age moves the creation time of the key back as if it was created d ago
+func (r *keyRepository) age(kid string, d time.Duration) {
+	for i := range r.keys {
+		if r.keys[i].Kid == kid {
+			r.keys[i].CreatedAt = r.keys[i].CreatedAt.Add(-d)
+		}
+	}
+}
+
+func (r *keyRepository) retired(kid string) bool {
+	for _, key := range r.keys {
+		if key.Kid == kid {
+			return key.RetiredAt != nil
+		}
+	}
+	return false
+}
+
+func newService(t *testing.T, repository *keyRepository) *signingKeyService {
+	t.Helper()
+
+	s, err := NewSigningKeyService(repository, zap.NewNop().Sugar(), config.Config{JwtATExpirationMinutes: 15, JwtKeyRotationHours: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*signingKeyService)
+}
+
+func signedKid(t *testing.T, s *signingKeyService) string {
+	t.Helper()
+
+	token, err := s.Sign(jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.StandardClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Header["kid"].(string)
+}
+
+func TestRotatedKeySignsOnlyAfterItIsPublished(t *testing.T) {
+	repository := &keyRepository{}
+	s := newService(t, repository)
+	first := signedKid(t, s)
+
+	if err := s.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	second := s.newestKey().kid
+	if len(s.JWKS().Keys) != 2 {
+		t.Fatalf("rotated key is not published, %d keys", len(s.JWKS().Keys))
+	}
+	if kid := signedKid(t, s); kid != first {
+		t.Fatal("rotated key signs before clients could cache it")
+	}
+
+	repository.age(second, JWKSMaxAge)
+	if err := s.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if kid := signedKid(t, s); kid != second {
+		t.Fatal("published key does not sign")
+	}
+}
+
+func TestRetireReplacedKeysLeavesPendingKeys(t *testing.T) {
+	repository := &keyRepository{}
+	s := newService(t, repository)
+	first := s.newestKey().kid
+
+	if err := s.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	second := s.newestKey().kid
+	repository.age(first, 2*JWKSMaxAge)
+	repository.age(second, JWKSMaxAge)
+
+	if err := s.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	third := s.newestKey().kid
+
+	if err := s.retireReplacedKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if !repository.retired(first) {
+		t.Fatal("replaced key is not retired")
+	}
+	if repository.retired(second) || repository.retired(third) {
+		t.Fatal("active or pending key is retired")
+	}
+	if s.key(first) == nil {
+		t.Fatal("retired key can not verify the tokens it signed")
+	}
+	if kid := signedKid(t, s); kid != second {
+		t.Fatal("active key does not sign after the retirement")
+	}
+}
+
+func TestParseThrottlesReloadsForUnknownKids(t *testing.T) {
+	repository := &keyRepository{}
+	s := newService(t, repository)
+	other := newService(t, repository)
+
+	// Another instance rotates, the key signs there right away as it was published long enough
+	if err := other.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	repository.age(other.newestKey().kid, JWKSMaxAge)
+	if err := other.reload(); err != nil {
+		t.Fatal(err)
+	}
+	token, err := other.Sign(jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lists := repository.lists
+	var validationErr *jwt.ValidationError
+	if _, err = s.Parse(token, &jwt.StandardClaims{}); !errors.As(err, &validationErr) || validationErr.Inner != ErrUnknownKey {
+		t.Fatalf("expected unknown key, got %v", err)
+	}
+	if repository.lists != lists {
+		t.Fatal("keys are reloaded right after the last reload")
+	}
+
+	s.lastReload = time.Now().Add(-unknownKidReloadInterval)
+	if _, err = s.Parse(token, &jwt.StandardClaims{}); err != nil {
+		t.Fatalf("key of the other instance is not picked up: %v", err)
+	}
+	if repository.lists != lists+1 {
+		t.Fatalf("expected one reload, got %d", repository.lists-lists)
+	}
+}
+
+func TestParseRejectsExpiredToken(t *testing.T) {
+	s := newService(t, &keyRepository{})
+
+	token, err := s.Sign(jwt.StandardClaims{ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var validationErr *jwt.ValidationError
+	if _, err = s.Parse(token, &jwt.StandardClaims{}); !errors.As(err, &validationErr) || validationErr.Errors&jwt.ValidationErrorExpired == 0 {
+		t.Fatalf("expected expired token, got %v", err)
+	}
+}
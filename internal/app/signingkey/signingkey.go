@@ -0,0 +1,15 @@
+package signingkey
+
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK RSA public key as described in RFC 7517
+type JWK struct {
+	Kty string `json:"kty" example:"RSA"`
+	Use string `json:"use" example:"sig"`
+	Alg string `json:"alg" example:"RS256"`
+	Kid string `json:"kid" example:"NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"`
+	N   string `json:"n"`
+	E   string `json:"e" example:"AQAB"`
+}
@@ -1,34 +1,48 @@
 package user
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpresponse"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
 	"github.com/mehmetokdemir/social-media-api/internal/middleware"
 	"go.uber.org/zap"
 	"net/http"
 )
 
 type HttpHandler struct {
-	userService   IUserService
-	logger        *zap.SugaredLogger
-	jwtPrivateKey string
-	guardService  guard.IGuardService
+	userService       IUserService
+	logger            *zap.SugaredLogger
+	signingKeyService signingkey.ISigningKeyService
+	guardService      guard.IGuardService
 }
 
-func NewHttpHandler(guardService guard.IGuardService, userService IUserService, logger *zap.SugaredLogger, jwtPrivateKey string) *HttpHandler {
-	return &HttpHandler{guardService: guardService, userService: userService, logger: logger, jwtPrivateKey: jwtPrivateKey}
+func NewHttpHandler(guardService guard.IGuardService, userService IUserService, logger *zap.SugaredLogger, signingKeyService signingkey.ISigningKeyService) *HttpHandler {
+	return &HttpHandler{guardService: guardService, userService: userService, logger: logger, signingKeyService: signingKeyService}
 }
 
 func (h *HttpHandler) RegisterRoutes(app *fiber.App) {
-	authGroup := app.Group("/private").Use(middleware.AuthMiddleware(h.jwtPrivateKey))
+	authGroup := app.Group("/private").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
 	authGroup.Put("/update/photo", h.UpdatePhoto)
+	authGroup.Post("/verify-email/resend", h.ResendVerification)
+	authGroup.Patch("/profile", h.UpdateProfile)
+	authGroup.Put("/update/cover", h.UpdateCover)
+
+	usersGroup := app.Group("/users").Use(middleware.AuthMiddleware(h.signingKeyService, h.guardService))
+	usersGroup.Get("/search", h.SearchUsers)
+	usersGroup.Get("/:username", h.GetProfile)
 
 	noAuthGroup := app.Group("/public")
 	noAuthGroup.Post("/register", h.Register)
+	noAuthGroup.Post("/verify-email", h.VerifyEmail)
+	noAuthGroup.Post("/email/confirm", h.ConfirmEmailChange)
+	noAuthGroup.Post("/password/forgot", h.ForgotPassword)
+	noAuthGroup.Post("/password/reset", h.ResetPassword)
 }
 
 // Register godoc
@@ -99,3 +113,301 @@ func (h *HttpHandler) UpdatePhoto(ctx *fiber.Ctx) error {
 
 	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, httpmodel.UpdateImageResponse{UploadedFileName: uploadedImage}))
 }
+
+// SearchUsers godoc
+// @Summary Search users
+// @Description Search users by username, first name and last name. Prefix matches come first, typos are tolerated,
+// @Description and users with more friends in common with the logged-in user rank higher.
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param q query string true "Text to search, at most 100 characters"
+// @Param cursor query string false "next_cursor of the previous page, empty for the first page"
+// @Param limit query integer false "Page size, at most 50"
+// @Success 200 {object} []SearchUserResponse "Success"
+// @Failure 400
+// @Failure 500
+// @Router /users/search [get]
+func (h *HttpHandler) SearchUsers(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	page, err := pagination.OffsetFromCtx(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not search users", err.Error(), http.StatusBadRequest))
+	}
+
+	users, nextCursor, err := h.userService.SearchUsers(userID, ctx.Query("q"), page)
+	if err != nil {
+		if errors.Is(err, ErrInvalidSearch) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not search users", err.Error(), http.StatusBadRequest))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not search users", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewPage(ctx, http.StatusOK, users, nextCursor))
+}
+
+// GetProfile godoc
+// @Summary Get profile of user
+// @Description Get profile of the user with post, friend and received like counts, and the relationship of the logged-in user to them
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param username path string true "Username of the user"
+// @Success 200 {object} ProfileResponse
+// @Failure 400
+// @Failure 404
+// @Failure 500
+// @Router /users/{username} [get]
+func (h *HttpHandler) GetProfile(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	profile, err := h.userService.GetProfile(userID, ctx.Params("username"))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(httpresponse.NewError("can not get user", err.Error(), http.StatusNotFound))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not get user", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, profile))
+}
+
+// UpdateProfile godoc
+// @Summary Update own profile
+// @Description Update the given fields of the profile of the logged-in user, fields which are not given are kept.
+// @Description A new email is applied after it is confirmed with the mail sent to it and needs current_password. An old username keeps leading to the user for 30 days.
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param request body UpdateProfileRequest true "body params"
+// @Success 200 {object} ProfileResponse
+// @Failure 400
+// @Failure 401
+// @Failure 409
+// @Failure 500
+// @Router /private/profile [patch]
+func (h *HttpHandler) UpdateProfile(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	var req UpdateProfileRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	profile, err := h.userService.UpdateProfile(userID, req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidProfile) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not update profile", err.Error(), http.StatusBadRequest))
+		}
+		if errors.Is(err, ErrDuplicatedUser) {
+			return ctx.Status(fiber.StatusConflict).JSON(httpresponse.NewError("can not update profile", err.Error(), http.StatusConflict))
+		}
+		if errors.Is(err, ErrInvalidPassword) {
+			return ctx.Status(fiber.StatusUnauthorized).JSON(httpresponse.NewError("can not update profile", err.Error(), http.StatusUnauthorized))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not update profile", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, profile))
+}
+
+// UpdateCover godoc
+// @Summary Update own cover photo
+// @Description Update cover photo with authentication
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Param image formData file true "The image file to upload"
+// @Success 200 {object} httpmodel.UpdateImageResponse
+// @Failure 400
+// @Failure 500
+// @Router /private/update/cover [put]
+func (h *HttpHandler) UpdateCover(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	file, err := ctx.FormFile("image")
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get file", err.Error(), http.StatusBadRequest))
+	}
+
+	uploadedImage, err := h.userService.UpdateCoverPhoto(userID, file)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not update cover photo", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, httpmodel.UpdateImageResponse{UploadedFileName: uploadedImage}))
+}
+
+// ResendVerification godoc
+// @Summary Resend verification mail
+// @Description Send a new email verification link to the logged-in user
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param X-Auth-Token header string true "Auth token of logged-in user."
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /private/verify-email/resend [post]
+func (h *HttpHandler) ResendVerification(ctx *fiber.Ctx) error {
+	token := ctx.Get("X-Auth-Token")
+	if ok := h.guardService.CheckTokenInBlacklist(token); ok {
+		return ctx.Status(fiber.StatusForbidden).JSON(httpresponse.NewError("invalid token", "token is not valid", http.StatusForbidden))
+	}
+	userID, exists := ctx.Locals(constants.UserIdKey).(uint)
+	if !exists {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not get user from context", "can not get user from context", http.StatusBadRequest))
+	}
+
+	if err := h.userService.SendEmailVerification(userID); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not send verification mail", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// VerifyEmail godoc
+// @Summary Verify email
+// @Description Verify email of the user with the single use token sent by mail
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param request body VerifyEmailRequest true "body params"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /public/verify-email [post]
+func (h *HttpHandler) VerifyEmail(ctx *fiber.Ctx) error {
+	var req VerifyEmailRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	if err := h.userService.VerifyEmail(req.Token); err != nil {
+		if errors.Is(err, ErrInvalidUserToken) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not verify email", err.Error(), http.StatusBadRequest))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not verify email", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// ForgotPassword godoc
+// @Summary Request password reset
+// @Description Send a password reset link to the email. The response is the same whether the email is registered or not.
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param request body ForgotPasswordRequest true "body params"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /public/password/forgot [post]
+func (h *HttpHandler) ForgotPassword(ctx *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	if err := h.userService.RequestPasswordReset(req.Email); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not send password reset mail", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with the single use token sent by mail. Every session of the user is revoked.
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param request body ResetPasswordRequest true "body params"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 500
+// @Router /public/password/reset [post]
+func (h *HttpHandler) ResetPassword(ctx *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	if req.Password == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("password is required", "password is required", http.StatusBadRequest))
+	}
+
+	if err := h.userService.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, ErrInvalidUserToken) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not reset password", err.Error(), http.StatusBadRequest))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not reset password", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
+
+// ConfirmEmailChange godoc
+// @Summary Confirm email change
+// @Description Apply the new email of the user with the single use token sent to the new email
+// @Tags User
+// @Accept  json
+// @Produce  json
+// @Param request body ConfirmEmailChangeRequest true "body params"
+// @Success 200 {object} httpresponse.Response "Success"
+// @Failure 400
+// @Failure 409
+// @Failure 500
+// @Router /public/email/confirm [post]
+func (h *HttpHandler) ConfirmEmailChange(ctx *fiber.Ctx) error {
+	var req ConfirmEmailChangeRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not parse body", err.Error(), http.StatusBadRequest))
+	}
+
+	if err := h.userService.ConfirmEmailChange(req.Token); err != nil {
+		if errors.Is(err, ErrInvalidUserToken) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(httpresponse.NewError("can not confirm email", err.Error(), http.StatusBadRequest))
+		}
+		if errors.Is(err, ErrDuplicatedUser) {
+			return ctx.Status(fiber.StatusConflict).JSON(httpresponse.NewError("can not confirm email", err.Error(), http.StatusConflict))
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(httpresponse.NewError("can not confirm email", err.Error(), http.StatusInternalServerError))
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(httpresponse.NewSuccess(ctx, http.StatusOK, nil))
+}
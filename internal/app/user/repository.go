@@ -5,6 +5,8 @@ import (
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"strings"
+	"time"
 )
 
 type IUserRepository interface {
@@ -14,9 +16,40 @@ type IUserRepository interface {
 	GetUserById(id uint) (*entity.User, error)
 	IsUserExistWithSameUsername(username string) bool
 	IsUserExistWithSameEmail(email string) bool
+	GetUserByEmail(email string) (*entity.User, error)
+
+	CreateUserToken(userToken entity.UserToken) (*entity.UserToken, error)
+	GetUserTokenByHash(tokenHash string) (*entity.UserToken, error)
+	MarkUserTokenUsed(id uint) (bool, error)
+	InvalidateUserTokens(userID uint, purpose entity.UserTokenPurpose) error
+	RevokeSessionsByUserID(userID uint) error
+
+	UpdateFields(userID uint, fields map[string]interface{}) error
+	UpdateProfile(userID uint, update ProfileUpdate) error
+	GetUserByUsernameAlias(username string) (*entity.User, error)
+	IsUsernameAliasTaken(username string, userID uint) bool
+
+	SearchUsers(viewerID uint, query string, offset, limit int) ([]SearchUserResult, error)
 	Migration() error
 }
 
+// SearchUserResult is a user matching a search with the number of friends in common with the viewer
+type SearchUserResult struct {
+	entity.User
+	MutualFriends int64
+}
+
+// ProfileUpdate is everything a profile update writes. Username and email change only when NewUsername and
+// EmailChangeToken are set.
+type ProfileUpdate struct {
+	Fields           map[string]interface{}
+	OldUsername      string
+	NewUsername      string
+	AliasExpiresAt   time.Time
+	EmailChangeToken *entity.UserToken // Replaces the email change tokens which are not used yet
+	BecamePublic     bool              // Accepts the waiting follow requests, nobody is left waiting once approval is not needed
+}
+
 type userRepository struct {
 	db     *gorm.DB
 	logger *zap.SugaredLogger
@@ -73,6 +106,216 @@ func (r *userRepository) Update(user entity.User) (*entity.User, error) {
 	return &user, nil
 }
 
+func (r *userRepository) GetUserByEmail(email string) (user *entity.User, err error) {
+	if err = r.db.Model(&entity.User{}).Where("email =?", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) CreateUserToken(userToken entity.UserToken) (*entity.UserToken, error) {
+	if err := r.db.Create(&userToken).Error; err != nil {
+		return nil, err
+	}
+	return &userToken, nil
+}
+
+func (r *userRepository) GetUserTokenByHash(tokenHash string) (userToken *entity.UserToken, err error) {
+	if err = r.db.Model(&entity.UserToken{}).Where("token_hash = ?", tokenHash).First(&userToken).Error; err != nil {
+		return nil, err
+	}
+	return userToken, nil
+}
+
+// MarkUserTokenUsed returns false when the token was already used, so a token can be consumed only once
+func (r *userRepository) MarkUserTokenUsed(id uint) (bool, error) {
+	result := r.db.Model(&entity.UserToken{}).Where("id = ? AND used_at IS NULL", id).Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *userRepository) InvalidateUserTokens(userID uint, purpose entity.UserTokenPurpose) error {
+	return r.db.Model(&entity.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+func (r *userRepository) RevokeSessionsByUserID(userID uint) error {
+	now := time.Now()
+	if err := r.db.Model(&entity.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return r.db.Model(&entity.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error
+}
+
+// UpdateFields updates the given columns only, unlike Update it can set a column to its zero value
+func (r *userRepository) UpdateFields(userID uint, fields map[string]interface{}) error {
+	return r.db.Model(&entity.User{}).Where("id = ?", userID).Updates(fields).Error
+}
+
+// UpdateProfile applies the profile update in one transaction, so that it is applied entirely or not at all. A changed
+// username keeps the old one as an alias of the user until the alias expires.
+func (r *userRepository) UpdateProfile(userID uint, update ProfileUpdate) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if len(update.Fields) > 0 {
+			if err := tx.Model(&entity.User{}).Where("id = ?", userID).Updates(update.Fields).Error; err != nil {
+				return err
+			}
+		}
+
+		if update.NewUsername != "" {
+			// Aliases of the user are given up when taken back, expired ones of anybody are free to take
+			if err := tx.Unscoped().
+				Where("username IN ? AND (user_id = ? OR expires_at < ?)", []string{update.OldUsername, update.NewUsername}, userID, time.Now()).
+				Delete(&entity.UsernameAlias{}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Model(&entity.User{}).Where("id = ?", userID).Update("username", update.NewUsername).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Create(&entity.UsernameAlias{
+				UserID:    userID,
+				Username:  update.OldUsername,
+				ExpiresAt: update.AliasExpiresAt,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		// Done with the privacy change, a failure leaves the account private with its requests still waiting
+		if update.BecamePublic {
+			if err := tx.Model(&entity.Follow{}).
+				Where("followee_id = ? AND status = ?", userID, entity.FriendshipStatusPending).
+				Update("status", entity.FriendshipStatusAccepted).Error; err != nil {
+				return err
+			}
+		}
+
+		if update.EmailChangeToken != nil {
+			// Only the link sent to the latest requested email works
+			if err := tx.Model(&entity.UserToken{}).
+				Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, entity.UserTokenPurposeEmailChange).
+				Update("used_at", time.Now()).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(update.EmailChangeToken).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *userRepository) GetUserByUsernameAlias(username string) (*entity.User, error) {
+	var user entity.User
+	if err := r.db.Model(&entity.User{}).
+		Joins("JOIN username_aliases ON username_aliases.user_id = users.id AND username_aliases.deleted_at IS NULL").
+		Where("username_aliases.username = ? AND username_aliases.expires_at > ?", username, time.Now()).
+		First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// IsUsernameAliasTaken tells whether the username is still an alias of another user
+func (r *userRepository) IsUsernameAliasTaken(username string, userID uint) bool {
+	var count int64
+	r.db.Model(&entity.UsernameAlias{}).
+		Where("username = ? AND user_id <> ? AND expires_at > ?", username, userID, time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+// SearchUsers matches the query as a prefix or with trigram similarity against username and full name. Prefix matches of
+// the username rank first, then closer matches; every mutual friend adds to the rank up to a limit.
+func (r *userRepository) SearchUsers(viewerID uint, query string, offset, limit int) ([]SearchUserResult, error) {
+	var results []SearchUserResult
+	err := r.db.Raw(`
+WITH viewer_friends AS (
+	SELECT CASE WHEN sender_id = @viewer THEN receiver_id ELSE sender_id END AS friend_id
+	FROM friendships
+	WHERE (sender_id = @viewer OR receiver_id = @viewer) AND status = @accepted AND deleted_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM users WHERE users.id IN (sender_id, receiver_id) AND users.deactivated_at IS NOT NULL)
+), candidates AS (
+	SELECT users.*,
+		(CASE WHEN lower(users.username) LIKE @prefix THEN 1.0 ELSE 0 END) +
+		(CASE WHEN lower(users.first_name) LIKE @prefix OR lower(users.last_name) LIKE @prefix THEN 0.5 ELSE 0 END) +
+		GREATEST(similarity(lower(users.username), @query), word_similarity(@query, lower(users.first_name || ' ' || users.last_name))) AS score
+	FROM users
+	WHERE users.deleted_at IS NULL
+		AND users.suspended_at IS NULL
+		AND users.deactivated_at IS NULL
+		AND users.id <> @viewer
+		AND NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @viewer AND blocks.blocked_id = users.id) OR (blocks.blocker_id = users.id AND blocks.blocked_id = @viewer))
+		AND (lower(users.username) LIKE @prefix
+			OR lower(users.first_name) LIKE @prefix
+			OR lower(users.last_name) LIKE @prefix
+			OR lower(users.username) % @query
+			OR @query <% lower(users.first_name || ' ' || users.last_name))
+)
+SELECT candidates.*, mutual.mutual_friends
+FROM candidates
+CROSS JOIN LATERAL (
+	SELECT COUNT(*) AS mutual_friends
+	FROM friendships
+	WHERE friendships.status = @accepted AND friendships.deleted_at IS NULL
+		AND ((friendships.sender_id = candidates.id AND friendships.receiver_id IN (SELECT friend_id FROM viewer_friends))
+			OR (friendships.receiver_id = candidates.id AND friendships.sender_id IN (SELECT friend_id FROM viewer_friends)))
+) mutual
+ORDER BY candidates.score + LEAST(mutual.mutual_friends, 10) * 0.1 DESC, candidates.id
+OFFSET @offset LIMIT @limit`, map[string]interface{}{
+		"viewer":   viewerID,
+		"accepted": entity.FriendshipStatusAccepted,
+		"query":    query,
+		"prefix":   escapeLike(query) + "%",
+		"offset":   offset,
+		"limit":    limit,
+	}).Scan(&results).Error
+	return results, err
+}
+
 func (r *userRepository) Migration() error {
-	return r.db.AutoMigrate(entity.User{})
+	// Posting needs a verified email, users who signed up before verification existed are trusted as they are
+	backfillVerification := !r.db.Migrator().HasColumn(&entity.User{}, "email_verified_at")
+	// Users created by an identity provider sign-in had the identity linked in the same request, accounts linked later keep their password
+	backfillPasswordless := !r.db.Migrator().HasColumn(&entity.User{}, "passwordless")
+
+	if err := r.db.AutoMigrate(entity.User{}, entity.UserToken{}, entity.UsernameAlias{}); err != nil {
+		return err
+	}
+
+	if backfillVerification {
+		if err := r.db.Model(&entity.User{}).Where("email_verified_at IS NULL").Update("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			return err
+		}
+	}
+
+	if backfillPasswordless && r.db.Migrator().HasTable(&entity.ExternalIdentity{}) {
+		if err := r.db.Exec("UPDATE users SET passwordless = true WHERE EXISTS (SELECT 1 FROM external_identities " +
+			"WHERE external_identities.user_id = users.id AND external_identities.created_at < users.created_at + interval '1 minute')").Error; err != nil {
+			return err
+		}
+	}
+
+	// Trigram indexes serve both the prefix and the similarity matches of the search
+	for _, statement := range []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (lower(username) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_users_first_name_trgm ON users USING gin (lower(first_name) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_users_last_name_trgm ON users USING gin (lower(last_name) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_users_full_name_trgm ON users USING gin (lower(first_name || ' ' || last_name) gin_trgm_ops)",
+	} {
+		if err := r.db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
 }
@@ -1,44 +1,119 @@
 package user
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
 	"github.com/mehmetokdemir/social-media-api/internal/app/cdn"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/httpmodel"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/pagination"
 	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/follow"
+	"github.com/mehmetokdemir/social-media-api/internal/app/friendship"
+	"github.com/mehmetokdemir/social-media-api/internal/app/like"
+	"github.com/mehmetokdemir/social-media-api/internal/app/mail"
+	"github.com/mehmetokdemir/social-media-api/internal/app/post"
 	"github.com/mehmetokdemir/social-media-api/internal/config"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"mime/multipart"
+	mailaddress "net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxUsernameLength is the longest username, usernames derived from an identity provider are shortened to fit it
+const MaxUsernameLength = 30
+
+const (
+	emailVerificationTokenDuration = 24 * time.Hour
+	passwordResetTokenDuration     = time.Hour
+	usernameAliasDuration          = 30 * 24 * time.Hour
+
+	maxNameLength     = 50
+	maxBioLength      = 160
+	maxLocationLength = 100
+	maxWebsiteLength  = 200
+	maxPronounsLength = 30
+	maxPhoneLength    = 20
+	minUsernameLength = 3
+	birthdayLayout    = "2006-01-02"
+	maxSearchLength   = 100
+	maxSearchSize     = 50
+)
+
+var (
+	ErrInvalidUserToken = errors.New("invalid or expired token")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidProfile   = errors.New("invalid profile")
+	ErrDuplicatedUser   = errors.New("duplicated user")
+	ErrInvalidSearch    = errors.New("invalid search")
+	ErrInvalidPassword  = errors.New("invalid password")
 )
 
 type IUserService interface {
 	CreateUser(user entity.User) (*entity.User, error)
 	UpdateProfilePhoto(userID uint, file *multipart.FileHeader) (string, error)
 	GetUserByUsername(username string) (*entity.User, error)
+	GetUserById(id uint) (*entity.User, error)
+	GetUserByEmail(email string) (*entity.User, error)
+	GetProfile(viewerID uint, username string) (*ProfileResponse, error)
+	UpdateProfile(userID uint, req UpdateProfileRequest) (*ProfileResponse, error)
+	UpdateCoverPhoto(userID uint, file *multipart.FileHeader) (string, error)
+	ConfirmEmailChange(token string) error
+	SearchUsers(viewerID uint, query string, page pagination.Page) ([]SearchUserResponse, string, error)
+	ReactivateUser(userID uint) error
+
+	SendEmailVerification(userID uint) error
+	VerifyEmail(token string) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, password string) error
 }
 
 type userService struct {
-	config         config.Config
-	logger         *zap.SugaredLogger
-	userRepository IUserRepository
-	cdnService     cdn.ICdnService
+	config            config.Config
+	logger            *zap.SugaredLogger
+	userRepository    IUserRepository
+	cdnService        cdn.ICdnService
+	mailer            mail.IMailer
+	blockService      block.IBlockService
+	postService       post.IPostService
+	friendshipService friendship.IFriendshipService
+	followService     follow.IFollowService
+	likeService       like.ILikeService
 }
 
-func NewUserService(userRepository IUserRepository, cdnService cdn.ICdnService, logger *zap.SugaredLogger, config config.Config) IUserService {
+func NewUserService(userRepository IUserRepository, cdnService cdn.ICdnService, mailer mail.IMailer, blockService block.IBlockService, postService post.IPostService,
+	friendshipService friendship.IFriendshipService, followService follow.IFollowService, likeService like.ILikeService, logger *zap.SugaredLogger, config config.Config) IUserService {
 	if userRepository == nil {
 		return nil
 	}
 
 	return &userService{
-		config:         config,
-		userRepository: userRepository,
-		logger:         logger,
-		cdnService:     cdnService,
+		config:            config,
+		userRepository:    userRepository,
+		logger:            logger,
+		cdnService:        cdnService,
+		mailer:            mailer,
+		blockService:      blockService,
+		postService:       postService,
+		friendshipService: friendshipService,
+		followService:     followService,
+		likeService:       likeService,
 	}
 }
 
 func (s *userService) CreateUser(user entity.User) (*entity.User, error) {
-	if s.userRepository.IsUserExistWithSameEmail(user.Email) || s.userRepository.IsUserExistWithSameUsername(user.Username) {
-		return nil, errors.New("duplicated user")
+	if s.userRepository.IsUserExistWithSameEmail(user.Email) || s.userRepository.IsUserExistWithSameUsername(user.Username) ||
+		s.userRepository.IsUsernameAliasTaken(user.Username, 0) {
+		return nil, ErrDuplicatedUser
 	}
 
 	hashedPassword, err := s.hashPassword(user.Password)
@@ -52,6 +127,15 @@ func (s *userService) CreateUser(user entity.User) (*entity.User, error) {
 		return nil, err
 	}
 
+	if createdUser.EmailVerifiedAt != nil {
+		return createdUser, nil
+	}
+
+	// The account is created even if the mail can not be sent, verification mail can be requested again
+	if err = s.SendEmailVerification(createdUser.ID); err != nil {
+		s.logger.Errorf("can not send verification mail to user %d: %v", createdUser.ID, err)
+	}
+
 	return createdUser, nil
 }
 
@@ -78,6 +162,555 @@ func (s *userService) GetUserByUsername(username string) (*entity.User, error) {
 	return s.userRepository.GetUserByUsername(username)
 }
 
+func (s *userService) GetUserById(id uint) (*entity.User, error) {
+	return s.userRepository.GetUserById(id)
+}
+
+func (s *userService) GetUserByEmail(email string) (*entity.User, error) {
+	return s.userRepository.GetUserByEmail(email)
+}
+
+// ReactivateUser shows a deactivated user and their content again
+func (s *userService) ReactivateUser(userID uint) error {
+	return s.userRepository.UpdateFields(userID, map[string]interface{}{"deactivated_at": nil})
+}
+
+func (s *userService) GetProfile(viewerID uint, username string) (*ProfileResponse, error) {
+	userByUsername, err := s.userRepository.GetUserByUsername(username)
+	if err != nil {
+		// A changed username keeps leading to the user for a while
+		if userByUsername, err = s.userRepository.GetUserByUsernameAlias(username); err != nil {
+			return nil, ErrUserNotFound
+		}
+	}
+
+	// Suspended and deactivated users are not shown to others
+	if (userByUsername.SuspendedAt != nil || userByUsername.DeactivatedAt != nil) && userByUsername.ID != viewerID {
+		return nil, ErrUserNotFound
+	}
+
+	// Users who blocked each other can not see each other's profile either way
+	blocked, err := s.blockService.IsBlocked(viewerID, userByUsername.ID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrUserNotFound
+	}
+
+	var pendingEmail string
+	if userByUsername.ID == viewerID {
+		pendingEmail = userByUsername.PendingEmail
+	}
+
+	var counts ProfileCounts
+	if counts.Posts, err = s.postService.CountPosts(viewerID, userByUsername.ID); err != nil {
+		return nil, err
+	}
+	if counts.Friends, err = s.friendshipService.CountFriends(userByUsername.ID); err != nil {
+		return nil, err
+	}
+	if counts.LikesReceived, err = s.likeService.CountLikesReceived(userByUsername.ID); err != nil {
+		return nil, err
+	}
+	if counts.Followers, err = s.followService.CountFollowers(userByUsername.ID); err != nil {
+		return nil, err
+	}
+	if counts.Following, err = s.followService.CountFollowing(userByUsername.ID); err != nil {
+		return nil, err
+	}
+
+	var followStatus string
+	if userByUsername.ID != viewerID {
+		follow, err := s.followService.GetFollow(viewerID, userByUsername.ID)
+		if err != nil {
+			return nil, err
+		}
+		if follow != nil {
+			followStatus = string(follow.Status)
+		}
+	}
+
+	return &ProfileResponse{
+		CommonUser: httpmodel.CommonUser{
+			Id:           userByUsername.ID,
+			Username:     userByUsername.Username,
+			FirstName:    userByUsername.FirstName,
+			LastName:     userByUsername.LastName,
+			ProfilePhoto: userByUsername.ProfilePhoto,
+		},
+		CreatedAt:    userByUsername.CreatedAt.Format(time.RFC3339),
+		Bio:          userByUsername.Bio,
+		Location:     userByUsername.Location,
+		Website:      userByUsername.Website,
+		Birthday:     formatBirthday(userByUsername.Birthday),
+		Pronouns:     userByUsername.Pronouns,
+		CoverPhoto:   userByUsername.CoverPhoto,
+		PendingEmail: pendingEmail,
+		Counts:       counts,
+		Relationship: s.relationship(viewerID, userByUsername.ID),
+		IsPrivate:    userByUsername.IsPrivate,
+		FollowStatus: followStatus,
+	}, nil
+}
+
+func (s *userService) UpdateProfile(userID uint, req UpdateProfileRequest) (*ProfileResponse, error) {
+	userByID, err := s.userRepository.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := s.validateProfile(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Availability is checked before anything is written, so that the request is applied entirely or not at all
+	usernameChanged := req.Username != nil && *req.Username != userByID.Username
+	if usernameChanged && (s.userRepository.IsUserExistWithSameUsername(*req.Username) || s.userRepository.IsUsernameAliasTaken(*req.Username, userByID.ID)) {
+		return nil, ErrDuplicatedUser
+	}
+
+	emailChanged := req.Email != nil && !strings.EqualFold(strings.TrimSpace(*req.Email), userByID.Email)
+	if emailChanged && s.userRepository.IsUserExistWithSameEmail(strings.TrimSpace(*req.Email)) {
+		return nil, ErrDuplicatedUser
+	}
+
+	// A stolen session must not be enough to take the account over through its email, accounts without a password
+	// have only their session to show
+	if emailChanged && !userByID.Passwordless && (req.CurrentPassword == nil || bcrypt.CompareHashAndPassword([]byte(userByID.Password), []byte(*req.CurrentPassword)) != nil) {
+		return nil, ErrInvalidPassword
+	}
+
+	update := ProfileUpdate{Fields: fields, BecamePublic: req.IsPrivate != nil && !*req.IsPrivate && userByID.IsPrivate}
+	if usernameChanged {
+		update.OldUsername, update.NewUsername = userByID.Username, *req.Username
+		update.AliasExpiresAt = time.Now().Add(usernameAliasDuration)
+	}
+
+	var emailChangeToken string
+	if emailChanged {
+		update.Fields["pending_email"] = strings.TrimSpace(*req.Email)
+		if emailChangeToken, update.EmailChangeToken, err = s.newUserToken(userByID.ID, entity.UserTokenPurposeEmailChange, emailVerificationTokenDuration); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.userRepository.UpdateProfile(userByID.ID, update); err != nil {
+		return nil, err
+	}
+
+	if usernameChanged {
+		userByID.Username = *req.Username
+	}
+
+	// Mails are sent once the change is stored, a failed mail can be asked for again by repeating the change
+	if emailChanged {
+		if err = s.sendEmailChangeMails(userByID, strings.TrimSpace(*req.Email), emailChangeToken); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetProfile(userByID.ID, userByID.Username)
+}
+
+// validateProfile returns the columns to update for the fields which are given, username and email are handled apart
+func (s *userService) validateProfile(req UpdateProfileRequest) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+
+	textFields := []struct {
+		column    string
+		value     *string
+		maxLength int
+	}{
+		{"first_name", req.FirstName, maxNameLength},
+		{"last_name", req.LastName, maxNameLength},
+		{"bio", req.Bio, maxBioLength},
+		{"location", req.Location, maxLocationLength},
+		{"pronouns", req.Pronouns, maxPronounsLength},
+	}
+	for _, field := range textFields {
+		if field.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*field.value)
+		if utf8.RuneCountInString(value) > field.maxLength {
+			return nil, fmt.Errorf("%w: %s can be at most %d characters", ErrInvalidProfile, field.column, field.maxLength)
+		}
+		fields[field.column] = value
+	}
+
+	if req.PhoneNumber != nil {
+		phoneNumber := strings.TrimSpace(*req.PhoneNumber)
+		if len(phoneNumber) > maxPhoneLength || strings.Trim(phoneNumber, "0123456789+-() ") != "" {
+			return nil, fmt.Errorf("%w: phone_number can only have at most %d digits, spaces and +-() characters", ErrInvalidProfile, maxPhoneLength)
+		}
+		fields["phone_number"] = phoneNumber
+	}
+
+	if req.Website != nil {
+		website := strings.TrimSpace(*req.Website)
+		if website != "" {
+			parsed, err := url.Parse(website)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(website) > maxWebsiteLength {
+				return nil, fmt.Errorf("%w: website must be an http or https url of at most %d characters", ErrInvalidProfile, maxWebsiteLength)
+			}
+		}
+		fields["website"] = website
+	}
+
+	if req.Birthday != nil {
+		if *req.Birthday == "" {
+			fields["birthday"] = nil
+		} else {
+			birthday, err := time.Parse(birthdayLayout, *req.Birthday)
+			if err != nil || birthday.After(time.Now()) || birthday.Year() < 1900 {
+				return nil, fmt.Errorf("%w: birthday must be a past date like 1990-01-22", ErrInvalidProfile)
+			}
+			fields["birthday"] = birthday
+		}
+	}
+
+	if req.IsPrivate != nil {
+		fields["is_private"] = *req.IsPrivate
+	}
+
+	if req.Username != nil && !isValidUsername(*req.Username) {
+		return nil, fmt.Errorf("%w: username must be %d to %d letters, digits, dots or underscores", ErrInvalidProfile, minUsernameLength, MaxUsernameLength)
+	}
+
+	if req.Email != nil {
+		if _, err := mailaddress.ParseAddress(strings.TrimSpace(*req.Email)); err != nil {
+			return nil, fmt.Errorf("%w: email is not valid", ErrInvalidProfile)
+		}
+	}
+
+	return fields, nil
+}
+
+// sendEmailChangeMails sends the confirmation link to the new email, the current email is kept until it is confirmed
+func (s *userService) sendEmailChangeMails(user *entity.User, email, token string) error {
+	if err := s.mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your new email by opening the link below. The link expires in 24 hours.\n\n%s/confirm-email?token=%s\n",
+			user.FirstName, s.config.AppBaseURL, token),
+	}); err != nil {
+		return err
+	}
+
+	// The current address is told as well, in case somebody else asked for the change
+	if err := s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your email is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nA change of the email of your account to %s was requested. It is applied once the new email is confirmed.\nIf you did not ask for it, reset your password.\n",
+			user.FirstName, email),
+	}); err != nil {
+		s.logger.Errorf("can not send email change notice to user %d: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+func (s *userService) ConfirmEmailChange(token string) error {
+	userToken, err := s.consumeUserToken(token, entity.UserTokenPurposeEmailChange)
+	if err != nil {
+		return err
+	}
+
+	userByID, err := s.userRepository.GetUserById(userToken.UserID)
+	if err != nil {
+		return err
+	}
+
+	if userByID.PendingEmail == "" {
+		return ErrInvalidUserToken
+	}
+
+	// The email could be taken while waiting for the confirmation
+	if s.userRepository.IsUserExistWithSameEmail(userByID.PendingEmail) {
+		return ErrDuplicatedUser
+	}
+
+	return s.userRepository.UpdateFields(userByID.ID, map[string]interface{}{
+		"email":             userByID.PendingEmail,
+		"pending_email":     "",
+		"email_verified_at": time.Now(),
+	})
+}
+
+func (s *userService) UpdateCoverPhoto(userID uint, file *multipart.FileHeader) (string, error) {
+	userByID, err := s.userRepository.GetUserById(userID)
+	if err != nil {
+		return "", err
+	}
+
+	fileName, err := s.cdnService.UploadImage(file)
+	if err != nil {
+		return "", err
+	}
+
+	if err = s.userRepository.UpdateFields(userByID.ID, map[string]interface{}{"cover_photo": fileName}); err != nil {
+		return "", err
+	}
+
+	return fileName, nil
+}
+
+// SearchUsers ranks the matches by relevance, the ranking has no stable keyset, so the results are paged by offset
+func (s *userService) SearchUsers(viewerID uint, query string, page pagination.Page) ([]SearchUserResponse, string, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil, "", fmt.Errorf("%w: q is required", ErrInvalidSearch)
+	}
+	if utf8.RuneCountInString(query) > maxSearchLength {
+		return nil, "", fmt.Errorf("%w: q can be at most %d characters", ErrInvalidSearch, maxSearchLength)
+	}
+
+	if page.Limit > maxSearchSize {
+		page.Limit = maxSearchSize
+	}
+
+	results, err := s.userRepository.SearchUsers(viewerID, query, page.Offset(), page.Limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	results, nextCursor := pagination.NextOffset(results, page)
+
+	rsp := make([]SearchUserResponse, 0, len(results))
+	for _, result := range results {
+		rsp = append(rsp, SearchUserResponse{
+			CommonUser: httpmodel.CommonUser{
+				Id:           result.ID,
+				Username:     result.Username,
+				FirstName:    result.FirstName,
+				LastName:     result.LastName,
+				ProfilePhoto: result.ProfilePhoto,
+			},
+			MutualFriends: result.MutualFriends,
+		})
+	}
+
+	return rsp, nextCursor, nil
+}
+
+// reservedUsernames collide with the routes under /users
+var reservedUsernames = map[string]bool{
+	"search": true,
+}
+
+func isValidUsername(username string) bool {
+	if reservedUsernames[strings.ToLower(username)] || len(username) < minUsernameLength || len(username) > MaxUsernameLength {
+		return false
+	}
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '_' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func formatBirthday(birthday *time.Time) *string {
+	if birthday == nil {
+		return nil
+	}
+	formatted := birthday.Format(birthdayLayout)
+	return &formatted
+}
+
+func (s *userService) relationship(viewerID, userID uint) RelationshipEnum {
+	if viewerID == userID {
+		return RelationshipSelf
+	}
+
+	friendship, err := s.friendshipService.GetLatestFriendship(viewerID, userID)
+	if err != nil {
+		return RelationshipNone
+	}
+
+	switch {
+	case friendship.Status == entity.FriendshipStatusAccepted:
+		return RelationshipFriend
+	case friendship.SenderID == viewerID:
+		return RelationshipPendingOutgoing
+	default:
+		return RelationshipPendingIncoming
+	}
+}
+
+func (s *userService) SendEmailVerification(userID uint) error {
+	userByID, err := s.userRepository.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+
+	if userByID.EmailVerifiedAt != nil {
+		return errors.New("email is already verified")
+	}
+
+	token, err := s.createUserToken(userByID.ID, entity.UserTokenPurposeEmailVerification, emailVerificationTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mail.Message{
+		To:      userByID.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease verify your email by opening the link below. The link expires in 24 hours.\n\n%s/verify-email?token=%s\n",
+			userByID.FirstName, s.config.AppBaseURL, token),
+	})
+}
+
+func (s *userService) VerifyEmail(token string) error {
+	userToken, err := s.consumeUserToken(token, entity.UserTokenPurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	userByID, err := s.userRepository.GetUserById(userToken.UserID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	userByID.EmailVerifiedAt = &now
+	_, err = s.userRepository.Update(*userByID)
+	return err
+}
+
+// RequestPasswordReset does not tell whether the email is registered, unknown emails are ignored silently
+func (s *userService) RequestPasswordReset(email string) error {
+	userByEmail, err := s.userRepository.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	// Only the latest reset link works
+	if err = s.userRepository.InvalidateUserTokens(userByEmail.ID, entity.UserTokenPurposePasswordReset); err != nil {
+		return err
+	}
+
+	token, err := s.createUserToken(userByEmail.ID, entity.UserTokenPurposePasswordReset, passwordResetTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mail.Message{
+		To:      userByEmail.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nYou can reset your password by opening the link below. The link expires in an hour.\nIf you did not ask for it, you can ignore this mail.\n\n%s/reset-password?token=%s\n",
+			userByEmail.FirstName, s.config.AppBaseURL, token),
+	})
+}
+
+func (s *userService) ResetPassword(token, password string) error {
+	userToken, err := s.consumeUserToken(token, entity.UserTokenPurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	userByID, err := s.userRepository.GetUserById(userToken.UserID)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	userByID.Password = hashedPassword
+	// Owning the mailbox proves the email address as well
+	if userByID.EmailVerifiedAt == nil {
+		now := time.Now()
+		userByID.EmailVerifiedAt = &now
+	}
+
+	if _, err = s.userRepository.Update(*userByID); err != nil {
+		return err
+	}
+
+	// Setting a password turns an account created through an identity provider into a regular one
+	if userByID.Passwordless {
+		if err = s.userRepository.UpdateFields(userByID.ID, map[string]interface{}{"passwordless": false}); err != nil {
+			return err
+		}
+	}
+
+	// Anyone logged in with the old password is logged out
+	return s.userRepository.RevokeSessionsByUserID(userByID.ID)
+}
+
+// createUserToken creates a random token signed with the purpose, only its hash is stored
+func (s *userService) createUserToken(userID uint, purpose entity.UserTokenPurpose, duration time.Duration) (string, error) {
+	token, userToken, err := s.newUserToken(userID, purpose, duration)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = s.userRepository.CreateUserToken(*userToken); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// newUserToken generates the token and the row to store for it without storing it
+func (s *userService) newUserToken(userID uint, purpose entity.UserTokenPurpose, duration time.Duration) (string, *entity.UserToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+
+	random := base64.RawURLEncoding.EncodeToString(b)
+	token := fmt.Sprintf("%s.%s", random, s.signUserToken(random, purpose))
+
+	return token, &entity.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: s.hashUserToken(token),
+		ExpiresAt: time.Now().Add(duration),
+	}, nil
+}
+
+func (s *userService) consumeUserToken(token string, purpose entity.UserTokenPurpose) (*entity.UserToken, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(s.signUserToken(parts[0], purpose))) {
+		return nil, ErrInvalidUserToken
+	}
+
+	userToken, err := s.userRepository.GetUserTokenByHash(s.hashUserToken(token))
+	if err != nil {
+		return nil, ErrInvalidUserToken
+	}
+
+	if userToken.Purpose != purpose || time.Now().After(userToken.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+
+	used, err := s.userRepository.MarkUserTokenUsed(userToken.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidUserToken
+	}
+
+	return userToken, nil
+}
+
+func (s *userService) signUserToken(random string, purpose entity.UserTokenPurpose) string {
+	mac := hmac.New(sha256.New, []byte(s.config.UserTokenSecret))
+	mac.Write([]byte(string(purpose) + ":" + random))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *userService) hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func (s *userService) hashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
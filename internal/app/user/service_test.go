@@ -0,0 +1,140 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// tokenRepository keeps one user and the user tokens in memory
+type tokenRepository struct {
+	IUserRepository
+	user    entity.User
+	tokens  map[string]*entity.UserToken
+	fields  map[string]interface{}
+	revoked bool
+}
+
+func (r *tokenRepository) CreateUserToken(userToken entity.UserToken) (*entity.UserToken, error) {
+	userToken.ID = uint(len(r.tokens) + 1)
+	r.tokens[userToken.TokenHash] = &userToken
+	return &userToken, nil
+}
+
+func (r *tokenRepository) GetUserTokenByHash(tokenHash string) (*entity.UserToken, error) {
+	userToken, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *userToken
+	return &copied, nil
+}
+
+func (r *tokenRepository) MarkUserTokenUsed(id uint) (bool, error) {
+	for _, userToken := range r.tokens {
+		if userToken.ID == id && userToken.UsedAt == nil {
+			now := time.Now()
+			userToken.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *tokenRepository) GetUserById(id uint) (*entity.User, error) {
+	copied := r.user
+	return &copied, nil
+}
+
+func (r *tokenRepository) Update(user entity.User) (*entity.User, error) {
+	r.user = user
+	return &user, nil
+}
+
+func (r *tokenRepository) UpdateFields(userID uint, fields map[string]interface{}) error {
+	r.fields = fields
+	return nil
+}
+
+func (r *tokenRepository) RevokeSessionsByUserID(userID uint) error {
+	r.revoked = true
+	return nil
+}
+
+func newTokenService(user entity.User) (*userService, *tokenRepository) {
+	repository := &tokenRepository{user: user, tokens: map[string]*entity.UserToken{}}
+	s := NewUserService(repository, nil, nil, nil, nil, nil, nil, nil, zap.NewNop().Sugar(), config.Config{UserTokenSecret: "secret"})
+	return s.(*userService), repository
+}
+
+func TestConsumeUserTokenIsSingleUse(t *testing.T) {
+	s, _ := newTokenService(entity.User{Model: gorm.Model{ID: 1}})
+	token, err := s.createUserToken(1, entity.UserTokenPurposeEmailVerification, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.consumeUserToken(token, entity.UserTokenPurposeEmailVerification); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.consumeUserToken(token, entity.UserTokenPurposeEmailVerification); !errors.Is(err, ErrInvalidUserToken) {
+		t.Fatalf("token is accepted twice: %v", err)
+	}
+}
+
+func TestConsumeUserTokenRejectsExpiredToken(t *testing.T) {
+	s, _ := newTokenService(entity.User{Model: gorm.Model{ID: 1}})
+	token, err := s.createUserToken(1, entity.UserTokenPurposePasswordReset, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.consumeUserToken(token, entity.UserTokenPurposePasswordReset); !errors.Is(err, ErrInvalidUserToken) {
+		t.Fatalf("expired token is accepted: %v", err)
+	}
+}
+
+func TestConsumeUserTokenChecksPurposeAndSignature(t *testing.T) {
+	s, _ := newTokenService(entity.User{Model: gorm.Model{ID: 1}})
+	token, err := s.createUserToken(1, entity.UserTokenPurposeEmailVerification, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.consumeUserToken(token, entity.UserTokenPurposePasswordReset); !errors.Is(err, ErrInvalidUserToken) {
+		t.Fatalf("verification token resets the password: %v", err)
+	}
+	if _, err = s.consumeUserToken(token+"x", entity.UserTokenPurposeEmailVerification); !errors.Is(err, ErrInvalidUserToken) {
+		t.Fatalf("token with a wrong signature is accepted: %v", err)
+	}
+	if _, err = s.consumeUserToken(token, entity.UserTokenPurposeEmailVerification); err != nil {
+		t.Fatalf("rejected tries used the token up: %v", err)
+	}
+}
+
+func TestResetPasswordGivesPasswordlessAccountAPassword(t *testing.T) {
+	s, repository := newTokenService(entity.User{Model: gorm.Model{ID: 1}, Passwordless: true})
+	token, err := s.createUserToken(1, entity.UserTokenPurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.ResetPassword(token, "TopSecret!!!"); err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(repository.user.Password), []byte("TopSecret!!!")) != nil {
+		t.Fatal("password is not stored")
+	}
+	if passwordless, ok := repository.fields["passwordless"]; !ok || passwordless != false {
+		t.Fatalf("account is still passwordless: %v", repository.fields)
+	}
+	if !repository.revoked {
+		t.Fatal("sessions are not revoked")
+	}
+}
@@ -6,23 +6,53 @@ import (
 	"github.com/joho/godotenv"
 	"os"
 	"strconv"
+	"strings"
 )
 
+// OidcProviderConfig is an OpenID Connect provider users can login with, endpoints are discovered from the issuer
+type OidcProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
 type Config struct {
-	DBHost                 string `mapstructure:"DB_HOST"`
-	DBPort                 string `mapstructure:"DB_PORT"`
-	DBPassword             string `mapstructure:"DB_PASSWORD"`
-	DBUser                 string `mapstructure:"DB_USER"`
-	DBName                 string `mapstructure:"DB_NAME"`
-	DBSSLMode              string `mapstructure:"DB_SSLMODE"`
-	DBDriver               string `mapstructure:"DB_DRIVER"`
-	ServerPort             string `mapstructure:"SERVER_PORT"`
-	AppEnv                 string `mapstructure:"APP_ENV"`
-	JwtATPrivateKey        string `mapstructure:"JWT_AT_PRIVATE_KEY"`
-	JwtATExpirationMinutes int    `mapstructure:"JWT_AT_EXPIRATION_MIN"`
-	CloudinaryCloudName    string `mapstructure:"CLOUDINARY_CLOUD_NAME"`
-	CloudinaryApiKey       string `mapstructure:"CLOUDINARY_API_KEY"`
-	CloudinaryApiSecret    string `mapstructure:"CLOUDINARY_API_SECRET"`
+	DBHost                    string               `mapstructure:"DB_HOST"`
+	DBPort                    string               `mapstructure:"DB_PORT"`
+	DBPassword                string               `mapstructure:"DB_PASSWORD"`
+	DBUser                    string               `mapstructure:"DB_USER"`
+	DBName                    string               `mapstructure:"DB_NAME"`
+	DBSSLMode                 string               `mapstructure:"DB_SSLMODE"`
+	DBDriver                  string               `mapstructure:"DB_DRIVER"`
+	ServerPort                string               `mapstructure:"SERVER_PORT"`
+	AppEnv                    string               `mapstructure:"APP_ENV"`
+	JwtATPrivateKey           string               `mapstructure:"JWT_AT_PRIVATE_KEY"`
+	JwtATExpirationMinutes    int                  `mapstructure:"JWT_AT_EXPIRATION_MIN"`
+	JwtRTExpirationMinutes    int                  `mapstructure:"JWT_RT_EXPIRATION_MIN"`
+	JwtKeyRotationHours       int                  `mapstructure:"JWT_KEY_ROTATION_HOURS"`
+	CloudinaryCloudName       string               `mapstructure:"CLOUDINARY_CLOUD_NAME"`
+	CloudinaryApiKey          string               `mapstructure:"CLOUDINARY_API_KEY"`
+	CloudinaryApiSecret       string               `mapstructure:"CLOUDINARY_API_SECRET"`
+	AppBaseURL                string               `mapstructure:"APP_BASE_URL"`
+	UserTokenSecret           string               `mapstructure:"USER_TOKEN_SECRET"`
+	MailDriver                string               `mapstructure:"MAIL_DRIVER"`
+	MailFrom                  string               `mapstructure:"MAIL_FROM"`
+	MailFileDir               string               `mapstructure:"MAIL_FILE_DIR"`
+	SmtpHost                  string               `mapstructure:"SMTP_HOST"`
+	SmtpPort                  string               `mapstructure:"SMTP_PORT"`
+	SmtpUsername              string               `mapstructure:"SMTP_USERNAME"`
+	SmtpPassword              string               `mapstructure:"SMTP_PASSWORD"`
+	LoginMaxFailures          int                  `mapstructure:"LOGIN_MAX_FAILURES"`
+	LoginMaxIPFailures        int                  `mapstructure:"LOGIN_MAX_IP_FAILURES"`
+	LoginLockoutMinutes       int                  `mapstructure:"LOGIN_LOCKOUT_MIN"`
+	OidcProviders             []OidcProviderConfig `mapstructure:"OIDC_PROVIDERS"`
+	AccountDeletionDays       int                  `mapstructure:"ACCOUNT_DELETION_DAYS"`
+	AccountDeletionPolicy     string               `mapstructure:"ACCOUNT_DELETION_POLICY"`
+	AccountReactivationDays   int                  `mapstructure:"ACCOUNT_REACTIVATION_DAYS"`
+	FriendRequestCooldownDays int                  `mapstructure:"FRIEND_REQUEST_COOLDOWN_DAYS"`
+	BootstrapAdminEmail       string               `mapstructure:"BOOTSTRAP_ADMIN_EMAIL"`
 }
 
 func NewConfig() Config {
@@ -35,25 +65,153 @@ func NewConfig() Config {
 	fmt.Println("APP ENV", os.Getenv("APP_ENV"))
 
 	jwtExpirationMin, _ := strconv.Atoi(os.Getenv("JWT_AT_EXPIRATION_MIN"))
+	jwtRefreshExpirationMin, err := strconv.Atoi(os.Getenv("JWT_RT_EXPIRATION_MIN"))
+	if err != nil || jwtRefreshExpirationMin <= 0 {
+		// Refresh tokens live for 30 days by default
+		jwtRefreshExpirationMin = 30 * 24 * 60
+	}
+
+	jwtKeyRotationHours, err := strconv.Atoi(os.Getenv("JWT_KEY_ROTATION_HOURS"))
+	if err != nil || jwtKeyRotationHours <= 0 {
+		// Signing keys are rotated weekly by default
+		jwtKeyRotationHours = 7 * 24
+	}
+
+	userTokenSecret := os.Getenv("USER_TOKEN_SECRET")
+	if userTokenSecret == "" {
+		userTokenSecret = os.Getenv("JWT_AT_PRIVATE_KEY")
+	}
+
+	loginMaxFailures, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES"))
+	if err != nil || loginMaxFailures <= 0 {
+		loginMaxFailures = 5
+	}
+
+	// An ip is shared by many users behind a NAT, so it tolerates more failures than an account
+	loginMaxIPFailures, err := strconv.Atoi(os.Getenv("LOGIN_MAX_IP_FAILURES"))
+	if err != nil || loginMaxIPFailures <= 0 {
+		loginMaxIPFailures = 20
+	}
+
+	loginLockoutMin, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_MIN"))
+	if err != nil || loginLockoutMin <= 0 {
+		loginLockoutMin = 15
+	}
+
+	accountDeletionDays, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_DAYS"))
+	if err != nil || accountDeletionDays < 0 {
+		// Deleted accounts can be restored for 30 days by default
+		accountDeletionDays = 30
+	}
+
+	accountDeletionPolicy := os.Getenv("ACCOUNT_DELETION_POLICY")
+	if accountDeletionPolicy == "" {
+		accountDeletionPolicy = "delete"
+	}
+
+	accountReactivationDays, err := strconv.Atoi(os.Getenv("ACCOUNT_REACTIVATION_DAYS"))
+	if err != nil || accountReactivationDays <= 0 {
+		// Deactivated accounts can be restored by logging in for 90 days by default, then they are deleted
+		accountReactivationDays = 90
+	}
+
+	friendRequestCooldownDays, err := strconv.Atoi(os.Getenv("FRIEND_REQUEST_COOLDOWN_DAYS"))
+	if err != nil || friendRequestCooldownDays < 0 {
+		// A rejected sender can ask the same user again after 30 days by default
+		friendRequestCooldownDays = 30
+	}
 
 	return Config{
-		DBHost:                 os.Getenv("DB_HOST"),
-		DBPort:                 os.Getenv("DB_PORT"),
-		DBPassword:             os.Getenv("DB_PASSWORD"),
-		DBUser:                 os.Getenv("DB_USER"),
-		DBName:                 os.Getenv("DB_NAME"),
-		DBSSLMode:              os.Getenv("DB_SSLMODE"),
-		DBDriver:               os.Getenv("DB_DRIVER"),
-		ServerPort:             os.Getenv("SERVER_PORT"),
-		AppEnv:                 os.Getenv("APP_ENV"),
-		JwtATPrivateKey:        os.Getenv("JWT_AT_PRIVATE_KEY"),
-		JwtATExpirationMinutes: jwtExpirationMin,
-		CloudinaryCloudName:    os.Getenv("CLOUDINARY_CLOUD_NAME"),
-		CloudinaryApiKey:       os.Getenv("CLOUDINARY_API_KEY"),
-		CloudinaryApiSecret:    os.Getenv("CLOUDINARY_API_SECRET"),
+		DBHost:                    os.Getenv("DB_HOST"),
+		DBPort:                    os.Getenv("DB_PORT"),
+		DBPassword:                os.Getenv("DB_PASSWORD"),
+		DBUser:                    os.Getenv("DB_USER"),
+		DBName:                    os.Getenv("DB_NAME"),
+		DBSSLMode:                 os.Getenv("DB_SSLMODE"),
+		DBDriver:                  os.Getenv("DB_DRIVER"),
+		ServerPort:                os.Getenv("SERVER_PORT"),
+		AppEnv:                    os.Getenv("APP_ENV"),
+		JwtATPrivateKey:           os.Getenv("JWT_AT_PRIVATE_KEY"),
+		JwtATExpirationMinutes:    jwtExpirationMin,
+		JwtRTExpirationMinutes:    jwtRefreshExpirationMin,
+		JwtKeyRotationHours:       jwtKeyRotationHours,
+		CloudinaryCloudName:       os.Getenv("CLOUDINARY_CLOUD_NAME"),
+		CloudinaryApiKey:          os.Getenv("CLOUDINARY_API_KEY"),
+		CloudinaryApiSecret:       os.Getenv("CLOUDINARY_API_SECRET"),
+		AppBaseURL:                os.Getenv("APP_BASE_URL"),
+		UserTokenSecret:           userTokenSecret,
+		MailDriver:                os.Getenv("MAIL_DRIVER"),
+		MailFrom:                  os.Getenv("MAIL_FROM"),
+		MailFileDir:               os.Getenv("MAIL_FILE_DIR"),
+		SmtpHost:                  os.Getenv("SMTP_HOST"),
+		SmtpPort:                  os.Getenv("SMTP_PORT"),
+		SmtpUsername:              os.Getenv("SMTP_USERNAME"),
+		SmtpPassword:              os.Getenv("SMTP_PASSWORD"),
+		LoginMaxFailures:          loginMaxFailures,
+		LoginMaxIPFailures:        loginMaxIPFailures,
+		LoginLockoutMinutes:       loginLockoutMin,
+		OidcProviders:             oidcProviders(),
+		AccountDeletionDays:       accountDeletionDays,
+		AccountDeletionPolicy:     accountDeletionPolicy,
+		AccountReactivationDays:   accountReactivationDays,
+		FriendRequestCooldownDays: friendRequestCooldownDays,
+		BootstrapAdminEmail:       os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+	}
+}
+
+// oidcProviders reads OIDC_PROVIDERS as a comma separated list of names, every provider is configured with
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and optionally OIDC_<NAME>_SCOPES
+func oidcProviders() []OidcProviderConfig {
+	var providers []OidcProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		scopes := strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " "))
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		providers = append(providers, OidcProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       scopes,
+		})
 	}
+	return providers
 }
 
+// redacted replaces a secret which is set, so that the output still tells whether it is configured
+const redacted = "[REDACTED]"
+
 func (c *Config) Print() {
 	fmt.Println(*c)
 }
+
+// String prints the config with its passwords, secrets and keys redacted
+func (c Config) String() string {
+	// plain has the fields of Config without this method, printing it does not call String again
+	type plain Config
+	masked := plain(c)
+
+	for _, secret := range []*string{&masked.DBPassword, &masked.JwtATPrivateKey, &masked.CloudinaryApiSecret, &masked.UserTokenSecret, &masked.SmtpPassword} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+
+	masked.OidcProviders = make([]OidcProviderConfig, len(c.OidcProviders))
+	for i, provider := range c.OidcProviders {
+		if provider.ClientSecret != "" {
+			provider.ClientSecret = redacted
+		}
+		masked.OidcProviders[i] = provider
+	}
+
+	return fmt.Sprintf("%+v", masked)
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStringRedactsSecrets(t *testing.T) {
+	c := Config{
+		DBHost:              "db",
+		DBPassword:          "db-password",
+		JwtATPrivateKey:     "jwt-key",
+		CloudinaryApiSecret: "cloudinary-secret",
+		UserTokenSecret:     "token-secret",
+		SmtpPassword:        "smtp-password",
+		OidcProviders:       []OidcProviderConfig{{Name: "google", ClientID: "client", ClientSecret: "client-secret"}},
+	}
+
+	printed := c.String()
+	for _, secret := range []string{"db-password", "jwt-key", "cloudinary-secret", "token-secret", "smtp-password", "client-secret"} {
+		if strings.Contains(printed, secret) {
+			t.Fatalf("%s is printed: %s", secret, printed)
+		}
+	}
+	if !strings.Contains(printed, "DBHost:db") || !strings.Contains(printed, "ClientID:client") {
+		t.Fatalf("settings which are not secret are missing: %s", printed)
+	}
+	if c.OidcProviders[0].ClientSecret != "client-secret" {
+		t.Fatal("printing changed the config")
+	}
+}
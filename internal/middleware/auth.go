@@ -1,19 +1,49 @@
 package middleware
 
 import (
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gofiber/fiber/v2"
 	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
 	j "github.com/mehmetokdemir/social-media-api/internal/app/common/jwttoken"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
+	"net/http"
+	"strings"
 )
 
-func AuthMiddleware(jwtPrivateKey string) fiber.Handler {
+// publicPaths are served without an access token even though their group is protected
+var publicPaths = map[string]bool{
+	"/auth/login":     true,
+	"/auth/login/mfa": true,
+	"/auth/refresh":   true,
+}
+
+// apiKeyForbiddenPaths can not be reached with an API key whatever its scopes are, they need a login session
+var apiKeyForbiddenPaths = []string{"/auth", "/admin", "/api-keys", "/account"}
+
+// apiKeyWriteScopes is the scope an API key needs for requests other than reads under the path
+var apiKeyWriteScopes = map[string]entity.ApiKeyScopeEnum{
+	"/post":       entity.ApiKeyScopePostWrite,
+	"/comment":    entity.ApiKeyScopeCommentWrite,
+	"/like":       entity.ApiKeyScopeLikeWrite,
+	"/friendship": entity.ApiKeyScopeFriendshipWrite,
+	"/blocks":     entity.ApiKeyScopeFriendshipWrite,
+	"/mutes":      entity.ApiKeyScopeFriendshipWrite,
+	"/follow":     entity.ApiKeyScopeFriendshipWrite,
+}
+
+func AuthMiddleware(signingKeyService signingkey.ISigningKeyService, guardService guard.IGuardService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 
-		if c.Path() == "/auth/login" {
+		if publicPaths[c.Path()] {
 			return c.Next()
 		}
 
+		// API keys are an alternative to access tokens for scripts and integrations
+		if apiKey := c.Get("X-Api-Key"); apiKey != "" && c.Get("X-Auth-Token") == "" {
+			return authenticateApiKey(c, guardService, apiKey)
+		}
+
 		tokenString := c.Get("X-Auth-Token")
 		if tokenString == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -22,16 +52,79 @@ func AuthMiddleware(jwtPrivateKey string) fiber.Handler {
 		}
 
 		tk := j.Token{}
-		token, err := jwt.ParseWithClaims(tokenString, &tk, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtPrivateKey), nil
-		})
-		if err != nil || !token.Valid {
+		token, err := signingKeyService.Parse(tokenString, &tk)
+		if err != nil || !token.Valid || tk.MfaPending {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Unauthorized",
 			})
 		}
 
+		// Tokens of a revoked session are rejected even though they are not expired yet
+		if !guardService.IsSessionActive(tk.SessionId) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+		_ = guardService.TouchSession(tk.SessionId)
+
 		c.Locals(constants.UserIdKey, tk.UserId)
+		c.Locals(constants.SessionIdKey, tk.SessionId)
+		c.Locals(constants.RoleKey, tk.Role)
+		c.Locals(constants.PermissionsKey, tk.Permissions)
 		return c.Next()
 	}
 }
+
+func authenticateApiKey(c *fiber.Ctx, guardService guard.IGuardService, key string) error {
+	apiKey, ok := guardService.AuthenticateApiKey(key)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	if !apiKeyAllows(apiKey, c.Method(), c.Path()) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Forbidden",
+		})
+	}
+	_ = guardService.TouchApiKey(apiKey.ID)
+
+	// Requests of an API key have neither a session nor a role, so admin permissions are never granted
+	c.Locals(constants.UserIdKey, apiKey.UserID)
+	c.Locals(constants.ApiKeyIdKey, apiKey.ID)
+	return c.Next()
+}
+
+func apiKeyAllows(apiKey *entity.ApiKey, method, path string) bool {
+	for _, forbiddenPath := range apiKeyForbiddenPaths {
+		if hasPathPrefix(path, forbiddenPath) {
+			return false
+		}
+	}
+
+	required := entity.ApiKeyScopeRead
+	if method != http.MethodGet && method != http.MethodHead {
+		required = ""
+		for prefix, scope := range apiKeyWriteScopes {
+			if hasPathPrefix(path, prefix) {
+				required = scope
+				break
+			}
+		}
+		if required == "" {
+			return false
+		}
+	}
+
+	for _, scope := range strings.Split(apiKey.Scopes, ",") {
+		if entity.ApiKeyScopeEnum(scope) == required {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
+	"github.com/mehmetokdemir/social-media-api/internal/app/entity"
+	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
+	"gorm.io/gorm"
+)
+
+// apiKeyGuard accepts one API key and counts how often it is touched
+type apiKeyGuard struct {
+	guard.IGuardService
+	apiKey  entity.ApiKey
+	touches int
+}
+
+func (g *apiKeyGuard) AuthenticateApiKey(key string) (*entity.ApiKey, bool) {
+	if key != "key" {
+		return nil, false
+	}
+	apiKey := g.apiKey
+	return &apiKey, true
+}
+
+func (g *apiKeyGuard) TouchApiKey(id uint) error {
+	g.touches++
+	return nil
+}
+
+func newApiKeyApp(scopes string) (*fiber.App, *apiKeyGuard) {
+	guardService := &apiKeyGuard{apiKey: entity.ApiKey{Model: gorm.Model{ID: 7}, UserID: 3, Scopes: scopes}}
+
+	app := fiber.New()
+	app.Use(AuthMiddleware(nil, guardService))
+	app.All("/*", func(c *fiber.Ctx) error {
+		if c.Locals(constants.UserIdKey) != uint(3) || c.Locals(constants.ApiKeyIdKey) != uint(7) {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if c.Locals(constants.PermissionsKey) != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app, guardService
+}
+
+func apiKeyRequest(t *testing.T, app *fiber.App, method, path, key string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-Api-Key", key)
+	rsp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsp.StatusCode
+}
+
+func TestApiKeyScopes(t *testing.T) {
+	app, guardService := newApiKeyApp(string(entity.ApiKeyScopeRead) + "," + string(entity.ApiKeyScopePostWrite))
+
+	for _, tc := range []struct {
+		method, path string
+		expected     int
+	}{
+		{http.MethodGet, "/post/list", http.StatusOK},
+		{http.MethodGet, "/friendship/list", http.StatusOK},
+		{http.MethodPost, "/post/create", http.StatusOK},
+		{http.MethodDelete, "/post/delete/1", http.StatusOK},
+		{http.MethodPost, "/comment/create", http.StatusForbidden},
+		{http.MethodPost, "/like/post/1", http.StatusForbidden},
+		{http.MethodPost, "/blocks/2", http.StatusForbidden},
+		{http.MethodPost, "/postscript", http.StatusForbidden},
+		{http.MethodPut, "/users/me", http.StatusForbidden},
+	} {
+		if status := apiKeyRequest(t, app, tc.method, tc.path, "key"); status != tc.expected {
+			t.Fatalf("%s %s: expected %d, got %d", tc.method, tc.path, tc.expected, status)
+		}
+	}
+	if guardService.touches != 4 {
+		t.Fatalf("expected the key to be touched by the 4 allowed requests, got %d", guardService.touches)
+	}
+}
+
+func TestApiKeyWithoutReadScopeCanNotRead(t *testing.T) {
+	app, _ := newApiKeyApp(string(entity.ApiKeyScopePostWrite))
+
+	if status := apiKeyRequest(t, app, http.MethodGet, "/post/list", "key"); status != http.StatusForbidden {
+		t.Fatalf("expected %d, got %d", http.StatusForbidden, status)
+	}
+}
+
+func TestApiKeyCanNotReachSessionOnlyPaths(t *testing.T) {
+	app, _ := newApiKeyApp(string(entity.ApiKeyScopeRead) + "," + string(entity.ApiKeyScopePostWrite))
+
+	for _, path := range []string{"/auth/sessions", "/admin/users", "/api-keys", "/account/export"} {
+		if status := apiKeyRequest(t, app, http.MethodGet, path, "key"); status != http.StatusForbidden {
+			t.Fatalf("GET %s: expected %d, got %d", path, http.StatusForbidden, status)
+		}
+	}
+}
+
+func TestUnknownApiKeyIsUnauthorized(t *testing.T) {
+	app, _ := newApiKeyApp(string(entity.ApiKeyScopeRead))
+
+	if status := apiKeyRequest(t, app, http.MethodGet, "/post/list", "other"); status != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, status)
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/constants"
+	"github.com/mehmetokdemir/social-media-api/internal/app/common/rbac"
+)
+
+// RequirePermission must run after AuthMiddleware, it rejects requests whose token does not carry the permission
+func RequirePermission(permission rbac.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		permissions, _ := c.Locals(constants.PermissionsKey).([]string)
+		if !rbac.HasPermission(permissions, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Forbidden",
+			})
+		}
+		return c.Next()
+	}
+}
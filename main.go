@@ -3,13 +3,21 @@ package main
 import (
 	"fmt"
 	"github.com/cloudinary/cloudinary-go"
+	"github.com/mehmetokdemir/social-media-api/internal/app/account"
+	"github.com/mehmetokdemir/social-media-api/internal/app/admin"
+	"github.com/mehmetokdemir/social-media-api/internal/app/apikey"
 	"github.com/mehmetokdemir/social-media-api/internal/app/auth"
+	"github.com/mehmetokdemir/social-media-api/internal/app/block"
 	"github.com/mehmetokdemir/social-media-api/internal/app/cdn"
 	"github.com/mehmetokdemir/social-media-api/internal/app/comment"
+	"github.com/mehmetokdemir/social-media-api/internal/app/follow"
 	"github.com/mehmetokdemir/social-media-api/internal/app/friendship"
 	"github.com/mehmetokdemir/social-media-api/internal/app/guard"
 	"github.com/mehmetokdemir/social-media-api/internal/app/like"
+	"github.com/mehmetokdemir/social-media-api/internal/app/mail"
+	"github.com/mehmetokdemir/social-media-api/internal/app/oidc"
 	"github.com/mehmetokdemir/social-media-api/internal/app/post"
+	"github.com/mehmetokdemir/social-media-api/internal/app/signingkey"
 	"github.com/mehmetokdemir/social-media-api/internal/app/transaction"
 	"github.com/mehmetokdemir/social-media-api/internal/app/user"
 	"github.com/mehmetokdemir/social-media-api/internal/config"
@@ -46,53 +54,135 @@ func run() error {
 	}
 	cdnService := cdn.NewCdnService(cloudinaryClient)
 
+	mailer, err := mail.NewMailer(appConfig)
+	if err != nil {
+		return err
+	}
+
 	blackListRepository := auth.NewRepository(db, zapLogger)
 	if err = blackListRepository.Migration(); err != nil {
 		return nil
 	}
 
+	refreshTokenRepository := auth.NewRefreshTokenRepository(db, zapLogger)
+	if err = refreshTokenRepository.Migration(); err != nil {
+		return nil
+	}
+
+	sessionRepository := auth.NewSessionRepository(db, zapLogger)
+	if err = sessionRepository.Migration(); err != nil {
+		return nil
+	}
+
+	mfaRepository := auth.NewMfaRepository(db, zapLogger)
+	if err = mfaRepository.Migration(); err != nil {
+		return nil
+	}
+
+	loginAttemptRepository := auth.NewLoginAttemptRepository(db, zapLogger)
+	if err = loginAttemptRepository.Migration(); err != nil {
+		return nil
+	}
+
+	signingKeyRepository := signingkey.NewRepository(db, zapLogger)
+	if err = signingKeyRepository.Migration(); err != nil {
+		return nil
+	}
+	signingKeyService, err := signingkey.NewSigningKeyService(signingKeyRepository, zapLogger, appConfig)
+	if err != nil {
+		return err
+	}
+	signingKeyService.StartRotation()
+	signingKeyHandler := signingkey.NewHttpHandler(signingKeyService, zapLogger)
+
 	guardRepository := guard.NewRepository(db, zapLogger)
-	guardService := guard.NewGuardService(guardRepository)
+	guardService := guard.NewGuardService(guardRepository, zapLogger)
+	guardService.StartBlacklistPurge()
+
+	blockRepository := block.NewRepository(db, zapLogger)
+	if err = blockRepository.Migration(); err != nil {
+		return nil
+	}
+	blockService := block.NewBlockService(blockRepository, zapLogger, appConfig)
+	blockHandler := block.NewHttpHandler(guardService, blockService, zapLogger, signingKeyService)
 
 	userRepository := user.NewRepository(db, zapLogger)
 	if err = userRepository.Migration(); err != nil {
 		return nil
 	}
-	userService := user.NewUserService(userRepository, cdnService, zapLogger, appConfig)
-	userHandler := user.NewHttpHandler(guardService, userService, zapLogger, appConfig.JwtATPrivateKey)
-
-	authService := auth.NewAuthService(userService, blackListRepository, zapLogger, appConfig)
-	authHandler := auth.NewHttpHandler(guardService, authService, zapLogger, appConfig.JwtATPrivateKey)
 
 	friendshipRepository := friendship.NewRepository(db, zapLogger)
 	if err = friendshipRepository.Migration(); err != nil {
 		return nil
 	}
 
-	friendshipService := friendship.NewFriendshipService(friendshipRepository, zapLogger, appConfig)
-	friendshipHandler := friendship.NewHttpHandler(guardService, friendshipService, zapLogger, appConfig.JwtATPrivateKey)
+	friendshipService := friendship.NewFriendshipService(friendshipRepository, blockService, zapLogger, appConfig)
+	friendshipHandler := friendship.NewHttpHandler(guardService, friendshipService, zapLogger, signingKeyService)
+
+	followRepository := follow.NewRepository(db, zapLogger)
+	if err = followRepository.Migration(); err != nil {
+		return nil
+	}
+
+	followService := follow.NewFollowService(followRepository, blockService, zapLogger, appConfig)
+	followHandler := follow.NewHttpHandler(guardService, followService, zapLogger, signingKeyService)
 
 	likeRepository := like.NewRepository(db, zapLogger)
 	if err = likeRepository.Migration(); err != nil {
 		return nil
 	}
 	likeService := like.NewLikeService(likeRepository, zapLogger, appConfig)
-	likeHandler := like.NewHttpHandler(guardService, likeService, zapLogger, appConfig.JwtATPrivateKey)
+	likeHandler := like.NewHttpHandler(guardService, likeService, zapLogger, signingKeyService)
 
 	transactionService := transaction.NewTransactionService(db)
 	commentRepository := comment.NewRepository(db, zapLogger)
 	if err = commentRepository.Migration(); err != nil {
 		return nil
 	}
-	commentService := comment.NewCommentService(commentRepository, likeService, cdnService, zapLogger, appConfig)
-	commentHandler := comment.NewHttpHandler(guardService, commentService, zapLogger, appConfig.JwtATPrivateKey)
+	commentService := comment.NewCommentService(commentRepository, likeService, blockService, cdnService, zapLogger, appConfig)
+	commentHandler := comment.NewHttpHandler(guardService, commentService, zapLogger, signingKeyService)
 
 	postRepository := post.NewRepository(db, zapLogger)
 	if err = postRepository.Migration(); err != nil {
 		return nil
 	}
-	postService := post.NewPostService(postRepository, cdnService, transactionService, commentService, likeService, zapLogger, appConfig)
-	postHandler := post.NewHttpHandler(guardService, postService, zapLogger, appConfig.JwtATPrivateKey)
+	postService := post.NewPostService(postRepository, cdnService, transactionService, commentService, likeService, blockService, zapLogger, appConfig)
+	postHandler := post.NewHttpHandler(guardService, postService, zapLogger, signingKeyService)
+
+	userService := user.NewUserService(userRepository, cdnService, mailer, blockService, postService, friendshipService, followService, likeService, zapLogger, appConfig)
+	userHandler := user.NewHttpHandler(guardService, userService, zapLogger, signingKeyService)
+
+	authService := auth.NewAuthService(userService, blackListRepository, refreshTokenRepository, sessionRepository, mfaRepository, loginAttemptRepository, signingKeyService, guardService, zapLogger, appConfig)
+	authHandler := auth.NewHttpHandler(guardService, authService, zapLogger, signingKeyService)
+
+	oidcRepository := oidc.NewRepository(db, zapLogger)
+	if err = oidcRepository.Migration(); err != nil {
+		return nil
+	}
+	oidcService := oidc.NewOidcService(oidcRepository, oidc.NewProviders(appConfig), userService, authService, zapLogger, appConfig)
+	oidcHandler := oidc.NewHttpHandler(oidcService, zapLogger)
+
+	apiKeyRepository := apikey.NewRepository(db, zapLogger)
+	if err = apiKeyRepository.Migration(); err != nil {
+		return nil
+	}
+	apiKeyService := apikey.NewApiKeyService(apiKeyRepository, zapLogger, appConfig)
+	apiKeyHandler := apikey.NewHttpHandler(guardService, apiKeyService, zapLogger, signingKeyService)
+
+	adminRepository := admin.NewRepository(db, zapLogger)
+	adminService := admin.NewAdminService(adminRepository, authService, postService, commentService, zapLogger, appConfig)
+	if err = adminService.BootstrapAdmin(); err != nil {
+		return err
+	}
+	adminHandler := admin.NewHttpHandler(guardService, adminService, zapLogger, signingKeyService)
+
+	accountRepository := account.NewRepository(db, zapLogger)
+	if err = accountRepository.Migration(); err != nil {
+		return nil
+	}
+	accountService := account.NewAccountService(accountRepository, mailer, cdnService, zapLogger, appConfig)
+	accountService.StartJobs()
+	accountHandler := account.NewHttpHandler(guardService, accountService, zapLogger, signingKeyService)
 
 	appServer := server.New([]server.Handler{
 		userHandler,
@@ -101,6 +191,13 @@ func run() error {
 		postHandler,
 		commentHandler,
 		likeHandler,
+		signingKeyHandler,
+		adminHandler,
+		apiKeyHandler,
+		oidcHandler,
+		accountHandler,
+		blockHandler,
+		followHandler,
 	}, appConfig, zapLogger)
 
 	fmt.Println("server is start")